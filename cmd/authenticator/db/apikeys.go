@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const apiKeyCollectionName = "apiKeys"
+
+// ErrDuplicateAPIKeyName is returned when a user already has an API key with the name
+var ErrDuplicateAPIKeyName = errors.New("an API key with this name already exists")
+
+// APIKey is an API key stored by the hash of its value, it authenticates as its user with its scopes
+type APIKey struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	Hash     string             `bson:"hash"`
+	Name     string             `bson:"name"`
+	Username string             `bson:"username"`
+	// Scopes are the permissions of the key, limited by the role of the user when it is used
+	Scopes    []string  `bson:"scopes"`
+	CreatedAt time.Time `bson:"createdAt"`
+	// ExpiresAt is when the key expires and is removed by mongo, it never expires when nil
+	ExpiresAt  *time.Time `bson:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `bson:"lastUsedAt,omitempty"`
+}
+
+// APIKeyStore represents a store for API keys, expired keys are removed by mongo
+type APIKeyStore struct {
+	client   *mongo.Client
+	database *mongo.Database
+	keys     *mongo.Collection
+}
+
+// NewAPIKeyStore creates a new API key store
+func NewAPIKeyStore(uri, databaseName string) (*APIKeyStore, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	err = client.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	database := client.Database(databaseName)
+	keys := database.Collection(apiKeyCollectionName)
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"hash": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "username", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.M{"expiresAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+	_, err = keys.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return nil, err
+	}
+	return &APIKeyStore{client: client, database: database, keys: keys}, nil
+}
+
+// AddAPIKey adds a new API key to the store, ErrDuplicateAPIKeyName is returned when its user has one with its name
+func (store *APIKeyStore) AddAPIKey(ctx context.Context, key APIKey) (*APIKey, error) {
+	key.ID = primitive.NewObjectID()
+	_, err := store.keys.InsertOne(ctx, key)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateAPIKeyName
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// FindAPIKeys returns the unexpired API keys of the user sorted by name
+func (store *APIKeyStore) FindAPIKeys(ctx context.Context, username string, now time.Time) ([]APIKey, error) {
+	query := bson.M{"username": username, "$or": unexpired(now)}
+	cursor, err := store.keys.Find(ctx, query, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var result []APIKey
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UseAPIKey records the use of the unexpired API key with the hash and returns it, mongo.ErrNoDocuments is returned
+// when it is unknown or expired
+func (store *APIKeyStore) UseAPIKey(ctx context.Context, hash string, now time.Time) (*APIKey, error) {
+	filter := bson.M{"hash": hash, "$or": unexpired(now)}
+	update := bson.M{"$set": bson.M{"lastUsedAt": now}}
+	var result APIKey
+	err := store.keys.FindOneAndUpdate(ctx, filter, update).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteAPIKey removes the API key of the user, mongo.ErrNoDocuments is returned when it does not exist
+func (store *APIKeyStore) DeleteAPIKey(ctx context.Context, username string, id primitive.ObjectID) error {
+	result, err := store.keys.DeleteOne(ctx, bson.M{"_id": id, "username": username})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteUserAPIKeys removes all the API keys of the user
+func (store *APIKeyStore) DeleteUserAPIKeys(ctx context.Context, username string) error {
+	_, err := store.keys.DeleteMany(ctx, bson.M{"username": username})
+	return err
+}
+
+// unexpired matches the keys without expiry or expiring after now, mongo removes the expired ones only every minute
+func unexpired(now time.Time) bson.A {
+	return bson.A{bson.M{"expiresAt": nil}, bson.M{"expiresAt": bson.M{"$gt": now}}}
+}
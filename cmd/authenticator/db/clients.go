@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const clientCollectionName = "clients"
+
+// Client is an OAuth2 client of a service account, authenticated by its id and the hash of its secret
+type Client struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	ClientID   string             `bson:"clientId"`
+	SecretHash string             `bson:"secretHash"`
+	Name       string             `bson:"name"`
+	// Tenant is the tenant whose sensors the client can access, the default tenant when empty
+	Tenant string `bson:"tenant"`
+	// Scopes are the permissions the client can be granted
+	Scopes    []string  `bson:"scopes"`
+	CreatedBy string    `bson:"createdBy"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+// ClientStore represents a store for OAuth2 clients
+type ClientStore struct {
+	client   *mongo.Client
+	database *mongo.Database
+	clients  *mongo.Collection
+}
+
+// NewClientStore creates a new OAuth2 client store
+func NewClientStore(uri, databaseName string) (*ClientStore, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	err = client.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	database := client.Database(databaseName)
+	clients := database.Collection(clientCollectionName)
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"clientId": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.M{"tenant": 1},
+			Options: nil,
+		},
+	}
+	_, err = clients.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientStore{client: client, database: database, clients: clients}, nil
+}
+
+// AddClient adds a new client to the store
+func (store *ClientStore) AddClient(ctx context.Context, client Client) error {
+	_, err := store.clients.InsertOne(ctx, client)
+	return err
+}
+
+// FindClient returns the client with the id, mongo.ErrNoDocuments is returned when it does not exist
+func (store *ClientStore) FindClient(ctx context.Context, clientID string) (*Client, error) {
+	var result Client
+	err := store.clients.FindOne(ctx, bson.M{"clientId": clientID}).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// FindClients returns the clients of the tenant sorted by name, of all the tenants when tenant is nil
+func (store *ClientStore) FindClients(ctx context.Context, tenant *string) ([]Client, error) {
+	query := bson.M{}
+	if tenant != nil {
+		query["tenant"] = *tenant
+	}
+	cursor, err := store.clients.Find(ctx, query, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var result []Client
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteClient removes the client, of the tenant unless tenant is nil. mongo.ErrNoDocuments is returned when it does
+// not exist.
+func (store *ClientStore) DeleteClient(ctx context.Context, clientID string, tenant *string) error {
+	query := bson.M{"clientId": clientID}
+	if tenant != nil {
+		query["tenant"] = *tenant
+	}
+	result, err := store.clients.DeleteOne(ctx, query)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
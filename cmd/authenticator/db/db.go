@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"regexp"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -19,6 +21,22 @@ type User struct {
 	Username string `bson:"username" json:"username"`
 	Password string `bson:"password"  json:"password"`
 	Role     string `bson:"role" json:"role"`
+	// Tenant is the tenant whose sensors the user can access, the default tenant when empty
+	Tenant string `bson:"tenant" json:"tenant"`
+	// Groups are the groups of the user, which the ACLs of the sensors grant access to
+	Groups []string `bson:"groups,omitempty" json:"groups,omitempty"`
+	// Disabled users can't login nor refresh their tokens
+	Disabled bool `bson:"disabled,omitempty" json:"-"`
+}
+
+// UserFilter selects the users listed, empty fields match all the users
+type UserFilter struct {
+	// Search matches the usernames containing it, ignoring the case
+	Search   string
+	Role     string
+	Disabled *bool
+	// Tenant selects only the users of the tenant when not nil
+	Tenant *string
 }
 
 // UserStore represents a store for users
@@ -52,6 +70,11 @@ func NewUserStore(uri, databaseName string) (*UserStore, error) {
 	if err != nil {
 		return nil, err
 	}
+	// The users stored before tenants existed belong to the default tenant
+	_, err = users.UpdateMany(ctx, bson.M{"tenant": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"tenant": ""}})
+	if err != nil {
+		return nil, err
+	}
 	// TODO move this to service
 	pass := os.Getenv("ROOT_PASSWORD")
 	if pass == "" {
@@ -65,13 +88,18 @@ func NewUserStore(uri, databaseName string) (*UserStore, error) {
 	root := User{
 		Username: "root",
 		Password: string(hashedPasswordBytes),
-		Role:     "ADMIN",
+		Role:     "SUPERADMIN",
 	}
 	_, err = users.InsertOne(ctx, root)
 	if err != nil {
 		// We are ignoring this error to avoid root kidnapping.
 		fmt.Println("Error while inserting root " + err.Error())
 	}
+	// The root of a single tenant deployment administered everything, it keeps doing so across the tenants
+	_, err = users.UpdateOne(ctx, bson.M{"username": "root", "role": "ADMIN"}, bson.M{"$set": bson.M{"role": "SUPERADMIN"}})
+	if err != nil {
+		return nil, err
+	}
 	return &UserStore{client: client, database: database, users: users}, nil
 }
 
@@ -90,3 +118,77 @@ func (store *UserStore) FindByUserName(ctx context.Context, username string) (*U
 	}
 	return &result, nil
 }
+
+// FindUsers returns the users matching the filter sorted by username
+func (store *UserStore) FindUsers(ctx context.Context, filter UserFilter) ([]User, error) {
+	query := bson.M{}
+	if filter.Search != "" {
+		query["username"] = primitive.Regex{Pattern: regexp.QuoteMeta(filter.Search), Options: "i"}
+	}
+	if filter.Role != "" {
+		query["role"] = filter.Role
+	}
+	if filter.Tenant != nil {
+		query["tenant"] = *filter.Tenant
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			query["disabled"] = true
+		} else {
+			query["disabled"] = bson.M{"$ne": true}
+		}
+	}
+	cursor, err := store.users.Find(ctx, query, options.Find().SetSort(bson.M{"username": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var result []User
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UpdateRole changes the role of the user, mongo.ErrNoDocuments is returned when it does not exist
+func (store *UserStore) UpdateRole(ctx context.Context, username, role string) error {
+	return store.updateUser(ctx, username, bson.M{"$set": bson.M{"role": role}})
+}
+
+// SetDisabled disables or enables the user, mongo.ErrNoDocuments is returned when it does not exist
+func (store *UserStore) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	return store.updateUser(ctx, username, bson.M{"$set": bson.M{"disabled": disabled}})
+}
+
+// UpdateGroups replaces the groups of the user, mongo.ErrNoDocuments is returned when it does not exist
+func (store *UserStore) UpdateGroups(ctx context.Context, username string, groups []string) error {
+	return store.updateUser(ctx, username, bson.M{"$set": bson.M{"groups": groups}})
+}
+
+// UpdatePassword replaces the password hash of the user, mongo.ErrNoDocuments is returned when it does not exist
+func (store *UserStore) UpdatePassword(ctx context.Context, username, hashedPassword string) error {
+	return store.updateUser(ctx, username, bson.M{"$set": bson.M{"password": hashedPassword}})
+}
+
+func (store *UserStore) updateUser(ctx context.Context, username string, update bson.M) error {
+	result, err := store.users.UpdateOne(ctx, bson.M{"username": username}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteUser removes the user, mongo.ErrNoDocuments is returned when it does not exist
+func (store *UserStore) DeleteUser(ctx context.Context, username string) error {
+	result, err := store.users.DeleteOne(ctx, bson.M{"username": username})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const signingKeyCollectionName = "signingKeys"
+
+// SigningKey is a key generated by the rotation, it is shared by all the authenticator instances.
+// It is removed by mongo at ExpiresAt, when the tokens it signed have expired.
+type SigningKey struct {
+	ID  primitive.ObjectID `bson:"_id,omitempty"`
+	Kid string             `bson:"kid"`
+	// PrivateKey is the PEM of the PKCS #8 key encrypted with SIGNING_KEY_ENCRYPTION_KEY, in clear for the keys stored
+	// before they were encrypted
+	PrivateKey string    `bson:"privateKey"`
+	CreatedAt  time.Time `bson:"createdAt"`
+	ExpiresAt  time.Time `bson:"expiresAt"`
+}
+
+// SigningKeyStore represents a store for the rotated signing keys
+type SigningKeyStore struct {
+	client   *mongo.Client
+	database *mongo.Database
+	keys     *mongo.Collection
+}
+
+// NewSigningKeyStore creates a new signing key store
+func NewSigningKeyStore(uri, databaseName string) (*SigningKeyStore, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	err = client.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	database := client.Database(databaseName)
+	keys := database.Collection(signingKeyCollectionName)
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"kid": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.M{"expiresAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+	_, err = keys.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKeyStore{client: client, database: database, keys: keys}, nil
+}
+
+// AddSigningKey adds a new signing key to the store
+func (store *SigningKeyStore) AddSigningKey(ctx context.Context, key SigningKey) error {
+	_, err := store.keys.InsertOne(ctx, key)
+	return err
+}
+
+// FindSigningKeys returns the keys that have not expired, newest first
+func (store *SigningKeyStore) FindSigningKeys(ctx context.Context, now time.Time) ([]SigningKey, error) {
+	cursor, err := store.keys.Find(ctx, bson.M{"expiresAt": bson.M{"$gt": now}},
+		options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	var result []SigningKey
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const refreshTokenCollectionName = "refreshTokens"
+
+// ErrRefreshTokenReused is returned when a refresh token that was already rotated is used again
+var ErrRefreshTokenReused = errors.New("refresh token was already used")
+
+// RefreshToken is a refresh token stored by the hash of its value, it can be used once to get new tokens
+type RefreshToken struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	Hash     string             `bson:"hash"`
+	Username string             `bson:"username"`
+	// Family groups the tokens rotated from the same login, they are revoked together when a token is reused
+	Family    primitive.ObjectID `bson:"family"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt,omitempty"`
+}
+
+// RefreshTokenStore represents a store for refresh tokens, expired tokens are removed by mongo
+type RefreshTokenStore struct {
+	client   *mongo.Client
+	database *mongo.Database
+	tokens   *mongo.Collection
+}
+
+// NewRefreshTokenStore creates a new refresh token store
+func NewRefreshTokenStore(uri, databaseName string) (*RefreshTokenStore, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	err = client.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	database := client.Database(databaseName)
+	tokens := database.Collection(refreshTokenCollectionName)
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"hash": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.M{"family": 1},
+			Options: nil,
+		},
+		{
+			Keys:    bson.M{"username": 1},
+			Options: nil,
+		},
+		{
+			Keys:    bson.M{"expiresAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+	_, err = tokens.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return nil, err
+	}
+	return &RefreshTokenStore{client: client, database: database, tokens: tokens}, nil
+}
+
+// AddRefreshToken adds a new refresh token to the store
+func (store *RefreshTokenStore) AddRefreshToken(ctx context.Context, token RefreshToken) error {
+	_, err := store.tokens.InsertOne(ctx, token)
+	return err
+}
+
+// UseRefreshToken marks the unexpired token with the hash as used and returns it. A token used before is returned with
+// ErrRefreshTokenReused, an unknown or expired one with mongo.ErrNoDocuments.
+func (store *RefreshTokenStore) UseRefreshToken(ctx context.Context, hash string, now time.Time) (*RefreshToken, error) {
+	filter := bson.M{"hash": hash, "usedAt": nil, "expiresAt": bson.M{"$gt": now}}
+	update := bson.M{"$set": bson.M{"usedAt": now}}
+	var result RefreshToken
+	err := store.tokens.FindOneAndUpdate(ctx, filter, update).Decode(&result)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		if err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+	err = store.tokens.FindOne(ctx, bson.M{"hash": hash, "usedAt": bson.M{"$ne": nil}}).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, ErrRefreshTokenReused
+}
+
+// RevokeRefreshTokenFamily deletes all the tokens of a family
+func (store *RefreshTokenStore) RevokeRefreshTokenFamily(ctx context.Context, family primitive.ObjectID) error {
+	_, err := store.tokens.DeleteMany(ctx, bson.M{"family": family})
+	return err
+}
+
+// RevokeUserRefreshTokens deletes all the tokens of the user
+func (store *RefreshTokenStore) RevokeUserRefreshTokens(ctx context.Context, username string) error {
+	_, err := store.tokens.DeleteMany(ctx, bson.M{"username": username})
+	return err
+}
+
+// FindRefreshToken returns the unexpired token with the hash, used or not
+func (store *RefreshTokenStore) FindRefreshToken(ctx context.Context, hash string, now time.Time) (*RefreshToken, error) {
+	var result RefreshToken
+	err := store.tokens.FindOne(ctx, bson.M{"hash": hash, "expiresAt": bson.M{"$gt": now}}).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const revocationCollectionName = "revocations"
+
+// Revocation revokes either the token with the JTI or all the tokens of the user issued until RevokedAt.
+// It is removed by mongo at ExpiresAt, when the tokens it revokes have expired anyway.
+type Revocation struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	JTI       string             `bson:"jti,omitempty"`
+	Username  string             `bson:"username,omitempty"`
+	RevokedAt time.Time          `bson:"revokedAt"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+}
+
+// RevocationStore represents a store for revoked tokens
+type RevocationStore struct {
+	client      *mongo.Client
+	database    *mongo.Database
+	revocations *mongo.Collection
+}
+
+// NewRevocationStore creates a new revocation store
+func NewRevocationStore(uri, databaseName string) (*RevocationStore, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	err = client.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	database := client.Database(databaseName)
+	revocations := database.Collection(revocationCollectionName)
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"jti": 1},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.M{"username": 1},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.M{"expiresAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+	_, err = revocations.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return nil, err
+	}
+	return &RevocationStore{client: client, database: database, revocations: revocations}, nil
+}
+
+// RevokeToken revokes the token with the JTI until it expires
+func (store *RevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	filter := bson.M{"jti": jti}
+	update := bson.M{
+		"$setOnInsert": bson.M{"revokedAt": time.Now().UTC()},
+		"$max":         bson.M{"expiresAt": expiresAt},
+	}
+	_, err := store.revocations.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// RevokeUser revokes the tokens of the user issued until revokedAt, the revocation is kept until expiresAt
+func (store *RevocationStore) RevokeUser(ctx context.Context, username string, revokedAt, expiresAt time.Time) error {
+	filter := bson.M{"username": username}
+	update := bson.M{
+		"$max": bson.M{"revokedAt": revokedAt, "expiresAt": expiresAt},
+	}
+	_, err := store.revocations.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// FindRevocations returns the revocations that have not expired
+func (store *RevocationStore) FindRevocations(ctx context.Context, now time.Time) ([]Revocation, error) {
+	// Mongo removes expired documents about once a minute
+	cursor, err := store.revocations.Find(ctx, bson.M{"expiresAt": bson.M{"$gt": now}})
+	if err != nil {
+		return nil, err
+	}
+	var result []Revocation
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindRevocation returns the revocations of the token with the JTI or of its user
+func (store *RevocationStore) FindRevocation(ctx context.Context, jti, username string, now time.Time) ([]Revocation, error) {
+	filter := bson.M{
+		"$or":       bson.A{bson.M{"jti": jti}, bson.M{"username": username}},
+		"expiresAt": bson.M{"$gt": now},
+	}
+	cursor, err := store.revocations.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var result []Revocation
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const roleCollectionName = "roles"
+
+// Role is a named set of permissions given to users
+type Role struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Name        string             `bson:"name"`
+	Permissions []string           `bson:"permissions"`
+}
+
+// RoleStore represents a store for roles
+type RoleStore struct {
+	client   *mongo.Client
+	database *mongo.Database
+	roles    *mongo.Collection
+}
+
+// NewRoleStore creates a new role store with the default roles, the ones that already exist are kept as they are
+func NewRoleStore(uri, databaseName string, defaults []Role) (*RoleStore, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	err = client.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	database := client.Database(databaseName)
+	roles := database.Collection(roleCollectionName)
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"name": 1},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	_, err = roles.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range defaults {
+		update := bson.M{"$setOnInsert": bson.M{"permissions": role.Permissions}}
+		_, err = roles.UpdateOne(ctx, bson.M{"name": role.Name}, update, options.Update().SetUpsert(true))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &RoleStore{client: client, database: database, roles: roles}, nil
+}
+
+// FindRoles returns all the roles sorted by name
+func (store *RoleStore) FindRoles(ctx context.Context) ([]Role, error) {
+	cursor, err := store.roles.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var result []Role
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindRole returns the role with the name, mongo.ErrNoDocuments is returned when it does not exist
+func (store *RoleStore) FindRole(ctx context.Context, name string) (*Role, error) {
+	var result Role
+	err := store.roles.FindOne(ctx, bson.M{"name": name}).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetRole creates the role or replaces its permissions
+func (store *RoleStore) SetRole(ctx context.Context, role Role) error {
+	update := bson.M{"$set": bson.M{"permissions": role.Permissions}}
+	_, err := store.roles.UpdateOne(ctx, bson.M{"name": role.Name}, update, options.Update().SetUpsert(true))
+	return err
+}
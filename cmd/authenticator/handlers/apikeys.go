@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/service"
+	"github.com/gorilla/mux"
+)
+
+// APIKeyValidationRequest is the body of the validation of an API key
+type APIKeyValidationRequest struct {
+	Key string `json:"key"`
+}
+
+func (app *Application) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var request service.APIKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	key, err := app.service.CreateAPIKey(*tokenClaims(r), request)
+	if errors.Is(err, db.ErrDuplicateAPIKeyName) {
+		app.jsonErrorReturn(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusCreated, key)
+}
+
+func (app *Application) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.service.APIKeys(tokenClaims(r).Username)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, keys)
+}
+
+func (app *Application) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	err := app.service.RevokeAPIKey(tokenClaims(r).Username, mux.Vars(r)["id"])
+	if errors.Is(err, service.ErrAPIKeyNotFound) {
+		app.jsonErrorReturn(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
+
+// validateAPIKey returns the claims of an API key to the services authenticating requests with it
+func (app *Application) validateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var request APIKeyValidationRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	if request.Key == "" {
+		app.jsonErrorReturn(w, errors.New("key is required"), http.StatusBadRequest)
+		return
+	}
+	claims, err := app.service.ValidateAPIKey(request.Key)
+	if errors.Is(err, service.ErrInvalidAPIKey) {
+		app.jsonErrorReturn(w, err, http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, claims)
+}
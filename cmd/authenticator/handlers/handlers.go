@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/service"
+	"golang.org/x/exp/slices"
 )
 
 // TODO remove dependency from DB having a separate DTO
@@ -16,9 +19,18 @@ func (app *Application) register(w http.ResponseWriter, r *http.Request) {
 		app.jsonErrorReturn(w, err, http.StatusBadRequest)
 		return
 	}
+	// Admins register users in their tenant, super-admins in the tenant of the request
+	if claims := tokenClaims(r); claims.TenantScope() != service.AllTenants {
+		user.Tenant = claims.Tenant
+	}
+	err = app.checkRoleGrant(r, user.Role)
+	if err != nil {
+		app.jsonErrorReturn(w, err, tenantStatus(err, http.StatusInternalServerError))
+		return
+	}
 	err = app.service.Register(user)
 	if err != nil {
-		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
 		return
 	}
 	app.emptyReturn(w, http.StatusCreated)
@@ -31,10 +43,109 @@ func (app *Application) login(w http.ResponseWriter, r *http.Request) {
 		app.jsonErrorReturn(w, err, http.StatusBadRequest)
 		return
 	}
-	token, err := app.service.Login(user)
+	tokens, err := app.service.Login(user)
 	if err != nil {
 		app.jsonErrorReturn(w, err, http.StatusUnauthorized)
 		return
 	}
-	app.jsonReturn(w, http.StatusOK, token)
+	app.jsonReturn(w, http.StatusOK, tokens)
+}
+
+// RefreshRequest is the body of a refresh
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (app *Application) refresh(w http.ResponseWriter, r *http.Request) {
+	var request RefreshRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	if request.RefreshToken == "" {
+		app.jsonErrorReturn(w, errors.New("refreshToken is required"), http.StatusBadRequest)
+		return
+	}
+	tokens, err := app.service.Refresh(request.RefreshToken)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusUnauthorized)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, tokens)
+}
+
+func (app *Application) logout(w http.ResponseWriter, r *http.Request) {
+	var request RefreshRequest
+	// The refresh token is optional
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			app.jsonErrorReturn(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+	err := app.service.Logout(*tokenClaims(r), request.RefreshToken)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
+
+func (app *Application) revokeTokens(w http.ResponseWriter, r *http.Request) {
+	var request service.RevokeRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	// Tokens are revoked by their unguessable jti or by the user, who must be in the tenant of the admin and not be a
+	// super-admin unless the admin is one
+	if request.Username != "" {
+		err = app.checkUserManagement(r, request.Username)
+		if err != nil {
+			app.jsonErrorReturn(w, err, tenantStatus(err, http.StatusInternalServerError))
+			return
+		}
+	}
+	err = app.service.RevokeTokens(request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
+
+// revocations returns the revoked tokens of all the tenants, to the OAuth2 clients with tenant:all such as the one of
+// the sensor service
+func (app *Application) revocations(w http.ResponseWriter, r *http.Request) {
+	client, err := app.service.AuthenticateClient(clientCredentials(r))
+	if errors.Is(err, service.ErrInvalidClient) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		app.jsonErrorReturn(w, err, http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !slices.Contains(client.Scopes, service.PermissionTenantAll) {
+		app.jsonErrorReturn(w, errors.New("the client can't read the revocations of all the tenants"), http.StatusForbidden)
+		return
+	}
+	list, err := app.service.Revocations()
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, list)
+}
+
+func (app *Application) jwks(w http.ResponseWriter, r *http.Request) {
+	app.jsonReturn(w, http.StatusOK, app.service.JWKS())
+}
+
+func (app *Application) openIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	app.jsonReturn(w, http.StatusOK, app.service.OpenIDConfiguration(app.baseURL(r)))
 }
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/service"
+
+	"github.com/stretchr/testify/require"
+)
+
+// clientsService is the part of the service the revocation list reads
+type clientsService struct {
+	service.AuthenticatorService
+	clients map[string]service.Client
+}
+
+func (s clientsService) AuthenticateClient(clientID, secret string) (*service.Client, error) {
+	client, ok := s.clients[clientID]
+	if !ok || secret != "s3cret" {
+		return nil, service.ErrInvalidClient
+	}
+	return &client, nil
+}
+
+func (s clientsService) Revocations() (*service.RevocationList, error) {
+	return &service.RevocationList{Tokens: []string{"jti"}, Users: []service.RevokedUser{}}, nil
+}
+
+func (s clientsService) IsRevoked(claims service.TokenClaims) (bool, error) {
+	return false, nil
+}
+
+func TestIntrospect(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	app := &Application{errorLog: logger, infoLog: logger, service: clientsService{clients: map[string]service.Client{
+		"sensor": {ClientID: "sensor", Scopes: []string{service.PermissionTenantAll}},
+		"acme":   {ClientID: "acme", Tenant: "acme", Scopes: []string{service.PermissionSensorRead}},
+		"other":  {ClientID: "other", Tenant: "other", Scopes: []string{service.PermissionSensorRead}},
+	}}}
+	// The token is the tenant of its user
+	app.ParseToken = func(token string) (*service.TokenClaims, error) {
+		return &service.TokenClaims{Username: "alice", Tenant: token}, nil
+	}
+	introspect := func(clientID, token string) service.Introspection {
+		request := httptest.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.SetBasicAuth(clientID, "s3cret")
+		recorder := httptest.NewRecorder()
+		app.introspect(recorder, request)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var introspection service.Introspection
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&introspection))
+		return introspection
+	}
+
+	// Clients only describe the tokens of their tenant, unless they have tenant:all
+	require.True(t, introspect("acme", "acme").Active)
+	require.Equal(t, service.Introspection{}, introspect("other", "acme"))
+	require.True(t, introspect("sensor", "acme").Active)
+}
+
+func TestRevocations(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	app := &Application{errorLog: logger, infoLog: logger, service: clientsService{clients: map[string]service.Client{
+		"sensor": {ClientID: "sensor", Scopes: []string{service.PermissionTenantAll}},
+		"acme":   {ClientID: "acme", Tenant: "acme", Scopes: []string{service.PermissionSensorRead}},
+	}}}
+	status := func(clientID, secret string) int {
+		request := httptest.NewRequest(http.MethodGet, "/tokens/revoked", nil)
+		if clientID != "" {
+			request.SetBasicAuth(clientID, secret)
+		}
+		recorder := httptest.NewRecorder()
+		app.revocations(recorder, request)
+		return recorder.Code
+	}
+
+	// The revocations of all the tenants are only read by the clients with tenant:all
+	require.Equal(t, http.StatusOK, status("sensor", "s3cret"))
+	require.Equal(t, http.StatusForbidden, status("acme", "s3cret"))
+	require.Equal(t, http.StatusUnauthorized, status("sensor", "wrong"))
+	require.Equal(t, http.StatusUnauthorized, status("", ""))
+}
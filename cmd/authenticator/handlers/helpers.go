@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 // Juca is a structure to return errors in json format
@@ -34,3 +35,23 @@ func (app Application) emptyReturn(w http.ResponseWriter, statusCode int) {
 	w.WriteHeader(statusCode)
 	app.infoLog.Printf("return empty %d", statusCode)
 }
+
+// baseURL returns the URL the authenticator is reached at, from PUBLIC_URL or else from the request and the headers of
+// the proxies in front of it
+func (app Application) baseURL(r *http.Request) string {
+	if app.publicURL != "" {
+		return app.publicURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	return scheme + "://" + host + strings.TrimSuffix(r.Header.Get("X-Forwarded-Prefix"), "/")
+}
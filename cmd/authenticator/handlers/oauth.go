@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/service"
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slices"
+)
+
+// Error codes of the OAuth2 endpoints, see RFC 6749 section 5.2
+const (
+	oauthInvalidRequest       = "invalid_request"
+	oauthInvalidClient        = "invalid_client"
+	oauthInvalidGrant         = "invalid_grant"
+	oauthInvalidScope         = "invalid_scope"
+	oauthUnsupportedGrantType = "unsupported_grant_type"
+	oauthServerError          = "server_error"
+)
+
+// OAuthError is the error returned by the OAuth2 endpoints
+type OAuthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (app Application) oauthErrorReturn(w http.ResponseWriter, httpStatus int, code string, err error) {
+	if code == oauthInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	app.jsonReturn(w, httpStatus, OAuthError{Error: code, Description: err.Error()})
+}
+
+// clientCredentials returns the client id and secret of the HTTP basic authentication, or else of the form
+func clientCredentials(r *http.Request) (string, string) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	// They are form-urlencoded before being encoded in base64, see RFC 6749 section 2.3.1
+	if unescaped, err := url.QueryUnescape(clientID); err == nil {
+		clientID = unescaped
+	}
+	if unescaped, err := url.QueryUnescape(secret); err == nil {
+		secret = unescaped
+	}
+	return clientID, secret
+}
+
+// token is the OAuth2 token endpoint, password and refresh_token grants are the login and the refresh of the users
+func (app *Application) token(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.oauthErrorReturn(w, http.StatusBadRequest, oauthInvalidRequest, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	form := r.PostForm
+	switch form.Get("grant_type") {
+	case service.GrantTypeClientCredentials:
+		clientID, secret := clientCredentials(r)
+		tokens, err := app.service.ClientCredentials(clientID, secret, form.Get("scope"))
+		switch {
+		case errors.Is(err, service.ErrInvalidClient):
+			app.oauthErrorReturn(w, http.StatusUnauthorized, oauthInvalidClient, err)
+		case errors.Is(err, service.ErrInvalidScope):
+			app.oauthErrorReturn(w, http.StatusBadRequest, oauthInvalidScope, err)
+		case err != nil:
+			app.oauthErrorReturn(w, http.StatusInternalServerError, oauthServerError, err)
+		default:
+			app.jsonReturn(w, http.StatusOK, tokens)
+		}
+	case service.GrantTypePassword:
+		if form.Get("username") == "" || form.Get("password") == "" {
+			app.oauthErrorReturn(w, http.StatusBadRequest, oauthInvalidRequest, errors.New("username and password are required"))
+			return
+		}
+		tokens, err := app.service.Login(db.User{Username: form.Get("username"), Password: form.Get("password")})
+		if err != nil {
+			app.oauthErrorReturn(w, http.StatusBadRequest, oauthInvalidGrant, errors.New("invalid username or password"))
+			return
+		}
+		app.jsonReturn(w, http.StatusOK, service.NewOAuthTokens(*tokens))
+	case service.GrantTypeRefreshToken:
+		if form.Get("refresh_token") == "" {
+			app.oauthErrorReturn(w, http.StatusBadRequest, oauthInvalidRequest, errors.New("refresh_token is required"))
+			return
+		}
+		tokens, err := app.service.Refresh(form.Get("refresh_token"))
+		if err != nil {
+			app.oauthErrorReturn(w, http.StatusBadRequest, oauthInvalidGrant, err)
+			return
+		}
+		app.jsonReturn(w, http.StatusOK, service.NewOAuthTokens(*tokens))
+	case "":
+		app.oauthErrorReturn(w, http.StatusBadRequest, oauthInvalidRequest, errors.New("grant_type is required"))
+	default:
+		app.oauthErrorReturn(w, http.StatusBadRequest, oauthUnsupportedGrantType,
+			errors.New("grant_type must be client_credentials, password or refresh_token"))
+	}
+}
+
+// introspect is the token introspection endpoint of RFC 7662, for the registered clients. It describes access tokens
+// and API keys.
+func (app *Application) introspect(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.oauthErrorReturn(w, http.StatusBadRequest, oauthInvalidRequest, err)
+		return
+	}
+	client, err := app.service.AuthenticateClient(clientCredentials(r))
+	if errors.Is(err, service.ErrInvalidClient) {
+		app.oauthErrorReturn(w, http.StatusUnauthorized, oauthInvalidClient, err)
+		return
+	}
+	if err != nil {
+		app.oauthErrorReturn(w, http.StatusInternalServerError, oauthServerError, err)
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		app.oauthErrorReturn(w, http.StatusBadRequest, oauthInvalidRequest, errors.New("token is required"))
+		return
+	}
+	introspection, err := app.introspection(token)
+	if err != nil {
+		app.oauthErrorReturn(w, http.StatusInternalServerError, oauthServerError, err)
+		return
+	}
+	// Clients only describe the tokens of their tenant, unless they operate across the tenants
+	if introspection.Active && !slices.Contains(client.Scopes, service.PermissionTenantAll) &&
+		introspection.Tenant != client.Tenant {
+		introspection = &service.Introspection{}
+	}
+	app.jsonReturn(w, http.StatusOK, introspection)
+}
+
+// introspection describes a token, inactive when it is invalid, expired or revoked, and otherwise an API key
+func (app *Application) introspection(token string) (*service.Introspection, error) {
+	claims, err := app.ParseToken(token)
+	if err == nil {
+		revoked, err := app.service.IsRevoked(*claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return &service.Introspection{}, nil
+		}
+		return &service.Introspection{Active: true, TokenType: service.TokenTypeBearer, TokenClaims: claims}, nil
+	}
+	claims, err = app.service.ValidateAPIKey(token)
+	if errors.Is(err, service.ErrInvalidAPIKey) {
+		return &service.Introspection{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &service.Introspection{Active: true, TokenType: "ApiKey", TokenClaims: claims}, nil
+}
+
+func (app *Application) registerClient(w http.ResponseWriter, r *http.Request) {
+	var request service.ClientRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	// Admins register clients in their tenant, super-admins in the tenant of the request
+	if claims := tokenClaims(r); claims.TenantScope() != service.AllTenants {
+		request.Tenant = claims.Tenant
+	}
+	client, err := app.service.RegisterClient(*tokenClaims(r), request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusCreated, client)
+}
+
+func (app *Application) listClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := app.service.Clients(tokenClaims(r).TenantScope())
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, clients)
+}
+
+func (app *Application) deleteClient(w http.ResponseWriter, r *http.Request) {
+	err := app.service.DeleteClient(tokenClaims(r).TenantScope(), mux.Vars(r)["clientId"])
+	if errors.Is(err, service.ErrClientNotFound) {
+		app.jsonErrorReturn(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/service"
+	"github.com/gorilla/mux"
+)
+
+// Authentication of the routes that require no permission
+const (
+	publicRoute        = ""
+	authenticatedRoute = "authenticated"
+)
+
+// routePolicy is an endpoint with the permission required to call it, publicRoute when it needs no token and
+// authenticatedRoute when any valid token is enough
+type routePolicy struct {
+	method     string
+	path       string
+	handler    http.HandlerFunc
+	permission string
+}
+
+// routePolicies is the table of the endpoints of the authenticator
+func (app *Application) routePolicies() []routePolicy {
+	return []routePolicy{
+		{http.MethodGet, "/.well-known/openid-configuration", app.openIDConfiguration, publicRoute},
+		{http.MethodGet, "/.well-known/jwks.json", app.jwks, publicRoute},
+		{http.MethodPost, "/login", app.login, publicRoute},
+		{http.MethodPost, "/refresh", app.refresh, publicRoute},
+		{http.MethodPost, "/logout", app.logout, authenticatedRoute},
+		{http.MethodPost, "/tokens/revoke", app.revokeTokens, service.PermissionUserAdmin},
+		// The revocation list authenticates the clients of the services themselves
+		{http.MethodGet, "/tokens/revoked", app.revocations, publicRoute},
+		{http.MethodPost, "/register", app.register, service.PermissionUserAdmin},
+		{http.MethodPut, "/me/password", app.changePassword, authenticatedRoute},
+		{http.MethodPost, "/apikeys", app.createAPIKey, authenticatedRoute},
+		{http.MethodGet, "/apikeys", app.listAPIKeys, authenticatedRoute},
+		{http.MethodDelete, "/apikeys/{id}", app.revokeAPIKey, authenticatedRoute},
+		{http.MethodPost, "/apikeys/validate", app.validateAPIKey, publicRoute},
+		// The OAuth2 endpoints authenticate the clients themselves
+		{http.MethodPost, "/oauth/token", app.token, publicRoute},
+		{http.MethodPost, "/oauth/introspect", app.introspect, publicRoute},
+		{http.MethodPost, "/oauth/clients", app.registerClient, service.PermissionUserAdmin},
+		{http.MethodGet, "/oauth/clients", app.listClients, service.PermissionUserAdmin},
+		{http.MethodDelete, "/oauth/clients/{clientId}", app.deleteClient, service.PermissionUserAdmin},
+		{http.MethodGet, "/users", app.listUsers, service.PermissionUserAdmin},
+		{http.MethodGet, "/users/{username}", app.getUser, service.PermissionUserAdmin},
+		{http.MethodDelete, "/users/{username}", app.deleteUser, service.PermissionUserAdmin},
+		{http.MethodPut, "/users/{username}/role", app.updateRole, service.PermissionUserAdmin},
+		{http.MethodPut, "/users/{username}/groups", app.updateGroups, service.PermissionUserAdmin},
+		{http.MethodPost, "/users/{username}/disable", app.disableUser, service.PermissionUserAdmin},
+		{http.MethodPost, "/users/{username}/enable", app.enableUser, service.PermissionUserAdmin},
+		{http.MethodGet, "/roles", app.listRoles, service.PermissionUserAdmin},
+		// The roles are shared by all the tenants
+		{http.MethodPut, "/roles/{name}", app.setRole, service.PermissionTenantAll},
+	}
+}
+
+// authorize wraps the handler of the route with the authentication its permission requires
+func (app *Application) authorize(policy routePolicy) http.HandlerFunc {
+	if policy.permission == publicRoute {
+		return policy.handler
+	}
+	return app.requireAuthentication(policy.handler, policy.permission)
+}
+
+func (app *Application) listRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.service.Roles()
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, roles)
+}
+
+func (app *Application) setRole(w http.ResponseWriter, r *http.Request) {
+	var role service.Role
+	err := json.NewDecoder(r.Body).Decode(&role)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	role.Name = mux.Vars(r)["name"]
+	err = app.service.SetRole(role)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
@@ -1,16 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"crypto"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	jwt "github.com/golang-jwt/jwt/v4"
-	"github.com/mitchellh/mapstructure"
-	"golang.org/x/exp/slices"
 
 	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/service"
 	"github.com/gorilla/mux"
@@ -20,8 +21,9 @@ type Application struct {
 	errorLog   *log.Logger
 	infoLog    *log.Logger
 	service    service.AuthenticatorService
-	jwtPubKey  []byte
-	ParseToken func(token string, pubKey []byte) (*service.TokenClaims, error)
+	ParseToken func(token string) (*service.TokenClaims, error)
+	// publicURL is the URL the authenticator is reached at by clients, when empty it is taken from the requests
+	publicURL string
 }
 
 func (app Application) ErrorLog() *log.Logger {
@@ -37,23 +39,30 @@ func NewApplication(uri, databaseName string) (*Application, error) {
 	if err != nil {
 		return nil, err
 	}
+	validation := service.NewTokenValidationFromEnv()
 	return &Application{
-		errorLog:   errLog,
-		infoLog:    infoLog,
-		service:    srv,
-		jwtPubKey:  []byte(os.Getenv("tls.crt")),
-		ParseToken: ParseJWTToken,
+		errorLog: errLog,
+		infoLog:  infoLog,
+		service:  srv,
+		ParseToken: func(token string) (*service.TokenClaims, error) {
+			return ParseJWTToken(token, srv.VerificationKey, validation)
+		},
+		publicURL: strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/"),
 	}, nil
 
 }
 
-func (app *Application) requireAuthentication(fn http.HandlerFunc, allowedRoles []string) http.HandlerFunc {
+// requireAuthentication calls the handler for valid tokens granting the permission, any valid token for authenticatedRoute
+func (app *Application) requireAuthentication(fn http.HandlerFunc, permission string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		var authToken string
 
 		if strings.HasPrefix(strings.ToLower(authHeader), "token ") {
 			authToken = authHeader[len("token "):]
+		} else if strings.HasPrefix(strings.ToLower(authHeader), "bearer ") {
+			// The tokens of the OAuth2 token endpoint are bearer tokens
+			authToken = authHeader[len("bearer "):]
 		} else {
 			query := r.URL.Query()
 			authToken = query.Get("token")
@@ -63,42 +72,61 @@ func (app *Application) requireAuthentication(fn http.HandlerFunc, allowedRoles
 			app.jsonErrorReturn(w, errors.New("Token is required"), http.StatusUnauthorized)
 			return
 		}
-		claims, err := app.ParseToken(authToken, app.jwtPubKey)
+		claims, err := app.ParseToken(authToken)
 		if err != nil {
 			app.jsonErrorReturn(w, errors.New("Token is invalid"), http.StatusBadRequest)
 			return
 		}
-		if len(allowedRoles) > 0 && !slices.Contains(allowedRoles, claims.Role) {
+		revoked, err := app.service.IsRevoked(*claims)
+		if err != nil {
+			app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+			return
+		}
+		if revoked {
+			app.jsonErrorReturn(w, errors.New("Token was revoked"), http.StatusUnauthorized)
+			return
+		}
+		if permission != authenticatedRoute && !claims.HasPermission(permission) {
 			app.jsonErrorReturn(w, errors.New("This user can't perform this function"), http.StatusForbidden)
 			return
 		}
-		fn(w, r)
+		fn(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
 	}
 }
 
-func ParseJWTToken(token string, pubKey []byte) (*service.TokenClaims, error) {
-	jwtToken, err := jwt.Parse(token, func(tk *jwt.Token) (interface{}, error) {
-		a, err := jwt.ParseRSAPublicKeyFromPEM(pubKey)
-		return a, err
+// claimsKey is the context key of the claims of the authenticated token
+type claimsKey struct{}
+
+// tokenClaims returns the claims of the token authenticated by requireAuthentication
+func tokenClaims(r *http.Request) *service.TokenClaims {
+	claims, _ := r.Context().Value(claimsKey{}).(*service.TokenClaims)
+	return claims
+}
+
+// ParseJWTToken parses a token signed with the key of its kid and checks its expiry, issuer and audience
+func ParseJWTToken(token string, verificationKey func(kid string) (crypto.PublicKey, error), validation service.TokenValidation) (*service.TokenClaims, error) {
+	var tokenClaims service.TokenClaims
+	// The claims are validated below with the clock skew
+	parser := jwt.NewParser(jwt.WithValidMethods(service.SigningAlgorithms), jwt.WithoutClaimsValidation())
+	_, err := parser.ParseWithClaims(token, &tokenClaims, func(tk *jwt.Token) (interface{}, error) {
+		kid, _ := tk.Header["kid"].(string)
+		return verificationKey(kid)
 	})
 	if err != nil {
 		return nil, err
 	}
-	if jwtToken.Valid {
-		var tokenClaims *service.TokenClaims
-		err = mapstructure.Decode(jwtToken.Claims, &tokenClaims)
-		if err != nil {
-			return nil, fmt.Errorf("could not parse token claims: %v", err)
-		}
-		return tokenClaims, nil
+	err = validation.Validate(tokenClaims, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("could not validate token claims: %v", err)
 	}
-	return nil, errors.New("token has expired")
+	return &tokenClaims, nil
 }
 
 func (app *Application) Routes() *mux.Router {
 	// Register handler functions.
 	r := mux.NewRouter()
-	r.HandleFunc("/login", app.login).Methods(http.MethodPost)
-	r.HandleFunc("/register", app.requireAuthentication(app.register, []string{"ADMIN"})).Methods(http.MethodPost)
+	for _, policy := range app.routePolicies() {
+		r.HandleFunc(policy.path, app.authorize(policy)).Methods(policy.method)
+	}
 	return r
 }
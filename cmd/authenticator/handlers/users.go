@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/service"
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slices"
+)
+
+// errCrossTenantRole is returned when an admin of a tenant grants a role operating across the tenants
+var errCrossTenantRole = errors.New("Only a super-admin can grant a role with " + service.PermissionTenantAll)
+
+// errSuperAdminUser is returned when an admin of a tenant manages a user whose role operates across the tenants
+var errSuperAdminUser = errors.New("Only a super-admin can manage a user with " + service.PermissionTenantAll)
+
+// RoleRequest is the body of a role change
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+// GroupsRequest is the body of a change of the groups of a user
+type GroupsRequest struct {
+	Groups []string `json:"groups"`
+}
+
+// notFoundStatus returns 404 for missing users and status for the other errors
+func notFoundStatus(err error, status int) int {
+	if errors.Is(err, service.ErrUserNotFound) {
+		return http.StatusNotFound
+	}
+	return status
+}
+
+// checkUserTenant returns ErrUserNotFound when the user is not in the tenant of the token, unless the token operates
+// across the tenants. The users of the other tenants are reported missing so that their usernames are not disclosed.
+func (app *Application) checkUserTenant(r *http.Request, username string) error {
+	claims := tokenClaims(r)
+	if claims.TenantScope() == service.AllTenants {
+		return nil
+	}
+	user, err := app.service.User(username)
+	if err != nil {
+		return err
+	}
+	if user.Tenant != claims.Tenant {
+		return service.ErrUserNotFound
+	}
+	return nil
+}
+
+// checkUserManagement returns the errors of checkUserTenant, and errSuperAdminUser when the role of the user operates
+// across the tenants and the token doesn't, so that the admins of the default tenant can't demote, disable, delete or
+// revoke the super-admins such as root
+func (app *Application) checkUserManagement(r *http.Request, username string) error {
+	err := app.checkUserTenant(r, username)
+	if err != nil || tokenClaims(r).HasPermission(service.PermissionTenantAll) {
+		return err
+	}
+	user, err := app.service.User(username)
+	if err != nil {
+		return err
+	}
+	crossTenant, err := app.isCrossTenantRole(user.Role)
+	if err != nil {
+		return err
+	}
+	if crossTenant {
+		return errSuperAdminUser
+	}
+	return nil
+}
+
+// checkRoleGrant returns errCrossTenantRole when the role has tenant:all and the token doesn't
+func (app *Application) checkRoleGrant(r *http.Request, name string) error {
+	if tokenClaims(r).HasPermission(service.PermissionTenantAll) {
+		return nil
+	}
+	crossTenant, err := app.isCrossTenantRole(name)
+	if err != nil {
+		return err
+	}
+	if crossTenant {
+		return errCrossTenantRole
+	}
+	return nil
+}
+
+// isCrossTenantRole tells whether the role has tenant:all, unknown roles don't
+func (app *Application) isCrossTenantRole(name string) (bool, error) {
+	role, err := app.service.Role(name)
+	if errors.Is(err, service.ErrRoleNotFound) {
+		// Unknown roles are rejected by the service
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(role.Permissions, service.PermissionTenantAll), nil
+}
+
+// tenantStatus returns 403 for the grants of cross tenant roles and the management of super-admins, and notFoundStatus
+// for the other errors
+func tenantStatus(err error, status int) int {
+	if errors.Is(err, errCrossTenantRole) || errors.Is(err, errSuperAdminUser) {
+		return http.StatusForbidden
+	}
+	return notFoundStatus(err, status)
+}
+
+func (app *Application) listUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := db.UserFilter{Search: query.Get("search"), Role: query.Get("role")}
+	// Admins list the users of their tenant, super-admins the ones of any tenant
+	if claims := tokenClaims(r); claims.TenantScope() != service.AllTenants {
+		filter.Tenant = &claims.Tenant
+	} else if query.Has("tenant") {
+		tenant := query.Get("tenant")
+		filter.Tenant = &tenant
+	}
+	if value := query.Get("disabled"); value != "" {
+		disabled, err := strconv.ParseBool(value)
+		if err != nil {
+			app.jsonErrorReturn(w, errors.New("disabled must be true or false"), http.StatusBadRequest)
+			return
+		}
+		filter.Disabled = &disabled
+	}
+	users, err := app.service.Users(filter)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, users)
+}
+
+func (app *Application) getUser(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	err := app.checkUserTenant(r, username)
+	if err != nil {
+		app.jsonErrorReturn(w, err, notFoundStatus(err, http.StatusInternalServerError))
+		return
+	}
+	user, err := app.service.User(username)
+	if err != nil {
+		app.jsonErrorReturn(w, err, notFoundStatus(err, http.StatusInternalServerError))
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, user)
+}
+
+func (app *Application) updateRole(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	var request RoleRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	// An ADMIN demoting itself could leave no ADMIN
+	if username == tokenClaims(r).Username {
+		app.jsonErrorReturn(w, errors.New("You can't change your own role"), http.StatusBadRequest)
+		return
+	}
+	err = app.checkUserManagement(r, username)
+	if err == nil {
+		err = app.checkRoleGrant(r, request.Role)
+	}
+	if err != nil {
+		app.jsonErrorReturn(w, err, tenantStatus(err, http.StatusInternalServerError))
+		return
+	}
+	err = app.service.UpdateRole(username, request.Role)
+	if err != nil {
+		app.jsonErrorReturn(w, err, notFoundStatus(err, http.StatusBadRequest))
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
+
+func (app *Application) updateGroups(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	var request GroupsRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	err = app.checkUserManagement(r, username)
+	if err != nil {
+		app.jsonErrorReturn(w, err, tenantStatus(err, http.StatusInternalServerError))
+		return
+	}
+	err = app.service.SetGroups(username, request.Groups)
+	if err != nil {
+		app.jsonErrorReturn(w, err, notFoundStatus(err, http.StatusBadRequest))
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
+
+func (app *Application) disableUser(w http.ResponseWriter, r *http.Request) {
+	app.setDisabled(w, r, true)
+}
+
+func (app *Application) enableUser(w http.ResponseWriter, r *http.Request) {
+	app.setDisabled(w, r, false)
+}
+
+func (app *Application) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	username := mux.Vars(r)["username"]
+	if username == tokenClaims(r).Username {
+		app.jsonErrorReturn(w, errors.New("You can't disable or enable your own user"), http.StatusBadRequest)
+		return
+	}
+	err := app.checkUserManagement(r, username)
+	if err != nil {
+		app.jsonErrorReturn(w, err, tenantStatus(err, http.StatusInternalServerError))
+		return
+	}
+	err = app.service.SetDisabled(username, disabled)
+	if err != nil {
+		app.jsonErrorReturn(w, err, notFoundStatus(err, http.StatusInternalServerError))
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
+
+func (app *Application) deleteUser(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == tokenClaims(r).Username {
+		app.jsonErrorReturn(w, errors.New("You can't delete your own user"), http.StatusBadRequest)
+		return
+	}
+	err := app.checkUserManagement(r, username)
+	if err != nil {
+		app.jsonErrorReturn(w, err, tenantStatus(err, http.StatusInternalServerError))
+		return
+	}
+	err = app.service.DeleteUser(username)
+	if err != nil {
+		app.jsonErrorReturn(w, err, notFoundStatus(err, http.StatusInternalServerError))
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
+
+func (app *Application) changePassword(w http.ResponseWriter, r *http.Request) {
+	var change service.PasswordChange
+	err := json.NewDecoder(r.Body).Decode(&change)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	err = app.service.ChangePassword(tokenClaims(r).Username, change)
+	if err != nil {
+		app.jsonErrorReturn(w, err, notFoundStatus(err, http.StatusBadRequest))
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/service"
+
+	"github.com/stretchr/testify/require"
+)
+
+// usersService is the part of the service the tenant checks read
+type usersService struct {
+	service.AuthenticatorService
+	users map[string]service.User
+}
+
+func (s usersService) User(username string) (*service.User, error) {
+	user, ok := s.users[username]
+	if !ok {
+		return nil, service.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (s usersService) Role(name string) (*service.Role, error) {
+	for _, role := range service.DefaultRoles {
+		if role.Name == name {
+			return &role, nil
+		}
+	}
+	return nil, service.ErrRoleNotFound
+}
+
+func TestCheckUserManagement(t *testing.T) {
+	app := &Application{service: usersService{users: map[string]service.User{
+		"root":  {Username: "root", Role: "SUPERADMIN"},
+		"alice": {Username: "alice", Role: "READER"},
+		"carol": {Username: "carol", Role: "READER", Tenant: "acme"},
+	}}}
+	check := func(claims service.TokenClaims, username string) error {
+		request := httptest.NewRequest(http.MethodDelete, "/", nil)
+		request = request.WithContext(context.WithValue(request.Context(), claimsKey{}, &claims))
+		return app.checkUserManagement(request, username)
+	}
+	admin := service.TokenClaims{Username: "admin", Role: "ADMIN", Scope: "user:admin"}
+	superAdmin := service.TokenClaims{Username: "other", Role: "SUPERADMIN", Scope: "user:admin tenant:all"}
+
+	require.NoError(t, check(admin, "alice"))
+	require.ErrorIs(t, check(admin, "carol"), service.ErrUserNotFound)
+	// The admins of the default tenant can't manage root
+	require.ErrorIs(t, check(admin, "root"), errSuperAdminUser)
+	require.NoError(t, check(superAdmin, "root"))
+	require.NoError(t, check(superAdmin, "carol"))
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/exp/slices"
+)
+
+// apiKeyPrefix tells API keys apart from the other secrets, such as in leaked credentials scans
+const apiKeyPrefix = "smk_"
+
+// ErrInvalidAPIKey is returned when an API key is unknown, expired or its user disabled
+var ErrInvalidAPIKey = errors.New("API key is invalid")
+
+// ErrAPIKeyNotFound is returned when a user has no API key with an id
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// APIKeyRequest represents the DTO creating an API key
+type APIKeyRequest struct {
+	Name string `json:"name"`
+	// Scopes are the permissions of the key among those of the token creating it, all of them when empty
+	Scopes []string `json:"scopes"`
+	// ExpiresAt is when the key expires, it never expires when not set
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// APIKey represents the DTO of an API key, its value is only returned when it is created
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Username   string     `json:"username"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func newAPIKey(key db.APIKey) APIKey {
+	return APIKey{
+		ID:         key.ID.Hex(),
+		Name:       key.Name,
+		Username:   key.Username,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
+
+// requestedScopes returns the requested scopes, or all the granted ones when none is requested. API keys and clients
+// can't have permissions beyond those of the token creating them.
+func requestedScopes(requested, granted []string) ([]string, error) {
+	if len(requested) == 0 {
+		return granted, nil
+	}
+	for _, scope := range requested {
+		if !slices.Contains(granted, scope) {
+			return nil, fmt.Errorf("scope %s is not granted to the token", scope)
+		}
+	}
+	return requested, nil
+}
+
+// CreateAPIKey creates an API key of the user of the token. The key is only returned here, it is stored by its hash.
+func (as authenticatorService) CreateAPIKey(claims TokenClaims, request APIKeyRequest) (*APIKey, error) {
+	now := time.Now()
+	if strings.TrimSpace(request.Name) == "" {
+		return nil, errors.New("name is required")
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(now) {
+		return nil, errors.New("expiresAt must be in the future")
+	}
+	scopes, err := requestedScopes(request.Scopes, claims.Permissions())
+	if err != nil {
+		return nil, err
+	}
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	value := apiKeyPrefix + token
+	stored, err := as.apiKeys.AddAPIKey(context.Background(), db.APIKey{
+		Hash:      hashToken(value),
+		Name:      request.Name,
+		Username:  claims.Username,
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: request.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := newAPIKey(*stored)
+	result.Key = value
+	return &result, nil
+}
+
+// APIKeys returns the API keys of the user, without their values
+func (as authenticatorService) APIKeys(username string) ([]APIKey, error) {
+	keys, err := as.apiKeys.FindAPIKeys(context.Background(), username, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]APIKey, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, newAPIKey(key))
+	}
+	return result, nil
+}
+
+// RevokeAPIKey removes the API key of the user. Its id is also revoked as a jti, so that the services caching the key
+// reject it from their next refresh of the revocation list.
+func (as authenticatorService) RevokeAPIKey(username, id string) error {
+	ctx := context.Background()
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrAPIKeyNotFound
+	}
+	err = as.apiKeys.DeleteAPIKey(ctx, username, oid)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return as.revocations.RevokeToken(ctx, id, time.Now().Add(as.config.AccessTokenTTL+as.config.ClockSkew))
+}
+
+// ValidateAPIKey returns the claims an API key authenticates with. The scope of the key is limited by the current
+// permissions of the role of its user, and the id of the key is the jti of the claims.
+func (as authenticatorService) ValidateAPIKey(key string) (*TokenClaims, error) {
+	ctx := context.Background()
+	now := time.Now()
+	stored, err := as.apiKeys.UseAPIKey(ctx, hashToken(key), now)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := as.userStore.FindByUserName(ctx, stored.Username)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrInvalidAPIKey
+	}
+	granted, err := as.scope(ctx, user.Role)
+	if errors.Is(err, ErrRoleNotFound) || errors.Is(err, ErrRoleWithoutPermissions) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	scopes := make([]string, 0, len(stored.Scopes))
+	for _, scope := range stored.Scopes {
+		if slices.Contains(strings.Fields(granted), scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	// An empty scope would fall back to the permissions of the role
+	if len(scopes) == 0 {
+		return nil, ErrInvalidAPIKey
+	}
+	claims := &TokenClaims{
+		Username: user.Username,
+		Role:     user.Role,
+		Scope:    strings.Join(scopes, " "),
+		Tenant:   user.Tenant,
+		Groups:   user.Groups,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       stored.ID.Hex(),
+			Issuer:   as.config.Issuer,
+			Subject:  user.Username,
+			Audience: jwt.ClaimStrings{as.config.Audience},
+			IssuedAt: jwt.NewNumericDate(now),
+		},
+	}
+	if stored.ExpiresAt != nil {
+		claims.ExpiresAt = jwt.NewNumericDate(*stored.ExpiresAt)
+	}
+	return claims, nil
+}
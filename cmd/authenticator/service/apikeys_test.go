@@ -0,0 +1,91 @@
+package service
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRequestedScopes(t *testing.T) {
+	granted := []string{PermissionSensorRead, PermissionSensorWrite}
+	scopes, err := requestedScopes(nil, granted)
+	require.NoError(t, err)
+	require.Equal(t, granted, scopes)
+	scopes, err = requestedScopes([]string{PermissionSensorRead}, granted)
+	require.NoError(t, err)
+	require.Equal(t, []string{PermissionSensorRead}, scopes)
+	_, err = requestedScopes([]string{PermissionUserAdmin}, granted)
+	require.Error(t, err)
+}
+
+func TestAPIKeys(t *testing.T) {
+	require.NoError(t, os.Setenv("tls.key", string(newTestKeyPEM(t))))
+	service, err := NewAuthenticatorService("mongodb://localhost:27017", "users"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	require.NoError(t, service.Register(db.User{Username: "ingest", Password: "secret", Role: "EDITOR", Tenant: "acme"}))
+	claims := TokenClaims{Username: "ingest", Role: "EDITOR", Scope: "sensor:read sensor:write"}
+
+	_, err = service.CreateAPIKey(claims, APIKeyRequest{Name: "admin", Scopes: []string{PermissionUserAdmin}})
+	require.Error(t, err)
+	past := time.Now().Add(-time.Hour)
+	_, err = service.CreateAPIKey(claims, APIKeyRequest{Name: "expired", ExpiresAt: &past})
+	require.Error(t, err)
+
+	// The key is returned once and authenticates as its user with its scopes
+	created, err := service.CreateAPIKey(claims, APIKeyRequest{Name: "gateway", Scopes: []string{PermissionSensorWrite}})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(created.Key, apiKeyPrefix))
+	_, err = service.CreateAPIKey(claims, APIKeyRequest{Name: "gateway"})
+	require.ErrorIs(t, err, db.ErrDuplicateAPIKeyName)
+	keys, err := service.APIKeys("ingest")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Empty(t, keys[0].Key)
+
+	validated, err := service.ValidateAPIKey(created.Key)
+	require.NoError(t, err)
+	require.Equal(t, "ingest", validated.Username)
+	require.Equal(t, "acme", validated.Tenant)
+	require.Equal(t, PermissionSensorWrite, validated.Scope)
+	require.Equal(t, created.ID, validated.ID)
+	_, err = service.ValidateAPIKey("unknown")
+	require.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	// The scopes removed from the role of the user are removed from the key
+	require.NoError(t, service.UpdateRole("ingest", "READER"))
+	_, err = service.ValidateAPIKey(created.Key)
+	require.ErrorIs(t, err, ErrInvalidAPIKey)
+	require.NoError(t, service.UpdateRole("ingest", "EDITOR"))
+
+	// Revoking the key revokes its id for the services that cached it
+	require.ErrorIs(t, service.RevokeAPIKey("other", created.ID), ErrAPIKeyNotFound)
+	require.NoError(t, service.RevokeAPIKey("ingest", created.ID))
+	_, err = service.ValidateAPIKey(created.Key)
+	require.ErrorIs(t, err, ErrInvalidAPIKey)
+	revoked, err := service.IsRevoked(TokenClaims{RegisteredClaims: jwt.RegisteredClaims{ID: created.ID}})
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	// The keys of a disabled user are rejected until it is enabled again
+	created, err = service.CreateAPIKey(claims, APIKeyRequest{Name: "gateway"})
+	require.NoError(t, err)
+	require.NoError(t, service.SetDisabled("ingest", true))
+	_, err = service.ValidateAPIKey(created.Key)
+	require.ErrorIs(t, err, ErrInvalidAPIKey)
+	require.NoError(t, service.SetDisabled("ingest", false))
+	_, err = service.ValidateAPIKey(created.Key)
+	require.NoError(t, err)
+
+	// Deleting the user removes its keys
+	require.NoError(t, service.DeleteUser("ingest"))
+	keys, err = service.APIKeys("ingest")
+	require.NoError(t, err)
+	require.Empty(t, keys)
+}
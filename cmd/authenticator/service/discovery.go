@@ -0,0 +1,31 @@
+package service
+
+// OpenIDConfiguration represents the DTO of the OpenID Connect discovery document
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// OpenIDConfiguration returns the discovery document of the authenticator published at baseURL
+func (as authenticatorService) OpenIDConfiguration(baseURL string) OpenIDConfiguration {
+	return OpenIDConfiguration{
+		Issuer:                            as.config.Issuer,
+		JWKSURI:                           baseURL + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"token"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  as.keys.algorithms(),
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "jti", "username", "role", "client_id"},
+		TokenEndpoint:                     baseURL + "/oauth/token",
+		IntrospectionEndpoint:             baseURL + "/oauth/introspect",
+		GrantTypesSupported:               []string{GrantTypeClientCredentials, GrantTypePassword, GrantTypeRefreshToken},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+	}
+}
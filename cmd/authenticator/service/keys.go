@@ -0,0 +1,401 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	rotatedKeyBits = 2048
+	// keyRingRefresh is how often the keys are reloaded, so that all the instances sign with the newest one
+	keyRingRefresh = time.Minute
+	// keyEncryptionKeySize is the size of the AES-256 key the rotated keys are encrypted with
+	keyEncryptionKeySize = 32
+	// sealedKeyType is the PEM type of the PKCS #8 keys encrypted with AES-GCM
+	sealedKeyType = "SEALED PRIVATE KEY"
+)
+
+// SigningAlgorithms are the algorithms tokens can be signed with
+var SigningAlgorithms = []string{KeyTypeRS256, KeyTypeES256, KeyTypeEdDSA}
+
+// ErrUnknownKey is returned when a token is signed with a key that is not, or no longer, published
+var ErrUnknownKey = errors.New("token is signed with an unknown key")
+
+// Key types of the rotated signing keys, named by the algorithm they sign with
+const (
+	KeyTypeRS256 = "RS256"
+	KeyTypeES256 = "ES256"
+	KeyTypeEdDSA = "EdDSA"
+)
+
+// JSONWebKey represents the DTO of a public key of a JWKS, see RFC 7517 and RFC 8037
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet represents the DTO of the public keys tokens are verified with
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// signingKey is a private key identified by the kid tokens are signed with
+type signingKey struct {
+	kid    string
+	key    crypto.Signer
+	method jwt.SigningMethod
+	public JSONWebKey
+}
+
+// newSigningKey returns the key with the signing method of its type: RS256 for RSA, ES256 for ECDSA P-256 and EdDSA for
+// Ed25519 keys
+func newSigningKey(key crypto.PrivateKey) (signingKey, error) {
+	var signing signingKey
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signing = signingKey{key: key, method: jwt.SigningMethodRS256, public: JSONWebKey{
+			Kty: "RSA",
+			N:   encodeInt(key.N),
+			E:   encodeInt(big.NewInt(int64(key.E))),
+		}}
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return signingKey{}, errors.New("only P-256 ECDSA keys are supported")
+		}
+		// The coordinates have the size of the curve, see RFC 7518
+		x, y := make([]byte, 32), make([]byte, 32)
+		signing = signingKey{key: key, method: jwt.SigningMethodES256, public: JSONWebKey{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(x)),
+			Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(y)),
+		}}
+	case ed25519.PrivateKey:
+		signing = signingKey{key: key, method: jwt.SigningMethodEdDSA, public: JSONWebKey{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		}}
+	default:
+		return signingKey{}, fmt.Errorf("unsupported key type %T", key)
+	}
+	signing.kid = thumbprint(signing.public)
+	signing.public.Kid = signing.kid
+	signing.public.Use = "sig"
+	signing.public.Alg = signing.method.Alg()
+	return signing, nil
+}
+
+// thumbprint returns the RFC 7638 thumbprint of the key, used as its kid
+func thumbprint(key JSONWebKey) string {
+	// The members are the required ones of the key type in lexicographic order, which is the order of the fields
+	var members interface{}
+	switch key.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{key.E, key.Kty, key.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{key.Crv, key.Kty, key.X, key.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{key.Crv, key.Kty, key.X}
+	}
+	value, _ := json.Marshal(members)
+	sum := sha256.Sum256(value)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func encodeInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+// parsePrivateKey parses a PEM private key in PKCS #8, or in PKCS #1 for RSA and SEC 1 for ECDSA
+func parsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("the key must be PEM encoded")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("the key must be an RSA, ECDSA P-256 or Ed25519 private key")
+}
+
+// sealKey encrypts the PKCS #8 key with AES-GCM, authenticating its kid so that it can't be moved to another key.
+// The nonce precedes the ciphertext in the PEM block.
+func sealKey(encryptionKey []byte, kid string, der []byte) (string, error) {
+	aead, err := newKeyCipher(encryptionKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(der)+aead.Overhead())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, der, []byte(kid))
+	return string(pem.EncodeToMemory(&pem.Block{Type: sealedKeyType, Bytes: sealed})), nil
+}
+
+// openKey returns the stored private key, decrypting it when it is sealed. Keys stored before they were encrypted are
+// plain PEM.
+func openKey(encryptionKey []byte, stored db.SigningKey) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(stored.PrivateKey))
+	if block == nil || block.Type != sealedKeyType {
+		return parsePrivateKey([]byte(stored.PrivateKey))
+	}
+	aead, err := newKeyCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(block.Bytes) < aead.NonceSize() {
+		return nil, errors.New("the sealed key is truncated")
+	}
+	nonce, sealed := block.Bytes[:aead.NonceSize()], block.Bytes[aead.NonceSize():]
+	der, err := aead.Open(nil, nonce, sealed, []byte(stored.Kid))
+	if err != nil {
+		return nil, errors.New("the key can't be decrypted with SIGNING_KEY_ENCRYPTION_KEY")
+	}
+	return x509.ParsePKCS8PrivateKey(der)
+}
+
+func newKeyCipher(encryptionKey []byte) (cipher.AEAD, error) {
+	if len(encryptionKey) != keyEncryptionKeySize {
+		return nil, errors.New("SIGNING_KEY_ENCRYPTION_KEY is required to encrypt the signing keys")
+	}
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// generateKey generates a new private key of the type
+func generateKey(keyType string) (crypto.PrivateKey, error) {
+	switch keyType {
+	case KeyTypeRS256:
+		return rsa.GenerateKey(rand.Reader, rotatedKeyBits)
+	case KeyTypeES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unsupported key type %s", keyType)
+}
+
+// keyRing holds the keys tokens are signed with. Only the newest one signs, the others are kept to verify the tokens
+// they signed until they expire.
+type keyRing struct {
+	store *db.SigningKeyStore
+	// static is the key of tls.key, it signs when the keys are not rotated
+	static   *signingKey
+	rotation time.Duration
+	keyType  string
+	// overlap is how long a key is published after the next one replaced it
+	overlap time.Duration
+	// encryptionKey encrypts the keys stored in mongo
+	encryptionKey []byte
+
+	mu   sync.RWMutex
+	keys []signingKey
+}
+
+// newKeyRing loads the signing keys. The keys are rotated when config.KeyRotation is set, tls.key is then only used to
+// verify the tokens signed before the rotation was enabled.
+func newKeyRing(store *db.SigningKeyStore, staticPEM []byte, config TokenConfig) (*keyRing, error) {
+	ring := &keyRing{
+		store:         store,
+		rotation:      config.KeyRotation,
+		keyType:       config.KeyType,
+		overlap:       config.KeyOverlap,
+		encryptionKey: config.KeyEncryptionKey,
+	}
+	if len(staticPEM) > 0 {
+		key, err := parsePrivateKey(staticPEM)
+		if err == nil {
+			var static signingKey
+			static, err = newSigningKey(key)
+			ring.static = &static
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls.key: %v", err)
+		}
+	}
+	if ring.rotation == 0 {
+		if ring.static == nil {
+			return nil, errors.New("tls.key is required when SIGNING_KEY_ROTATION is not set")
+		}
+		ring.keys = []signingKey{*ring.static}
+		return ring, nil
+	}
+	err := ring.rotate(context.Background(), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	go ring.run()
+	return ring, nil
+}
+
+// rotate adds a new key when the newest one is older than the rotation, then reloads the keys
+func (r *keyRing) rotate(ctx context.Context, now time.Time) error {
+	stored, err := r.store.FindSigningKeys(ctx, now)
+	if err != nil {
+		return err
+	}
+	if len(stored) == 0 || !stored[0].CreatedAt.Add(r.rotation).After(now) {
+		key, err := generateKey(r.keyType)
+		if err != nil {
+			return err
+		}
+		signing, err := newSigningKey(key)
+		if err != nil {
+			return err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return err
+		}
+		sealed, err := sealKey(r.encryptionKey, signing.kid, der)
+		if err != nil {
+			return err
+		}
+		newKey := db.SigningKey{
+			Kid:        signing.kid,
+			PrivateKey: sealed,
+			CreatedAt:  now,
+			// Signs during the rotation, then verifies during the overlap
+			ExpiresAt: now.Add(r.rotation + r.overlap),
+		}
+		err = r.store.AddSigningKey(ctx, newKey)
+		if err != nil {
+			return err
+		}
+		stored = append([]db.SigningKey{newKey}, stored...)
+	}
+	keys := make([]signingKey, 0, len(stored)+1)
+	for _, s := range stored {
+		key, err := openKey(r.encryptionKey, s)
+		if err != nil {
+			return fmt.Errorf("invalid signing key %s: %v", s.Kid, err)
+		}
+		signing, err := newSigningKey(key)
+		if err != nil {
+			return fmt.Errorf("invalid signing key %s: %v", s.Kid, err)
+		}
+		keys = append(keys, signing)
+	}
+	if r.static != nil {
+		keys = append(keys, *r.static)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = keys
+	return nil
+}
+
+func (r *keyRing) run() {
+	ticker := time.NewTicker(keyRingRefresh)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := r.rotate(context.Background(), time.Now())
+		if err != nil {
+			log.Printf("could not rotate the signing keys: %s", err.Error())
+		}
+	}
+}
+
+// sign signs the claims with the newest key, setting its kid in the header
+func (r *keyRing) sign(claims TokenClaims) (string, error) {
+	r.mu.RLock()
+	key := r.keys[0]
+	r.mu.RUnlock()
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.key)
+}
+
+// publicKeys returns the public keys of all the keys, the signing one first
+func (r *keyRing) publicKeys() JSONWebKeySet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(r.keys))}
+	for _, key := range r.keys {
+		set.Keys = append(set.Keys, key.public)
+	}
+	return set
+}
+
+// algorithms returns the signing algorithms of the keys
+func (r *keyRing) algorithms() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var algorithms []string
+	for _, key := range r.keys {
+		if !slices.Contains(algorithms, key.method.Alg()) {
+			algorithms = append(algorithms, key.method.Alg())
+		}
+	}
+	return algorithms
+}
+
+// verificationKey returns the public key with the kid. Tokens issued before keys had a kid are verified with tls.key.
+func (r *keyRing) verificationKey(kid string) (crypto.PublicKey, error) {
+	if kid == "" && r.static != nil {
+		return r.static.key.Public(), nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, key := range r.keys {
+		if key.kid == kid {
+			return key.key.Public(), nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
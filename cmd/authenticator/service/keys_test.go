@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestKeyPEM(t *testing.T) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// parseWithRing parses a token with the key of its kid in the ring
+func parseWithRing(ring *keyRing, token string) (*jwt.Token, error) {
+	return jwt.NewParser(jwt.WithoutClaimsValidation()).ParseWithClaims(token, &TokenClaims{}, func(tk *jwt.Token) (interface{}, error) {
+		kid, _ := tk.Header["kid"].(string)
+		return ring.verificationKey(kid)
+	})
+}
+
+func TestStaticKeyRing(t *testing.T) {
+	_, err := newKeyRing(nil, nil, TokenConfig{})
+	require.Error(t, err)
+	ring, err := newKeyRing(nil, newTestKeyPEM(t), TokenConfig{})
+	require.NoError(t, err)
+	token, err := ring.sign(TokenClaims{Username: "root"})
+	require.NoError(t, err)
+	parsed, err := parseWithRing(ring, token)
+	require.NoError(t, err)
+	require.Equal(t, ring.static.kid, parsed.Header["kid"])
+
+	set := ring.publicKeys()
+	require.Len(t, set.Keys, 1)
+	require.Equal(t, JSONWebKey{Kty: "RSA", Use: "sig", Alg: "RS256", Kid: ring.static.kid, N: set.Keys[0].N, E: "AQAB"}, set.Keys[0])
+	// Tokens issued before keys had a kid are verified with tls.key
+	_, err = ring.verificationKey("")
+	require.NoError(t, err)
+	_, err = ring.verificationKey("unknown")
+	require.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestKeyRotation(t *testing.T) {
+	store, err := db.NewSigningKeyStore("mongodb://localhost:27017", "keys"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	staticRing, err := newKeyRing(nil, newTestKeyPEM(t), TokenConfig{})
+	require.NoError(t, err)
+	ring := &keyRing{store: store, static: staticRing.static, rotation: time.Hour, keyType: KeyTypeRS256,
+		overlap: 20 * time.Minute, encryptionKey: make([]byte, keyEncryptionKeySize)}
+	now := time.Now().UTC()
+	require.NoError(t, ring.rotate(context.Background(), now))
+	// The rotated key signs and tls.key only verifies
+	require.Len(t, ring.publicKeys().Keys, 2)
+	first, err := ring.sign(TokenClaims{Username: "root"})
+	require.NoError(t, err)
+	firstKid := ring.keys[0].kid
+	require.NotEqual(t, ring.static.kid, firstKid)
+	// The stored key is encrypted
+	stored, err := store.FindSigningKeys(context.Background(), now)
+	require.NoError(t, err)
+	require.Contains(t, stored[0].PrivateKey, sealedKeyType)
+
+	// No new key before the rotation
+	require.NoError(t, ring.rotate(context.Background(), now.Add(30*time.Minute)))
+	require.Len(t, ring.publicKeys().Keys, 2)
+
+	// After the rotation the previous key still verifies the tokens it signed during the overlap
+	require.NoError(t, ring.rotate(context.Background(), now.Add(time.Hour)))
+	require.Len(t, ring.publicKeys().Keys, 3)
+	require.NotEqual(t, firstKid, ring.keys[0].kid)
+	_, err = parseWithRing(ring, first)
+	require.NoError(t, err)
+
+	// Then it is no longer published
+	require.NoError(t, ring.rotate(context.Background(), now.Add(time.Hour+21*time.Minute)))
+	require.Len(t, ring.publicKeys().Keys, 2)
+	_, err = parseWithRing(ring, first)
+	require.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestSigningKeyTypes(t *testing.T) {
+	for _, keyType := range SigningAlgorithms {
+		t.Run(keyType, func(t *testing.T) {
+			key, err := generateKey(keyType)
+			require.NoError(t, err)
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			require.NoError(t, err)
+			ring, err := newKeyRing(nil, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), TokenConfig{})
+			require.NoError(t, err)
+			token, err := ring.sign(TokenClaims{Username: "root"})
+			require.NoError(t, err)
+			parsed, err := parseWithRing(ring, token)
+			require.NoError(t, err)
+			require.Equal(t, keyType, parsed.Method.Alg())
+			require.Equal(t, []string{keyType}, ring.algorithms())
+			require.Equal(t, keyType, ring.publicKeys().Keys[0].Alg)
+		})
+	}
+	_, err := generateKey("HS256")
+	require.Error(t, err)
+}
+
+func TestSealedKeys(t *testing.T) {
+	encryptionKey := make([]byte, keyEncryptionKeySize)
+	_, err := rand.Read(encryptionKey)
+	require.NoError(t, err)
+	key, err := generateKey(KeyTypeES256)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	sealed, err := sealKey(encryptionKey, "kid", der)
+	require.NoError(t, err)
+	require.NotContains(t, sealed, "BEGIN PRIVATE KEY")
+
+	opened, err := openKey(encryptionKey, db.SigningKey{Kid: "kid", PrivateKey: sealed})
+	require.NoError(t, err)
+	require.Equal(t, key, opened)
+	// The key is bound to its kid and only opened with the encryption key
+	_, err = openKey(encryptionKey, db.SigningKey{Kid: "other", PrivateKey: sealed})
+	require.Error(t, err)
+	_, err = openKey(make([]byte, keyEncryptionKeySize), db.SigningKey{Kid: "kid", PrivateKey: sealed})
+	require.Error(t, err)
+	_, err = openKey(nil, db.SigningKey{Kid: "kid", PrivateKey: sealed})
+	require.Error(t, err)
+	_, err = sealKey(nil, "kid", der)
+	require.Error(t, err)
+
+	// Keys stored before they were encrypted are still read
+	plain := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	opened, err = openKey(nil, db.SigningKey{Kid: "kid", PrivateKey: plain})
+	require.NoError(t, err)
+	require.Equal(t, key, opened)
+}
+
+func TestThumbprint(t *testing.T) {
+	// Example of RFC 8037
+	key := JSONWebKey{Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	require.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", thumbprint(key))
+}
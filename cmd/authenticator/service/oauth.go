@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/exp/slices"
+)
+
+// Grant types of the OAuth2 token endpoint
+const (
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypePassword          = "password"
+	GrantTypeRefreshToken      = "refresh_token"
+)
+
+// TokenTypeBearer is the type of the access tokens returned by the OAuth2 token endpoint
+const TokenTypeBearer = "Bearer"
+
+// ErrInvalidClient is returned when an OAuth2 client is unknown or its secret is wrong
+var ErrInvalidClient = errors.New("client authentication failed")
+
+// ErrInvalidScope is returned when an OAuth2 client requests a scope it was not registered with
+var ErrInvalidScope = errors.New("scope is not granted to the client")
+
+// ErrClientNotFound is returned when a tenant has no OAuth2 client with an id
+var ErrClientNotFound = errors.New("client not found")
+
+// ClientRequest represents the DTO registering an OAuth2 client
+type ClientRequest struct {
+	Name string `json:"name"`
+	// Scopes are the permissions of the client among those of the token registering it, all of them when empty
+	Scopes []string `json:"scopes"`
+	// Tenant is the tenant of the client, only a super-admin registers clients in another tenant than its own
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Client represents the DTO of an OAuth2 client, its secret is only returned when it is registered
+type Client struct {
+	ClientID     string    `json:"clientId"`
+	Name         string    `json:"name"`
+	Tenant       string    `json:"tenant"`
+	Scopes       []string  `json:"scopes"`
+	CreatedBy    string    `json:"createdBy"`
+	CreatedAt    time.Time `json:"createdAt"`
+	ClientSecret string    `json:"clientSecret,omitempty"`
+}
+
+// OAuthTokens represents the DTO returned by the OAuth2 token endpoint, see RFC 6749 section 5.1
+type OAuthTokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// NewOAuthTokens returns the tokens of a login or a refresh as returned by the OAuth2 token endpoint
+func NewOAuthTokens(tokens Tokens) OAuthTokens {
+	return OAuthTokens{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    TokenTypeBearer,
+		ExpiresIn:    tokens.ExpiresIn,
+		RefreshToken: tokens.RefreshToken,
+	}
+}
+
+// Introspection represents the DTO returned by the introspection endpoint, see RFC 7662. Inactive tokens have no
+// other member.
+type Introspection struct {
+	Active    bool   `json:"active"`
+	TokenType string `json:"token_type,omitempty"`
+	*TokenClaims
+}
+
+func newClient(client db.Client) Client {
+	return Client{
+		ClientID:  client.ClientID,
+		Name:      client.Name,
+		Tenant:    client.Tenant,
+		Scopes:    client.Scopes,
+		CreatedBy: client.CreatedBy,
+		CreatedAt: client.CreatedAt,
+	}
+}
+
+// tenantFilter returns the tenant to filter by, nil for AllTenants
+func tenantFilter(tenant string) *string {
+	if tenant == AllTenants {
+		return nil
+	}
+	return &tenant
+}
+
+// RegisterClient registers an OAuth2 client in the tenant of the request. The secret is only returned here, it is
+// stored by its hash.
+func (as authenticatorService) RegisterClient(claims TokenClaims, request ClientRequest) (*Client, error) {
+	if strings.TrimSpace(request.Name) == "" {
+		return nil, errors.New("name is required")
+	}
+	scopes, err := requestedScopes(request.Scopes, claims.Permissions())
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	client := db.Client{
+		ClientID:   primitive.NewObjectID().Hex(),
+		SecretHash: hashToken(secret),
+		Name:       request.Name,
+		Tenant:     request.Tenant,
+		Scopes:     scopes,
+		CreatedBy:  claims.Username,
+		CreatedAt:  time.Now(),
+	}
+	err = as.clients.AddClient(context.Background(), client)
+	if err != nil {
+		return nil, err
+	}
+	result := newClient(client)
+	result.ClientSecret = secret
+	return &result, nil
+}
+
+// Clients returns the OAuth2 clients of the tenant, without their secrets
+func (as authenticatorService) Clients(tenant string) ([]Client, error) {
+	clients, err := as.clients.FindClients(context.Background(), tenantFilter(tenant))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Client, 0, len(clients))
+	for _, client := range clients {
+		result = append(result, newClient(client))
+	}
+	return result, nil
+}
+
+// DeleteClient removes the OAuth2 client of the tenant and revokes the tokens issued to it
+func (as authenticatorService) DeleteClient(tenant, clientID string) error {
+	err := as.clients.DeleteClient(context.Background(), clientID, tenantFilter(tenant))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrClientNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// The client id is the username of its tokens
+	return as.RevokeTokens(RevokeRequest{Username: clientID})
+}
+
+// AuthenticateClient returns the OAuth2 client when the secret is its own, ErrInvalidClient otherwise
+func (as authenticatorService) AuthenticateClient(clientID, secret string) (*Client, error) {
+	client, err := as.clients.FindClient(context.Background(), clientID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hashToken(secret))) != 1 {
+		return nil, ErrInvalidClient
+	}
+	result := newClient(*client)
+	return &result, nil
+}
+
+// ClientCredentials returns an access token for the OAuth2 client, without refresh token as the client can always get
+// a new one. The client id is the username of the token, in the tenant of the client.
+func (as authenticatorService) ClientCredentials(clientID, secret, scope string) (*OAuthTokens, error) {
+	client, err := as.AuthenticateClient(clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+	scopes := client.Scopes
+	if scope != "" {
+		scopes = strings.Fields(scope)
+		for _, requested := range scopes {
+			if !slices.Contains(client.Scopes, requested) {
+				return nil, ErrInvalidScope
+			}
+		}
+	}
+	granted := strings.Join(scopes, " ")
+	accessToken, err := as.signAccessToken(TokenClaims{
+		Username: client.ClientID,
+		Scope:    granted,
+		Tenant:   client.Tenant,
+		ClientID: client.ClientID,
+	}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthTokens{
+		AccessToken: accessToken,
+		TokenType:   TokenTypeBearer,
+		ExpiresIn:   int64(as.config.AccessTokenTTL.Seconds()),
+		Scope:       granted,
+	}, nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIntrospectionJSON(t *testing.T) {
+	// Inactive tokens have no other member, see RFC 7662 section 2.2
+	inactive, err := json.Marshal(Introspection{})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"active":false}`, string(inactive))
+
+	active, err := json.Marshal(Introspection{Active: true, TokenType: TokenTypeBearer, TokenClaims: &TokenClaims{
+		Username:         "client",
+		Scope:            "sensor:read",
+		ClientID:         "client",
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "client", ExpiresAt: jwt.NewNumericDate(jwt.TimeFunc())},
+	}})
+	require.NoError(t, err)
+	var members map[string]interface{}
+	require.NoError(t, json.Unmarshal(active, &members))
+	for _, member := range []string{"active", "token_type", "username", "scope", "client_id", "sub", "exp"} {
+		require.Contains(t, members, member)
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	require.NoError(t, os.Setenv("tls.key", string(newTestKeyPEM(t))))
+	service, err := NewAuthenticatorService("mongodb://localhost:27017", "users"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	admin := TokenClaims{Username: "admin", Role: "ADMIN", Tenant: "acme", Scope: "sensor:read sensor:write user:admin"}
+
+	_, err = service.RegisterClient(admin, ClientRequest{Name: "ingest", Scopes: []string{PermissionTenantAll}})
+	require.Error(t, err)
+	client, err := service.RegisterClient(admin, ClientRequest{Name: "ingest", Tenant: "acme",
+		Scopes: []string{PermissionSensorRead, PermissionSensorWrite}})
+	require.NoError(t, err)
+	require.NotEmpty(t, client.ClientSecret)
+	clients, err := service.Clients("acme")
+	require.NoError(t, err)
+	require.Len(t, clients, 1)
+	require.Empty(t, clients[0].ClientSecret)
+	clients, err = service.Clients("other")
+	require.NoError(t, err)
+	require.Empty(t, clients)
+
+	// The token of the client has the requested scopes in the tenant of the client
+	_, err = service.ClientCredentials(client.ClientID, "wrong", "")
+	require.ErrorIs(t, err, ErrInvalidClient)
+	_, err = service.ClientCredentials(client.ClientID, client.ClientSecret, "user:admin")
+	require.ErrorIs(t, err, ErrInvalidScope)
+	tokens, err := service.ClientCredentials(client.ClientID, client.ClientSecret, "sensor:write")
+	require.NoError(t, err)
+	require.Equal(t, TokenTypeBearer, tokens.TokenType)
+	require.Equal(t, "sensor:write", tokens.Scope)
+	require.Empty(t, tokens.RefreshToken)
+	var claims TokenClaims
+	_, _, err = jwt.NewParser().ParseUnverified(tokens.AccessToken, &claims)
+	require.NoError(t, err)
+	require.Equal(t, client.ClientID, claims.ClientID)
+	require.Equal(t, client.ClientID, claims.Username)
+	require.Equal(t, "acme", claims.Tenant)
+
+	// Deleting the client revokes its tokens
+	require.ErrorIs(t, service.DeleteClient("other", client.ClientID), ErrClientNotFound)
+	require.NoError(t, service.DeleteClient("acme", client.ClientID))
+	revoked, err := service.IsRevoked(claims)
+	require.NoError(t, err)
+	require.True(t, revoked)
+	_, err = service.AuthenticateClient(client.ClientID, client.ClientSecret)
+	require.ErrorIs(t, err, ErrInvalidClient)
+
+	// The password grant is the login of a user
+	require.NoError(t, service.Register(db.User{Username: "alice", Password: "secret", Role: "READER"}))
+	login, err := service.Login(db.User{Username: "alice", Password: "secret"})
+	require.NoError(t, err)
+	require.Equal(t, TokenTypeBearer, NewOAuthTokens(*login).TokenType)
+}
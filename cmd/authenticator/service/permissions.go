@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/exp/slices"
+)
+
+// Permissions granted by the roles, they are the scopes of the tokens
+const (
+	PermissionSensorRead   = "sensor:read"
+	PermissionSensorWrite  = "sensor:write"
+	PermissionSensorDelete = "sensor:delete"
+	PermissionUserAdmin    = "user:admin"
+	// PermissionSensorAdmin reads and changes every sensor of the tenant, whatever its owner and ACL
+	PermissionSensorAdmin = "sensor:admin"
+	// PermissionTenantAll operates across the tenants, on their sensors, users and on the roles they share
+	PermissionTenantAll = "tenant:all"
+)
+
+// AllTenants is the tenant scope of the tokens with tenant:all
+const AllTenants = "*"
+
+// Permissions are all the permissions
+var Permissions = []string{
+	PermissionSensorRead, PermissionSensorWrite, PermissionSensorDelete, PermissionSensorAdmin, PermissionUserAdmin,
+	PermissionTenantAll,
+}
+
+// tenantAdminPermissions are the permissions of an ADMIN, all of them within its tenant
+var tenantAdminPermissions = []string{
+	PermissionSensorRead, PermissionSensorWrite, PermissionSensorDelete, PermissionSensorAdmin, PermissionUserAdmin,
+}
+
+// DefaultRoles are created when the authenticator starts, unless they exist
+var DefaultRoles = []Role{
+	{Name: "READER", Permissions: []string{PermissionSensorRead}},
+	{Name: "EDITOR", Permissions: []string{PermissionSensorRead, PermissionSensorWrite}},
+	{Name: "ADMIN", Permissions: tenantAdminPermissions},
+	{Name: "SUPERADMIN", Permissions: Permissions},
+}
+
+// ErrRoleNotFound is returned when a role does not exist
+var ErrRoleNotFound = errors.New("role not found")
+
+// ErrRoleWithoutPermissions is returned when tokens are issued for a role granting no permission
+var ErrRoleWithoutPermissions = errors.New("role grants no permission")
+
+// Role represents the DTO of a role and its permissions
+type Role struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// Permissions returns the permissions in the scope of the token. Legacy tokens, issued before the tokens had a jti and
+// a scope, have the permissions of a tenant ADMIN with the ADMIN role and only sensor:read otherwise. Newer tokens
+// always have a scope, they have no permission without one.
+func (c TokenClaims) Permissions() []string {
+	if c.Scope != "" {
+		return strings.Fields(c.Scope)
+	}
+	if c.ID != "" {
+		return nil
+	}
+	if c.Role == "ADMIN" {
+		return tenantAdminPermissions
+	}
+	return []string{PermissionSensorRead}
+}
+
+// HasPermission tells whether the token grants the permission
+func (c TokenClaims) HasPermission(permission string) bool {
+	return slices.Contains(c.Permissions(), permission)
+}
+
+// TenantScope returns the tenant the token operates on, AllTenants with tenant:all
+func (c TokenClaims) TenantScope() string {
+	if c.HasPermission(PermissionTenantAll) {
+		return AllTenants
+	}
+	return c.Tenant
+}
+
+func defaultRoles() []db.Role {
+	roles := make([]db.Role, 0, len(DefaultRoles))
+	for _, role := range DefaultRoles {
+		roles = append(roles, db.Role{Name: role.Name, Permissions: role.Permissions})
+	}
+	return roles
+}
+
+// Roles returns all the roles
+func (as authenticatorService) Roles() ([]Role, error) {
+	roles, err := as.roles.FindRoles(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Role, 0, len(roles))
+	for _, role := range roles {
+		result = append(result, Role{Name: role.Name, Permissions: role.Permissions})
+	}
+	return result, nil
+}
+
+// Role returns the role with the name
+func (as authenticatorService) Role(name string) (*Role, error) {
+	role, err := as.roles.FindRole(context.Background(), name)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Role{Name: role.Name, Permissions: role.Permissions}, nil
+}
+
+// SetRole creates a role or replaces its permissions, which apply to the tokens issued from then on
+func (as authenticatorService) SetRole(role Role) error {
+	if strings.TrimSpace(role.Name) == "" {
+		return errors.New("name is required")
+	}
+	for _, permission := range role.Permissions {
+		if !slices.Contains(Permissions, permission) {
+			return fmt.Errorf("unknown permission %s, it must be one of %s", permission, strings.Join(Permissions, ", "))
+		}
+	}
+	if len(role.Permissions) == 0 {
+		return errors.New("permissions are required")
+	}
+	return as.roles.SetRole(context.Background(), db.Role{Name: role.Name, Permissions: role.Permissions})
+}
+
+// checkRole returns an error when the role does not exist
+func (as authenticatorService) checkRole(ctx context.Context, name string) error {
+	_, err := as.roles.FindRole(ctx, name)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("unknown role %q", name)
+	}
+	return err
+}
+
+// scope returns the permissions of the role as the scope of a token. Tokens are not issued for roles that don't exist
+// or grant no permission, as a token without scope would have no permission.
+func (as authenticatorService) scope(ctx context.Context, name string) (string, error) {
+	role, err := as.roles.FindRole(ctx, name)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", ErrRoleNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(role.Permissions) == 0 {
+		return "", ErrRoleWithoutPermissions
+	}
+	return strings.Join(role.Permissions, " "), nil
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissions(t *testing.T) {
+	require.Equal(t, []string{"sensor:read", "user:admin"}, TokenClaims{Scope: "sensor:read user:admin"}.Permissions())
+	// Legacy tokens without scopes nor jti get the permissions of their role
+	require.Equal(t, tenantAdminPermissions, TokenClaims{Role: "ADMIN"}.Permissions())
+	// Newer tokens without scopes, of a role whose permissions were removed, have none
+	require.Empty(t, TokenClaims{Role: "ADMIN", RegisteredClaims: jwt.RegisteredClaims{ID: "jti"}}.Permissions())
+	require.False(t, TokenClaims{Role: "READER"}.HasPermission(PermissionUserAdmin))
+	require.False(t, TokenClaims{Role: "ADMIN", Scope: "sensor:read"}.HasPermission(PermissionUserAdmin))
+}
+
+func TestTenantScope(t *testing.T) {
+	require.Equal(t, "acme", TokenClaims{Tenant: "acme", Scope: "sensor:read user:admin"}.TenantScope())
+	require.Equal(t, AllTenants, TokenClaims{Tenant: "acme", Scope: "sensor:read tenant:all"}.TenantScope())
+	// Tokens without scopes stay in their tenant
+	require.Equal(t, "", TokenClaims{Role: "ADMIN"}.TenantScope())
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+)
+
+// RevokeRequest represents the DTO revoking either a token by its JTI or all the current tokens of a user
+type RevokeRequest struct {
+	JTI      string `json:"jti,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// RevokedUser represents the DTO of a user whose tokens issued until RevokedAt are revoked
+type RevokedUser struct {
+	Username  string    `json:"username"`
+	RevokedAt time.Time `json:"revokedAt"`
+}
+
+// RevocationList represents the DTO of the revoked tokens that have not expired
+type RevocationList struct {
+	// Tokens lists the JTI of the revoked tokens
+	Tokens []string      `json:"tokens"`
+	Users  []RevokedUser `json:"users"`
+}
+
+// Logout revokes the access token and, when given, the refresh token of the same login
+func (as authenticatorService) Logout(claims TokenClaims, refreshToken string) error {
+	ctx := context.Background()
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		err := as.revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time)
+		if err != nil {
+			return err
+		}
+	}
+	if refreshToken == "" {
+		return nil
+	}
+	stored, err := as.refreshTokens.FindRefreshToken(ctx, hashToken(refreshToken), time.Now())
+	if err != nil || stored.Username != claims.Username {
+		return ErrInvalidRefreshToken
+	}
+	return as.refreshTokens.RevokeRefreshTokenFamily(ctx, stored.Family)
+}
+
+// RevokeTokens revokes a token by its JTI, or all the access and refresh tokens of a user. The API keys of the user are
+// kept, the ones validated before are revoked along its access tokens.
+func (as authenticatorService) RevokeTokens(request RevokeRequest) error {
+	ctx := context.Background()
+	now := time.Now()
+	// Access tokens expire at most AccessTokenTTL after now, the revocation is not needed after that
+	expiresAt := now.Add(as.config.AccessTokenTTL + as.config.ClockSkew)
+	switch {
+	case request.JTI != "" && request.Username != "":
+		return errors.New("revoke either a jti or a username")
+	case request.JTI != "":
+		return as.revocations.RevokeToken(ctx, request.JTI, expiresAt)
+	case request.Username != "":
+		err := as.refreshTokens.RevokeUserRefreshTokens(ctx, request.Username)
+		if err != nil {
+			return err
+		}
+		return as.revocations.RevokeUser(ctx, request.Username, now, expiresAt)
+	}
+	return errors.New("jti or username is required")
+}
+
+// Revocations returns the revoked tokens that have not expired
+func (as authenticatorService) Revocations() (*RevocationList, error) {
+	revocations, err := as.revocations.FindRevocations(context.Background(), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	list := &RevocationList{Tokens: []string{}, Users: []RevokedUser{}}
+	for _, revocation := range revocations {
+		if revocation.JTI != "" {
+			list.Tokens = append(list.Tokens, revocation.JTI)
+		} else {
+			list.Users = append(list.Users, RevokedUser{Username: revocation.Username, RevokedAt: revocation.RevokedAt})
+		}
+	}
+	return list, nil
+}
+
+// IsRevoked tells whether the token was revoked by its JTI or with all the tokens of its user
+func (as authenticatorService) IsRevoked(claims TokenClaims) (bool, error) {
+	revocations, err := as.revocations.FindRevocation(context.Background(), claims.ID, claims.Username, time.Now())
+	if err != nil {
+		return false, err
+	}
+	for _, revocation := range revocations {
+		if isRevokedBy(claims, revocation) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isRevokedBy tells whether the revocation applies to the token. Issue times are in seconds, so a token issued in the
+// same second as the revocation of its user is revoked.
+func isRevokedBy(claims TokenClaims, revocation db.Revocation) bool {
+	if revocation.JTI != "" {
+		return revocation.JTI == claims.ID
+	}
+	return revocation.Username == claims.Username &&
+		(claims.IssuedAt == nil || !claims.IssuedAt.After(revocation.RevokedAt))
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRevokedBy(t *testing.T) {
+	revokedAt := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	claims := TokenClaims{
+		Username:         "user",
+		RegisteredClaims: jwt.RegisteredClaims{ID: "jti", IssuedAt: jwt.NewNumericDate(revokedAt.Add(-time.Minute))},
+	}
+	require.True(t, isRevokedBy(claims, db.Revocation{JTI: "jti"}))
+	require.False(t, isRevokedBy(claims, db.Revocation{JTI: "other"}))
+	require.True(t, isRevokedBy(claims, db.Revocation{Username: "user", RevokedAt: revokedAt}))
+	require.False(t, isRevokedBy(claims, db.Revocation{Username: "other", RevokedAt: revokedAt}))
+	// Tokens issued in the same second as the revocation are revoked, the ones issued after are not
+	claims.IssuedAt = jwt.NewNumericDate(revokedAt)
+	require.True(t, isRevokedBy(claims, db.Revocation{Username: "user", RevokedAt: revokedAt.Add(500 * time.Millisecond)}))
+	claims.IssuedAt = jwt.NewNumericDate(revokedAt.Add(time.Second))
+	require.False(t, isRevokedBy(claims, db.Revocation{Username: "user", RevokedAt: revokedAt}))
+}
@@ -2,11 +2,14 @@ package service
 
 import (
 	"context"
+	"crypto"
 	"errors"
 	"os"
+	"time"
 
 	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
 	jwt "github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -15,38 +18,149 @@ import (
 type TokenClaims struct {
 	Username string `json:"username"`
 	Role     string `json:"role"`
-	jwt.StandardClaims
+	// Scope is the space separated list of the permissions of the role of the user, always set on new tokens
+	Scope string `json:"scope"`
+	// Tenant is the tenant of the user, the default tenant when empty
+	Tenant string `json:"tenant,omitempty"`
+	// Groups are the groups of the user
+	Groups []string `json:"groups,omitempty"`
+	// ClientID is the OAuth2 client the token was issued to with client_credentials, it is also the username
+	ClientID string `json:"client_id,omitempty"`
+	jwt.RegisteredClaims
 }
 
-// Valid overrides StandardClaims validation.
-func (c TokenClaims) Valid() error {
-	return nil
-}
+// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired or was already used
+var ErrInvalidRefreshToken = errors.New("refresh token is invalid")
+
+// ErrUserDisabled is returned when a disabled user logs in
+var ErrUserDisabled = errors.New("user is disabled")
 
 type AuthenticatorService interface {
 	// Creates a new user
 	Register(user db.User) error
-	// Returns a JWT token for a user if exists
-	Login(user db.User) (string, error)
+	// Returns an access token and a refresh token for a user if exists
+	Login(user db.User) (*Tokens, error)
+	// Returns new tokens for a refresh token, which can't be used again
+	Refresh(refreshToken string) (*Tokens, error)
+	// Revokes the access token and the refresh token of a login
+	Logout(claims TokenClaims, refreshToken string) error
+	// Revokes a token or all the tokens of a user
+	RevokeTokens(request RevokeRequest) error
+	// Returns the revoked tokens that have not expired
+	Revocations() (*RevocationList, error)
+	// Tells whether a token was revoked
+	IsRevoked(claims TokenClaims) (bool, error)
+	// Returns the public keys tokens are verified with
+	JWKS() JSONWebKeySet
+	// Returns the public key with the kid of a token
+	VerificationKey(kid string) (crypto.PublicKey, error)
+	// Returns the OpenID Connect discovery document of the authenticator published at baseURL
+	OpenIDConfiguration(baseURL string) OpenIDConfiguration
+	// Returns the users matching the filter
+	Users(filter db.UserFilter) ([]User, error)
+	// Returns a user
+	User(username string) (*User, error)
+	// Changes the role of a user
+	UpdateRole(username, role string) error
+	// Replaces the groups of a user
+	SetGroups(username string, groups []string) error
+	// Disables or enables a user
+	SetDisabled(username string, disabled bool) error
+	// Removes a user
+	DeleteUser(username string) error
+	// Changes the password of a user given its current one
+	ChangePassword(username string, change PasswordChange) error
+	// Returns the roles and their permissions
+	Roles() ([]Role, error)
+	// Returns a role and its permissions
+	Role(name string) (*Role, error)
+	// Creates a role or replaces its permissions
+	SetRole(role Role) error
+	// Creates an API key of the user of the token, returning its value once
+	CreateAPIKey(claims TokenClaims, request APIKeyRequest) (*APIKey, error)
+	// Returns the API keys of a user
+	APIKeys(username string) ([]APIKey, error)
+	// Removes an API key of a user
+	RevokeAPIKey(username, id string) error
+	// Returns the claims an API key authenticates with
+	ValidateAPIKey(key string) (*TokenClaims, error)
+	// Registers an OAuth2 client, returning its secret once
+	RegisterClient(claims TokenClaims, request ClientRequest) (*Client, error)
+	// Returns the OAuth2 clients of a tenant, of all the tenants with AllTenants
+	Clients(tenant string) ([]Client, error)
+	// Removes an OAuth2 client of a tenant and revokes its tokens
+	DeleteClient(tenant, clientID string) error
+	// Authenticates an OAuth2 client by its secret
+	AuthenticateClient(clientID, secret string) (*Client, error)
+	// Returns an access token for an OAuth2 client with the requested scope, all of its scopes when empty
+	ClientCredentials(clientID, secret, scope string) (*OAuthTokens, error)
 }
 
 type authenticatorService struct {
-	userStore *db.UserStore
-	key       []byte
+	userStore     *db.UserStore
+	refreshTokens *db.RefreshTokenStore
+	revocations   *db.RevocationStore
+	roles         *db.RoleStore
+	apiKeys       *db.APIKeyStore
+	clients       *db.ClientStore
+	keys          *keyRing
+	config        TokenConfig
 }
 
 func NewAuthenticatorService(uri, databaseName string) (*authenticatorService, error) {
+	config, err := NewTokenConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
 	ss, err := db.NewUserStore(uri, databaseName)
 	if err != nil {
 		return nil, err
 	}
+	rs, err := db.NewRefreshTokenStore(uri, databaseName)
+	if err != nil {
+		return nil, err
+	}
+	revocations, err := db.NewRevocationStore(uri, databaseName)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := db.NewRoleStore(uri, databaseName, defaultRoles())
+	if err != nil {
+		return nil, err
+	}
+	apiKeys, err := db.NewAPIKeyStore(uri, databaseName)
+	if err != nil {
+		return nil, err
+	}
+	clients, err := db.NewClientStore(uri, databaseName)
+	if err != nil {
+		return nil, err
+	}
+	signingKeys, err := db.NewSigningKeyStore(uri, databaseName)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := newKeyRing(signingKeys, []byte(os.Getenv("tls.key")), config)
+	if err != nil {
+		return nil, err
+	}
 	return &authenticatorService{
-		userStore: ss,
-		key:       []byte(os.Getenv("tls.key")),
+		userStore:     ss,
+		refreshTokens: rs,
+		revocations:   revocations,
+		roles:         roles,
+		apiKeys:       apiKeys,
+		clients:       clients,
+		keys:          keys,
+		config:        config,
 	}, nil
 }
 
 func (as authenticatorService) Register(user db.User) error {
+	err := as.checkRole(context.Background(), user.Role)
+	if err != nil {
+		return err
+	}
 	// Hash password with bcrypt's min cost
 	hashedPasswordBytes, err := bcrypt.
 		GenerateFromPassword([]byte(user.Password), bcrypt.MinCost)
@@ -57,31 +171,107 @@ func (as authenticatorService) Register(user db.User) error {
 	return as.userStore.AddUser(context.Background(), user)
 }
 
-// Returns a JWT token for a user if exists
-func (as authenticatorService) Login(user db.User) (string, error) {
+// Returns an access token and a refresh token for a user if exists
+func (as authenticatorService) Login(user db.User) (*Tokens, error) {
 	dbUser, err := as.userStore.FindByUserName(context.Background(), user.Username)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	err = bcrypt.CompareHashAndPassword([]byte(dbUser.Password), []byte(user.Password))
 	if err != nil {
-		return "", errors.New("Invalid Password")
+		return nil, errors.New("Invalid Password")
 	}
-	// Generate the claim...
-	token, err := as.GenerateToken(TokenClaims{
-		Username: dbUser.Username,
-		Role:     dbUser.Role,
-	})
-	return token, err
+	if dbUser.Disabled {
+		return nil, ErrUserDisabled
+	}
+	return as.issueTokens(context.Background(), *dbUser, primitive.NewObjectID())
 }
 
-// GenerateRefreshToken generates a new jwt token
-func (as authenticatorService) GenerateToken(claim TokenClaims) (string, error) {
-	alg := jwt.SigningMethodRS256
-	key, err := jwt.ParseRSAPrivateKeyFromPEM(as.key)
+// Refresh returns new tokens for a refresh token and rotates it. Using a rotated token again revokes all the tokens
+// descending from the same login, as it was likely stolen.
+func (as authenticatorService) Refresh(refreshToken string) (*Tokens, error) {
+	ctx := context.Background()
+	stored, err := as.refreshTokens.UseRefreshToken(ctx, hashToken(refreshToken), time.Now())
+	if errors.Is(err, db.ErrRefreshTokenReused) {
+		err = as.refreshTokens.RevokeRefreshTokenFamily(ctx, stored.Family)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	// The role is read again so that changes apply from the next refresh
+	dbUser, err := as.userStore.FindByUserName(ctx, stored.Username)
+	if err != nil || dbUser.Disabled {
+		return nil, ErrInvalidRefreshToken
+	}
+	return as.issueTokens(ctx, *dbUser, stored.Family)
+}
+
+// issueTokens returns a new access token and a new refresh token of the family for the user
+func (as authenticatorService) issueTokens(ctx context.Context, user db.User, family primitive.ObjectID) (*Tokens, error) {
+	now := time.Now()
+	scope, err := as.scope(ctx, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := as.signAccessToken(TokenClaims{
+		Username: user.Username,
+		Role:     user.Role,
+		Scope:    scope,
+		Tenant:   user.Tenant,
+		Groups:   user.Groups,
+	}, now)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	err = as.refreshTokens.AddRefreshToken(ctx, db.RefreshToken{
+		Hash:      hash,
+		Username:  user.Username,
+		Family:    family,
+		ExpiresAt: now.Add(as.config.RefreshTokenTTL),
+	})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return &Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "token",
+		ExpiresIn:    int64(as.config.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// signAccessToken signs an access token of the user of the claims, issued now with a new jti
+func (as authenticatorService) signAccessToken(claims TokenClaims, now time.Time) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        primitive.NewObjectID().Hex(),
+		Issuer:    as.config.Issuer,
+		Subject:   claims.Username,
+		Audience:  jwt.ClaimStrings{as.config.Audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(as.config.AccessTokenTTL)),
+		IssuedAt:  jwt.NewNumericDate(now),
 	}
-	token := jwt.NewWithClaims(alg, claim)
-	return token.SignedString(key)
+	return as.GenerateToken(claims)
+}
+
+// GenerateToken generates a new jwt token signed with the current key
+func (as authenticatorService) GenerateToken(claim TokenClaims) (string, error) {
+	return as.keys.sign(claim)
+}
+
+// JWKS returns the public keys tokens are verified with
+func (as authenticatorService) JWKS() JSONWebKeySet {
+	return as.keys.publicKeys()
+}
+
+// VerificationKey returns the public key with the kid of a token
+func (as authenticatorService) VerificationKey(kid string) (crypto.PublicKey, error) {
+	return as.keys.verificationKey(kid)
 }
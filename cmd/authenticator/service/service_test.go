@@ -6,6 +6,7 @@ import (
 
 	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
 
+	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -36,4 +37,140 @@ f9Oeos0UUothgiDktdQHxdNEwLjQf7lJJBzV+5OtwswCWA==
 	})
 	require.NoError(t, err)
 	require.NotNil(t, result)
+	require.NotEmpty(t, result.AccessToken)
+	require.NotEmpty(t, result.RefreshToken)
+	require.Equal(t, int64(DefaultAccessTokenTTL.Seconds()), result.ExpiresIn)
+
+	// A refresh token can be used once, using it again revokes the tokens rotated from it
+	refreshed, err := service.Refresh(result.RefreshToken)
+	require.NoError(t, err)
+	require.NotEqual(t, result.RefreshToken, refreshed.RefreshToken)
+	_, err = service.Refresh(result.RefreshToken)
+	require.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, err = service.Refresh(refreshed.RefreshToken)
+	require.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, err = service.Refresh("unknown")
+	require.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// Logging out revokes the access token and the refresh tokens of the login
+	login, err := service.Login(db.User{Username: "root", Password: "1234"})
+	require.NoError(t, err)
+	var claims TokenClaims
+	_, _, err = jwt.NewParser().ParseUnverified(login.AccessToken, &claims)
+	require.NoError(t, err)
+	require.NotEmpty(t, claims.ID)
+	revoked, err := service.IsRevoked(claims)
+	require.NoError(t, err)
+	require.False(t, revoked)
+	require.NoError(t, service.Logout(claims, login.RefreshToken))
+	revoked, err = service.IsRevoked(claims)
+	require.NoError(t, err)
+	require.True(t, revoked)
+	_, err = service.Refresh(login.RefreshToken)
+	require.ErrorIs(t, err, ErrInvalidRefreshToken)
+	list, err := service.Revocations()
+	require.NoError(t, err)
+	require.Equal(t, []string{claims.ID}, list.Tokens)
+
+	// Revoking a user revokes the tokens issued until then
+	require.Error(t, service.RevokeTokens(RevokeRequest{}))
+	require.Error(t, service.RevokeTokens(RevokeRequest{JTI: claims.ID, Username: "root"}))
+	login, err = service.Login(db.User{Username: "root", Password: "1234"})
+	require.NoError(t, err)
+	require.NoError(t, service.RevokeTokens(RevokeRequest{Username: "root"}))
+	_, err = service.Refresh(login.RefreshToken)
+	require.ErrorIs(t, err, ErrInvalidRefreshToken)
+	list, err = service.Revocations()
+	require.NoError(t, err)
+	require.Len(t, list.Users, 1)
+	require.Equal(t, "root", list.Users[0].Username)
+}
+
+func TestUserManagement(t *testing.T) {
+	require.NoError(t, os.Setenv("tls.key", string(newTestKeyPEM(t))))
+	service, err := NewAuthenticatorService("mongodb://localhost:27017", "users"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	require.NoError(t, service.Register(db.User{Username: "alice", Password: "secret", Role: "READER"}))
+	require.NoError(t, service.Register(db.User{Username: "bob", Password: "secret", Role: "READER"}))
+
+	users, err := service.Users(db.UserFilter{Search: "LI"})
+	require.NoError(t, err)
+	require.Equal(t, []User{{Username: "alice", Role: "READER"}}, users)
+	users, err = service.Users(db.UserFilter{Role: "READER"})
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	_, err = service.User("unknown")
+	require.ErrorIs(t, err, ErrUserNotFound)
+
+	require.NoError(t, service.UpdateRole("alice", "ADMIN"))
+	require.Error(t, service.UpdateRole("alice", ""))
+	require.ErrorIs(t, service.UpdateRole("unknown", "ADMIN"), ErrUserNotFound)
+	user, err := service.User("alice")
+	require.NoError(t, err)
+	require.Equal(t, "ADMIN", user.Role)
+
+	// Disabled users can't login nor refresh
+	tokens, err := service.Login(db.User{Username: "bob", Password: "secret"})
+	require.NoError(t, err)
+	require.NoError(t, service.SetDisabled("bob", true))
+	_, err = service.Login(db.User{Username: "bob", Password: "secret"})
+	require.ErrorIs(t, err, ErrUserDisabled)
+	_, err = service.Refresh(tokens.RefreshToken)
+	require.ErrorIs(t, err, ErrInvalidRefreshToken)
+	disabled := true
+	users, err = service.Users(db.UserFilter{Disabled: &disabled})
+	require.NoError(t, err)
+	require.Equal(t, []User{{Username: "bob", Role: "READER", Disabled: true}}, users)
+	require.NoError(t, service.SetDisabled("bob", false))
+	_, err = service.Login(db.User{Username: "bob", Password: "secret"})
+	require.NoError(t, err)
+
+	require.Error(t, service.ChangePassword("bob", PasswordChange{CurrentPassword: "wrong", NewPassword: "new"}))
+	require.NoError(t, service.ChangePassword("bob", PasswordChange{CurrentPassword: "secret", NewPassword: "new"}))
+	_, err = service.Login(db.User{Username: "bob", Password: "new"})
+	require.NoError(t, err)
+
+	require.NoError(t, service.DeleteUser("bob"))
+	require.ErrorIs(t, service.DeleteUser("bob"), ErrUserNotFound)
+
+	// The tenant and the groups of the user are claims of its tokens
+	require.NoError(t, service.Register(db.User{Username: "carol", Password: "secret", Role: "READER", Tenant: "acme"}))
+	acme := "acme"
+	users, err = service.Users(db.UserFilter{Tenant: &acme})
+	require.NoError(t, err)
+	require.Equal(t, []User{{Username: "carol", Role: "READER", Tenant: "acme"}}, users)
+	require.Error(t, service.SetGroups("carol", []string{""}))
+	require.NoError(t, service.SetGroups("carol", []string{"team-a"}))
+	tokens, err = service.Login(db.User{Username: "carol", Password: "secret"})
+	require.NoError(t, err)
+	var claims TokenClaims
+	_, _, err = jwt.NewParser().ParseUnverified(tokens.AccessToken, &claims)
+	require.NoError(t, err)
+	require.Equal(t, "acme", claims.Tenant)
+	require.Equal(t, []string{"team-a"}, claims.Groups)
+}
+
+func TestRoles(t *testing.T) {
+	require.NoError(t, os.Setenv("tls.key", string(newTestKeyPEM(t))))
+	service, err := NewAuthenticatorService("mongodb://localhost:27017", "users"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	roles, err := service.Roles()
+	require.NoError(t, err)
+	require.Len(t, roles, len(DefaultRoles))
+
+	require.Error(t, service.Register(db.User{Username: "alice", Password: "secret", Role: "UNKNOWN"}))
+	require.Error(t, service.SetRole(Role{Name: "AUDITOR", Permissions: []string{"sensor:audit"}}))
+	require.Error(t, service.SetRole(Role{Name: "ADMIN", Permissions: []string{}}))
+	require.NoError(t, service.SetRole(Role{Name: "AUDITOR", Permissions: []string{PermissionSensorRead, PermissionUserAdmin}}))
+	require.NoError(t, service.Register(db.User{Username: "alice", Password: "secret", Role: "AUDITOR"}))
+
+	// The permissions of the role are the scope of the token
+	tokens, err := service.Login(db.User{Username: "alice", Password: "secret"})
+	require.NoError(t, err)
+	var claims TokenClaims
+	_, _, err = jwt.NewParser().ParseUnverified(tokens.AccessToken, &claims)
+	require.NoError(t, err)
+	require.Equal(t, "sensor:read user:admin", claims.Scope)
+	require.True(t, claims.HasPermission(PermissionUserAdmin))
+	require.False(t, claims.HasPermission(PermissionSensorWrite))
 }
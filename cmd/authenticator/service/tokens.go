@@ -0,0 +1,178 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Defaults of the token configuration
+const (
+	DefaultIssuer          = "sensor-metadata-authenticator"
+	DefaultAudience        = "sensor-metadata"
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+	DefaultClockSkew       = 30 * time.Second
+
+	randomTokenBytes = 32
+)
+
+// Tokens represents the DTO returned by a login or a refresh
+type Tokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn int64 `json:"expiresIn"`
+}
+
+// TokenValidation holds the checks of the registered claims of a token
+type TokenValidation struct {
+	Issuer   string
+	Audience string
+	// ClockSkew is the tolerance on expiry and issue times for clocks out of sync
+	ClockSkew time.Duration
+}
+
+// Validate checks that the token has not expired, was issued, and that its issuer and audience are the expected ones
+func (v TokenValidation) Validate(claims TokenClaims, now time.Time) error {
+	if claims.ExpiresAt == nil || now.After(claims.ExpiresAt.Add(v.ClockSkew)) {
+		return errors.New("token has expired")
+	}
+	if claims.IssuedAt != nil && claims.IssuedAt.After(now.Add(v.ClockSkew)) {
+		return errors.New("token used before issued")
+	}
+	if claims.NotBefore != nil && claims.NotBefore.After(now.Add(v.ClockSkew)) {
+		return errors.New("token is not valid yet")
+	}
+	if claims.Issuer != v.Issuer {
+		return errors.New("token has an invalid issuer")
+	}
+	if !claims.VerifyAudience(v.Audience, true) {
+		return errors.New("token has an invalid audience")
+	}
+	return nil
+}
+
+// TokenConfig configures the tokens issued by the authenticator
+type TokenConfig struct {
+	TokenValidation
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// KeyRotation is how often a new signing key is generated, keys are not rotated when zero
+	KeyRotation time.Duration
+	// KeyType is the type of the rotated keys, KeyTypeRS256, KeyTypeES256 or KeyTypeEdDSA
+	KeyType string
+	// KeyOverlap is how long a replaced key is still published, at least the lifetime of the tokens it signed
+	KeyOverlap time.Duration
+	// KeyEncryptionKey is the AES-256 key the rotated keys are encrypted with in mongo, required to rotate them
+	KeyEncryptionKey []byte
+}
+
+// NewTokenConfigFromEnv reads the token configuration from JWT_ISSUER, JWT_AUDIENCE, JWT_CLOCK_SKEW, ACCESS_TOKEN_TTL,
+// REFRESH_TOKEN_TTL, SIGNING_KEY_ROTATION, SIGNING_KEY_TYPE, SIGNING_KEY_OVERLAP and SIGNING_KEY_ENCRYPTION_KEY, using
+// the defaults for the ones not set
+func NewTokenConfigFromEnv() (TokenConfig, error) {
+	config := TokenConfig{
+		TokenValidation: NewTokenValidationFromEnv(),
+		AccessTokenTTL:  DefaultAccessTokenTTL,
+		RefreshTokenTTL: DefaultRefreshTokenTTL,
+		KeyType:         os.Getenv("SIGNING_KEY_TYPE"),
+	}
+	switch config.KeyType {
+	case "":
+		config.KeyType = KeyTypeRS256
+	case KeyTypeRS256, KeyTypeES256, KeyTypeEdDSA:
+	default:
+		return config, fmt.Errorf("SIGNING_KEY_TYPE must be %s, %s or %s", KeyTypeRS256, KeyTypeES256, KeyTypeEdDSA)
+	}
+	var err error
+	for name, value := range map[string]*time.Duration{
+		"JWT_CLOCK_SKEW":       &config.ClockSkew,
+		"ACCESS_TOKEN_TTL":     &config.AccessTokenTTL,
+		"REFRESH_TOKEN_TTL":    &config.RefreshTokenTTL,
+		"SIGNING_KEY_ROTATION": &config.KeyRotation,
+		"SIGNING_KEY_OVERLAP":  &config.KeyOverlap,
+	} {
+		*value, err = durationFromEnv(name, *value)
+		if err != nil {
+			return config, err
+		}
+	}
+	// A key must be published until the last token it signed expires
+	if minOverlap := config.AccessTokenTTL + config.ClockSkew; config.KeyOverlap < minOverlap {
+		config.KeyOverlap = minOverlap
+	}
+	if encryptionKey := os.Getenv("SIGNING_KEY_ENCRYPTION_KEY"); encryptionKey != "" {
+		config.KeyEncryptionKey, err = base64.StdEncoding.DecodeString(encryptionKey)
+		if err != nil || len(config.KeyEncryptionKey) != keyEncryptionKeySize {
+			return config, fmt.Errorf("SIGNING_KEY_ENCRYPTION_KEY must be %d base64 encoded bytes", keyEncryptionKeySize)
+		}
+	}
+	// The rotated private keys are not stored in clear
+	if config.KeyRotation != 0 && config.KeyEncryptionKey == nil {
+		return config, errors.New("SIGNING_KEY_ENCRYPTION_KEY is required when SIGNING_KEY_ROTATION is set")
+	}
+	return config, nil
+}
+
+// NewTokenValidationFromEnv reads the expected issuer and audience and the clock skew from JWT_ISSUER, JWT_AUDIENCE
+// and JWT_CLOCK_SKEW, using the defaults for the ones not set or invalid
+func NewTokenValidationFromEnv() TokenValidation {
+	validation := TokenValidation{
+		Issuer:    os.Getenv("JWT_ISSUER"),
+		Audience:  os.Getenv("JWT_AUDIENCE"),
+		ClockSkew: DefaultClockSkew,
+	}
+	if validation.Issuer == "" {
+		validation.Issuer = DefaultIssuer
+	}
+	if validation.Audience == "" {
+		validation.Audience = DefaultAudience
+	}
+	validation.ClockSkew, _ = durationFromEnv("JWT_CLOCK_SKEW", DefaultClockSkew)
+	return validation
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return defaultValue, fmt.Errorf("%s must be a positive duration such as 15m", name)
+	}
+	return duration, nil
+}
+
+// newRefreshToken returns a random refresh token and the hash it is stored by
+func newRefreshToken() (string, string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	return token, hashToken(token), nil
+}
+
+// randomToken returns randomTokenBytes random bytes encoded in base64url
+func randomToken() (string, error) {
+	value := make([]byte, randomTokenBytes)
+	_, err := rand.Read(value)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(value), nil
+}
+
+// hashToken hashes refresh tokens and API keys with SHA-256, enough for random values, so that they can be looked up
+// by their hash
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
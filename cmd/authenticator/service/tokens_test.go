@@ -0,0 +1,86 @@
+package service
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenValidation(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	validation := TokenValidation{Issuer: DefaultIssuer, Audience: DefaultAudience, ClockSkew: 30 * time.Second}
+	claims := TokenClaims{
+		Username: "root",
+		Role:     "ADMIN",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    DefaultIssuer,
+			Audience:  jwt.ClaimStrings{DefaultAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	require.NoError(t, validation.Validate(claims, now))
+	// Within the clock skew
+	require.NoError(t, validation.Validate(claims, now.Add(80*time.Second)))
+	require.NoError(t, validation.Validate(claims, now.Add(-20*time.Second)))
+	require.EqualError(t, validation.Validate(claims, now.Add(2*time.Minute)), "token has expired")
+	require.EqualError(t, validation.Validate(claims, now.Add(-time.Minute)), "token used before issued")
+
+	invalid := claims
+	invalid.ExpiresAt = nil
+	require.EqualError(t, validation.Validate(invalid, now), "token has expired")
+	invalid = claims
+	invalid.Issuer = "someone-else"
+	require.EqualError(t, validation.Validate(invalid, now), "token has an invalid issuer")
+	invalid = claims
+	invalid.Audience = jwt.ClaimStrings{"another-service"}
+	require.EqualError(t, validation.Validate(invalid, now), "token has an invalid audience")
+	invalid.Audience = nil
+	require.EqualError(t, validation.Validate(invalid, now), "token has an invalid audience")
+}
+
+func TestNewTokenConfigFromEnv(t *testing.T) {
+	t.Setenv("ACCESS_TOKEN_TTL", "5m")
+	t.Setenv("JWT_ISSUER", "issuer")
+	config, err := NewTokenConfigFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, TokenConfig{
+		TokenValidation: TokenValidation{Issuer: "issuer", Audience: DefaultAudience, ClockSkew: DefaultClockSkew},
+		AccessTokenTTL:  5 * time.Minute,
+		RefreshTokenTTL: DefaultRefreshTokenTTL,
+		KeyType:         KeyTypeRS256,
+		// Replaced keys are published as long as the tokens they signed are valid
+		KeyOverlap: 5*time.Minute + DefaultClockSkew,
+	}, config)
+	t.Setenv("SIGNING_KEY_TYPE", "HS256")
+	_, err = NewTokenConfigFromEnv()
+	require.Error(t, err)
+	t.Setenv("SIGNING_KEY_TYPE", KeyTypeEdDSA)
+	// Rotated keys are encrypted
+	t.Setenv("SIGNING_KEY_ROTATION", "24h")
+	_, err = NewTokenConfigFromEnv()
+	require.Error(t, err)
+	t.Setenv("SIGNING_KEY_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString([]byte("too short")))
+	_, err = NewTokenConfigFromEnv()
+	require.Error(t, err)
+	t.Setenv("SIGNING_KEY_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(make([]byte, keyEncryptionKeySize)))
+	config, err = NewTokenConfigFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, make([]byte, keyEncryptionKeySize), config.KeyEncryptionKey)
+	t.Setenv("REFRESH_TOKEN_TTL", "a month")
+	_, err = NewTokenConfigFromEnv()
+	require.Error(t, err)
+}
+
+func TestRefreshTokenHash(t *testing.T) {
+	token, hash, err := newRefreshToken()
+	require.NoError(t, err)
+	require.Len(t, token, 43)
+	require.Equal(t, hash, hashToken(token))
+	other, _, err := newRefreshToken()
+	require.NoError(t, err)
+	require.NotEqual(t, token, other)
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/authenticator/db"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUserNotFound is returned when a user does not exist
+var ErrUserNotFound = errors.New("user not found")
+
+// User represents the DTO of a user, without its password
+type User struct {
+	Username string   `json:"username"`
+	Role     string   `json:"role"`
+	Tenant   string   `json:"tenant"`
+	Groups   []string `json:"groups,omitempty"`
+	Disabled bool     `json:"disabled"`
+}
+
+// PasswordChange represents the DTO changing the password of the user of the token
+type PasswordChange struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+func newUser(user db.User) User {
+	return User{Username: user.Username, Role: user.Role, Tenant: user.Tenant, Groups: user.Groups, Disabled: user.Disabled}
+}
+
+// userStoreError maps a missing user to ErrUserNotFound
+func userStoreError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// Users returns the users matching the filter
+func (as authenticatorService) Users(filter db.UserFilter) ([]User, error) {
+	users, err := as.userStore.FindUsers(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]User, 0, len(users))
+	for _, user := range users {
+		result = append(result, newUser(user))
+	}
+	return result, nil
+}
+
+// User returns the user with the username
+func (as authenticatorService) User(username string) (*User, error) {
+	user, err := as.userStore.FindByUserName(context.Background(), username)
+	if err != nil {
+		return nil, userStoreError(err)
+	}
+	result := newUser(*user)
+	return &result, nil
+}
+
+// UpdateRole changes the role of the user, which applies to the tokens issued from then on
+func (as authenticatorService) UpdateRole(username, role string) error {
+	if strings.TrimSpace(role) == "" {
+		return errors.New("role is required")
+	}
+	err := as.checkRole(context.Background(), role)
+	if err != nil {
+		return err
+	}
+	return userStoreError(as.userStore.UpdateRole(context.Background(), username, role))
+}
+
+// SetGroups replaces the groups of the user, which apply to the tokens issued from then on
+func (as authenticatorService) SetGroups(username string, groups []string) error {
+	for _, group := range groups {
+		if strings.TrimSpace(group) == "" {
+			return errors.New("groups can't be empty")
+		}
+	}
+	if groups == nil {
+		groups = []string{}
+	}
+	return userStoreError(as.userStore.UpdateGroups(context.Background(), username, groups))
+}
+
+// SetDisabled disables or enables the user. Disabling it revokes all its tokens, its API keys are rejected until it is
+// enabled again.
+func (as authenticatorService) SetDisabled(username string, disabled bool) error {
+	err := as.userStore.SetDisabled(context.Background(), username, disabled)
+	if err != nil || !disabled {
+		return userStoreError(err)
+	}
+	return as.RevokeTokens(RevokeRequest{Username: username})
+}
+
+// DeleteUser removes the user and its API keys, and revokes all its tokens
+func (as authenticatorService) DeleteUser(username string) error {
+	ctx := context.Background()
+	err := as.userStore.DeleteUser(ctx, username)
+	if err != nil {
+		return userStoreError(err)
+	}
+	err = as.apiKeys.DeleteUserAPIKeys(ctx, username)
+	if err != nil {
+		return err
+	}
+	return as.RevokeTokens(RevokeRequest{Username: username})
+}
+
+// ChangePassword replaces the password of the user when the current one is right. The refresh tokens of the user are
+// revoked, so its other sessions end when their access tokens expire.
+func (as authenticatorService) ChangePassword(username string, change PasswordChange) error {
+	ctx := context.Background()
+	if change.NewPassword == "" {
+		return errors.New("newPassword is required")
+	}
+	user, err := as.userStore.FindByUserName(ctx, username)
+	if err != nil {
+		return userStoreError(err)
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(change.CurrentPassword))
+	if err != nil {
+		return errors.New("Invalid Password")
+	}
+	hashedPasswordBytes, err := bcrypt.GenerateFromPassword([]byte(change.NewPassword), bcrypt.MinCost)
+	if err != nil {
+		return err
+	}
+	err = as.userStore.UpdatePassword(ctx, username, string(hashedPasswordBytes))
+	if err != nil {
+		return userStoreError(err)
+	}
+	return as.refreshTokens.RevokeUserRefreshTokens(ctx, username)
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Access granted by an ACL entry, write access implies read access
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+)
+
+// ACLEntry grants a user or a group access to a sensor
+type ACLEntry struct {
+	User   string `bson:"user,omitempty"`
+	Group  string `bson:"group,omitempty"`
+	Access string `bson:"access"`
+}
+
+// Principal is the user the store operations of a context are performed for
+type Principal struct {
+	User   string   `bson:"user"`
+	Groups []string `bson:"groups,omitempty"`
+	// Admin can read and write every sensor of its tenant, whatever its owner and ACL
+	Admin bool `bson:"admin"`
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context whose store operations only read the sensors the principal can read
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal of the context, nil for anonymous contexts
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	if !ok {
+		return nil
+	}
+	return &principal
+}
+
+// grants tells whether the entry applies to the principal and gives it the access
+func (e ACLEntry) grants(principal *Principal, access string) bool {
+	if access == AccessWrite && e.Access != AccessWrite {
+		return false
+	}
+	if e.User != "" {
+		return e.User == principal.User
+	}
+	for _, group := range principal.Groups {
+		if e.Group == group {
+			return true
+		}
+	}
+	return false
+}
+
+// restricted tells whether the ACL limits who reads the sensor, which it does once it grants read access to someone
+func (s Sensor) restricted() bool {
+	for _, entry := range s.ACL {
+		if entry.Access == AccessRead {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRead tells whether the principal, nil when anonymous, can read the sensor. Sensors whose ACL has no read entry
+// are read by everybody, the others only by their owner and the users and groups of their ACL.
+func (s Sensor) CanRead(principal *Principal) bool {
+	if !s.restricted() {
+		return true
+	}
+	return s.CanWrite(principal) || principal != nil && s.granted(principal, AccessRead)
+}
+
+// CanWrite tells whether the principal, nil when anonymous, can change the sensor. Sensors without owner, such as the
+// ones created before sensors had owners, can be changed by every user allowed to write sensors.
+func (s Sensor) CanWrite(principal *Principal) bool {
+	if principal == nil {
+		return false
+	}
+	return principal.Admin || s.Owner == "" || s.Owner == principal.User || s.granted(principal, AccessWrite)
+}
+
+// IsOwnedBy tells whether the principal owns the sensor or administers it
+func (s Sensor) IsOwnedBy(principal *Principal) bool {
+	if principal == nil {
+		return false
+	}
+	return principal.Admin || s.Owner != "" && s.Owner == principal.User
+}
+
+func (s Sensor) granted(principal *Principal, access string) bool {
+	for _, entry := range s.ACL {
+		if entry.grants(principal, access) {
+			return true
+		}
+	}
+	return false
+}
+
+// readQuery limits the query to the sensors the principal of the context can read, see Sensor.CanRead
+func readQuery(ctx context.Context, query bson.M, prefix string) bson.M {
+	principal := PrincipalFromContext(ctx)
+	if principal != nil && principal.Admin {
+		return query
+	}
+	readable := bson.A{bson.M{prefix + "acl.access": bson.M{"$ne": AccessRead}}}
+	if principal != nil {
+		readable = append(readable,
+			bson.M{prefix + "owner": principal.User},
+			// Sensors without owner, which documents stored before owners existed have no field for
+			bson.M{prefix + "owner": bson.M{"$in": bson.A{"", nil}}},
+			bson.M{prefix + "acl": bson.M{"$elemMatch": bson.M{"user": principal.User}}},
+		)
+		if len(principal.Groups) > 0 {
+			readable = append(readable, bson.M{prefix + "acl": bson.M{"$elemMatch": bson.M{"group": bson.M{"$in": principal.Groups}}}})
+		}
+	}
+	// The query may already have an $or, such as the boxes across the antimeridian
+	query["$and"] = bson.A{bson.M{"$or": readable}}
+	return query
+}
+
+// visibleQuery limits the query to the sensors visible in the context, of its tenant and readable by its principal
+func visibleQuery(ctx context.Context, query bson.M, prefix string) bson.M {
+	return readQuery(ctx, tenantQuery(ctx, query, prefix), prefix)
+}
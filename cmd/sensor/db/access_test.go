@@ -0,0 +1,40 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSensorAccess(t *testing.T) {
+	owner := &Principal{User: "alice"}
+	writer := &Principal{User: "bob"}
+	reader := &Principal{User: "carol", Groups: []string{"team-a"}}
+	other := &Principal{User: "dave"}
+	admin := &Principal{User: "root", Admin: true}
+	sensor := Sensor{Owner: "alice", ACL: []ACLEntry{{User: "bob", Access: AccessWrite}}}
+
+	// Without read entries everybody reads the sensor, only its owner and writers change it
+	require.True(t, sensor.CanRead(nil))
+	require.True(t, sensor.CanRead(other))
+	require.True(t, sensor.CanWrite(owner))
+	require.True(t, sensor.CanWrite(writer))
+	require.True(t, sensor.CanWrite(admin))
+	require.False(t, sensor.CanWrite(other))
+	require.False(t, sensor.CanWrite(nil))
+	require.True(t, sensor.IsOwnedBy(owner))
+	require.False(t, sensor.IsOwnedBy(writer))
+
+	// A read entry restricts the readers
+	sensor.ACL = append(sensor.ACL, ACLEntry{Group: "team-a", Access: AccessRead})
+	require.False(t, sensor.CanRead(nil))
+	require.False(t, sensor.CanRead(other))
+	require.True(t, sensor.CanRead(reader))
+	require.False(t, sensor.CanWrite(reader))
+	require.True(t, sensor.CanRead(writer))
+	require.True(t, sensor.CanRead(admin))
+
+	// Sensors without owner are changed by every writer
+	require.True(t, Sensor{}.CanWrite(other))
+	require.False(t, Sensor{}.IsOwnedBy(other))
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Cluster aggregates the sensors of a geohash cell
+type Cluster struct {
+	Cell   string  `bson:"_id"`
+	Count  int64   `bson:"count"`
+	Lat    float64 `bson:"lat"`
+	Lon    float64 `bson:"lon"`
+	MinLat float64 `bson:"minLat"`
+	MinLon float64 `bson:"minLon"`
+	MaxLat float64 `bson:"maxLat"`
+	MaxLon float64 `bson:"maxLon"`
+	// Sensor is one of the sensors of the cluster, it is the only one when Count is 1
+	Sensor Sensor `bson:"sensor"`
+}
+
+// bboxQuery matches the sensors with a location inside the box
+func bboxQuery(query bson.M, box geo.BBox) bson.M {
+	query["location.lat"] = bson.M{"$gte": box.MinLat, "$lte": box.MaxLat}
+	if box.CrossesAntimeridian() {
+		query["$or"] = bson.A{
+			bson.M{"location.lon": bson.M{"$gte": box.MinLon}},
+			bson.M{"location.lon": bson.M{"$lte": box.MaxLon}},
+		}
+	} else {
+		query["location.lon"] = bson.M{"$gte": box.MinLon, "$lte": box.MaxLon}
+	}
+	return query
+}
+
+// FindInBBox returns up to limit sensors matching the filter with a location inside the box
+func (store *sensorStore) FindInBBox(ctx context.Context, filter SensorFilter, box geo.BBox, limit int64) ([]Sensor, error) {
+	query := visibleQuery(ctx, bboxQuery(filter.toQuery(), box), "")
+	cursor, err := store.sensors.Find(ctx, query, options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	var result []Sensor
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ClusterByCell groups the sensors matching the filter inside the box by geohash cell of the given precision
+func (store *sensorStore) ClusterByCell(ctx context.Context, filter SensorFilter, box geo.BBox, precision int) ([]Cluster, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: visibleQuery(ctx, bboxQuery(filter.toQuery(), box), "")}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    bson.M{"$substrCP": bson.A{"$cell", 0, precision}},
+			"count":  bson.M{"$sum": 1},
+			"lat":    bson.M{"$avg": "$location.lat"},
+			"lon":    bson.M{"$avg": "$location.lon"},
+			"minLat": bson.M{"$min": "$location.lat"},
+			"minLon": bson.M{"$min": "$location.lon"},
+			"maxLat": bson.M{"$max": "$location.lat"},
+			"maxLon": bson.M{"$max": "$location.lon"},
+			"sensor": bson.M{"$first": "$$ROOT"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+	cursor, err := store.sensors.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var result []Cluster
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// coverageCircleSides is the number of sides of the polygon approximating a coverage radius
+const coverageCircleSides = 64
+
+// Coverage is the area where a sensor is effective, either a radius around its location or a polygon
+type Coverage struct {
+	// Radius is in meters
+	Radius float64 `bson:"radius,omitempty"`
+	// Polygon has GeoJSON coordinates, lon first then lat
+	Polygon [][][]float64 `bson:"polygon,omitempty"`
+}
+
+// GeoPolygon is the mongo gis format of a polygon
+type GeoPolygon struct {
+	Type        string        `bson:"type"`
+	Coordinates [][][]float64 `bson:"coordinates"`
+}
+
+func (c *Coverage) toDatabase(location *Location) *GeoPolygon {
+	switch {
+	case c == nil:
+		return nil
+	case len(c.Polygon) > 0:
+		return &GeoPolygon{Type: "Polygon", Coordinates: c.Polygon}
+	case c.Radius > 0 && location != nil:
+		return &GeoPolygon{Type: "Polygon", Coordinates: geo.CirclePolygon(location.Lat, location.Lon, c.Radius, coverageCircleSides)}
+	}
+	return nil
+}
+
+// Contains tells whether the location is covered, exactly for a radius rather than using its polygon
+func (s Sensor) Contains(lat, lon float64) bool {
+	switch {
+	case s.Coverage == nil:
+		return false
+	case len(s.Coverage.Polygon) > 0:
+		return geo.PolygonContains(s.Coverage.Polygon, lon, lat)
+	case s.Location != nil:
+		return geo.Distance(lat, lon, s.Location.Lat, s.Location.Lon) <= s.Coverage.Radius
+	}
+	return false
+}
+
+// FindCovering returns the sensors whose coverage area contains the location
+func (store *sensorStore) FindCovering(ctx context.Context, location Location) ([]Sensor, error) {
+	filter := visibleQuery(ctx, bson.M{"coverageArea": bson.M{"$geoIntersects": bson.M{"$geometry": location.toDatabase()}}}, "")
+	cursor, err := store.sensors.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var result []Sensor
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindCoveringArea returns up to limit sensors whose coverage area intersects the polygon
+func (store *sensorStore) FindCoveringArea(ctx context.Context, polygon [][][]float64, limit int64) ([]Sensor, error) {
+	area := GeoPolygon{Type: "Polygon", Coordinates: polygon}
+	filter := visibleQuery(ctx, bson.M{"coverageArea": bson.M{"$geoIntersects": bson.M{"$geometry": area}}}, "")
+	cursor, err := store.sensors.Find(ctx, filter, options.Find().SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	var result []Sensor
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
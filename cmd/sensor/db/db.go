@@ -3,6 +3,10 @@ package db
 import (
 	"context"
 	"errors"
+	"regexp"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -17,58 +21,198 @@ Points for improvement: */
 // TODO 3 - Have a common mongo.Database object for all stores in the same microservice
 // TODO 4 - Structure errors
 // TODO 5 - Increase test coverage
-// TODO 6 - Add information on insert/update dates, any relevant change history
+// TODO 6 - Add information on insert/update dates, any relevant change history other than locations
 const sensorCollectionName = "sensorMetadata"
 
+// ErrDuplicateName is returned when the tenant already has a sensor with the name
+var ErrDuplicateName = errors.New("a sensor with this name already exists")
+
+// ErrSensorChanged is returned when a conditional update finds that the sensor changed since it was read
+var ErrSensorChanged = errors.New("the sensor changed since it was read")
+
 // Sensor represents a sensor with meta-data
 type Sensor struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty"`
-	Name     string             `bson:"name"`
-	Tags     []string           `bson:"tags"`
-	Location *Location          `bson:"location"`
-	GeoJson  *GeoJson           `bson:"geoJson"`
+	ID primitive.ObjectID `bson:"_id,omitempty"`
+	// Tenant owns the sensor, only the users of the tenant can see it
+	Tenant string `bson:"tenant"`
+	// Owner is the user who created the sensor, it and the ACL decide who reads and changes the sensor
+	Owner    string     `bson:"owner,omitempty"`
+	ACL      []ACLEntry `bson:"acl,omitempty"`
+	Name     string     `bson:"name"`
+	Tags     []string   `bson:"tags"`
+	Type     string     `bson:"type"`
+	Status   string     `bson:"status"`
+	Location *Location  `bson:"location"`
+	// GeoJson is the geometry of the sensor, a point at the location unless it is a line or a polygon
+	GeoJson  *GeoJson `bson:"geoJson"`
+	TimeZone string   `bson:"timeZone,omitempty"`
+	// Attributes are free key value pairs describing the sensor
+	Attributes map[string]string `bson:"attributes"`
+	// Cell is the geohash of the location with maximum precision, its prefixes are the cells of lower precision
+	Cell string `bson:"cell"`
+	// Derived contains the fields computed by the enrichers, indexed by enricher name
+	Derived map[string]interface{} `bson:"derived,omitempty"`
+	// PendingEnrichers lists the enrichers that failed and should be retried later
+	PendingEnrichers []string  `bson:"pendingEnrichers,omitempty"`
+	Coverage         *Coverage `bson:"coverage"`
+	// CoverageArea is the polygon of the coverage, a radius is approximated by a polygon containing its circle
+	CoverageArea *GeoPolygon `bson:"coverageArea"`
 }
 
+// Altitude datums, the reference of an altitude
+const (
+	// DatumWGS84 is the height above the WGS84 ellipsoid, as reported by GPS
+	DatumWGS84 = "WGS84"
+	// DatumMSL is the height above mean sea level
+	DatumMSL = "MSL"
+	// DatumAGL is the height above ground level
+	DatumAGL = "AGL"
+)
+
 // Sensor represents a location with lat and lon
 type Location struct {
 	Lat float64 `bson:"lat"`
 	Lon float64 `bson:"lon"`
-}
-
-// GeoJson is the mongo gis data format
-type GeoJson struct {
-	Point       string    `bson:"type"`
-	Coordinates []float64 `bson:"coordinates"`
+	// Altitude is in meters above the datum
+	Altitude      *float64 `bson:"altitude,omitempty"`
+	AltitudeDatum string   `bson:"altitudeDatum,omitempty"`
+	// Floor is the indoor floor level, 0 being the ground floor
+	Floor *int `bson:"floor,omitempty"`
+	// Accuracy is the radius in meters of the horizontal uncertainty of the position
+	Accuracy float64 `bson:"accuracy,omitempty"`
 }
 
 func (l Location) toDatabase() *GeoJson {
-	// Note that mongo wants lon first then lat
+	// Note that mongo wants lon first then lat, the altitude is an optional third coordinate
+	coordinates := []float64{l.Lon, l.Lat}
+	if l.Altitude != nil {
+		coordinates = append(coordinates, *l.Altitude)
+	}
 	return &GeoJson{
-		Point:       "Point",
-		Coordinates: []float64{l.Lon, l.Lat},
+		Type:        GeometryPoint,
+		Coordinates: coordinates,
 	}
 }
 
 func (s *Sensor) prepareForDatabase() {
+	s.Cell = ""
+	if s.GeoJson.IsPoint() {
+		s.GeoJson = nil
+		if s.Location != nil {
+			s.GeoJson = s.Location.toDatabase()
+		}
+	} else {
+		// Lines and polygons keep their geometry, the location is their representative point
+		s.Location = s.GeoJson.RepresentativePoint(s.Location)
+	}
 	if s.Location != nil {
-		s.GeoJson = s.Location.toDatabase()
+		s.Cell = geo.EncodeGeohash(s.Location.Lat, s.Location.Lon, geo.MaxGeohashPrecision)
+	}
+	s.CoverageArea = s.Coverage.toDatabase(s.Location)
+}
+
+// CellCount is the number of sensors in a geohash cell
+type CellCount struct {
+	Cell  string `bson:"_id"`
+	Count int64  `bson:"count"`
+}
+
+// SensorFilter selects a subset of sensors
+type SensorFilter struct {
+	// Tags lists tags that must all be present on the sensor
+	Tags []string `bson:"tags,omitempty"`
+	// MissingLocation selects only sensors without a location
+	MissingLocation bool `bson:"missingLocation"`
+	// TimeZone selects only sensors in this IANA time zone
+	TimeZone string `bson:"timeZone,omitempty"`
+	Type     string `bson:"type,omitempty"`
+	Status   string `bson:"status,omitempty"`
+	// Attributes lists attributes that must all have the given value
+	Attributes map[string]string `bson:"attributes,omitempty"`
+	// Floor selects only sensors on this floor level
+	Floor *int `bson:"floor,omitempty"`
+	// MinAltitude and MaxAltitude select only sensors with an altitude in the band, in the AltitudeDatum when not empty
+	MinAltitude   *float64 `bson:"minAltitude,omitempty"`
+	MaxAltitude   *float64 `bson:"maxAltitude,omitempty"`
+	AltitudeDatum string   `bson:"altitudeDatum,omitempty"`
+}
+
+func (f SensorFilter) toQuery() bson.M {
+	query := bson.M{}
+	if len(f.Tags) > 0 {
+		query["tags"] = bson.M{"$all": f.Tags}
+	}
+	if f.MissingLocation {
+		query["location"] = nil
+	}
+	if f.TimeZone != "" {
+		query["timeZone"] = f.TimeZone
+	}
+	if f.Type != "" {
+		query["type"] = f.Type
+	}
+	if f.Status != "" {
+		query["status"] = f.Status
 	}
+	for key, value := range f.Attributes {
+		query["attributes."+key] = value
+	}
+	if f.Floor != nil {
+		query["location.floor"] = *f.Floor
+	}
+	if f.MinAltitude != nil || f.MaxAltitude != nil {
+		band := bson.M{}
+		if f.MinAltitude != nil {
+			band["$gte"] = *f.MinAltitude
+		}
+		if f.MaxAltitude != nil {
+			band["$lte"] = *f.MaxAltitude
+		}
+		query["location.altitude"] = band
+	}
+	if f.AltitudeDatum != "" {
+		query["location.altitudeDatum"] = f.AltitudeDatum
+	}
+	return query
+}
+
+// TagCount is the number of sensors with a tag
+type TagCount struct {
+	Tag   string `bson:"_id"`
+	Count int64  `bson:"count"`
 }
 
-// SensorStore represents the public interface of the sensorStore
+// SensorStore represents the public interface of the sensorStore, its operations are limited to the tenant of the context
 type SensorStore interface {
 	Add(ctx context.Context, sensor Sensor) (primitive.ObjectID, error)
 	Update(ctx context.Context, sensor Sensor) error
+	UpdateLocation(ctx context.Context, sensor Sensor, previous *Location) error
 	Delete(ctx context.Context, id primitive.ObjectID) error
+	SetOwner(ctx context.Context, id primitive.ObjectID, owner string) error
+	SetACL(ctx context.Context, id primitive.ObjectID, acl []ACLEntry) error
+	FindTags(ctx context.Context) ([]TagCount, error)
 	FindByID(ctx context.Context, id primitive.ObjectID) (*Sensor, error)
 	FindByName(ctx context.Context, name string) (*Sensor, error)
-	FindNearest(ctx context.Context, location Location) (*Sensor, error)
+	FindNearest(ctx context.Context, location Location, filter SensorFilter, maxDistance float64) (*Sensor, error)
+	FindPage(ctx context.Context, filter SensorFilter, afterID primitive.ObjectID, limit int64) ([]Sensor, error)
+	FindPendingEnrichment(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]Sensor, error)
+	UpdateDerived(ctx context.Context, read Sensor, derived map[string]interface{}, pending []string) error
+	FindByCell(ctx context.Context, cell string, limit int64) ([]Sensor, error)
+	CountByCell(ctx context.Context, within string, precision int) ([]CellCount, error)
+	FindInBBox(ctx context.Context, filter SensorFilter, box geo.BBox, limit int64) ([]Sensor, error)
+	ClusterByCell(ctx context.Context, filter SensorFilter, box geo.BBox, precision int) ([]Cluster, error)
+	FindCovering(ctx context.Context, location Location) ([]Sensor, error)
+	FindCoveringArea(ctx context.Context, polygon [][][]float64, limit int64) ([]Sensor, error)
+	Move(ctx context.Context, sensor Sensor, at time.Time) error
+	FindLocationHistory(ctx context.Context, id primitive.ObjectID) ([]LocationPeriod, error)
+	FindNearestAt(ctx context.Context, location Location, filter SensorFilter, maxDistance float64, at time.Time) (*Sensor, error)
 }
 
 type sensorStore struct {
-	client   *mongo.Client
-	database *mongo.Database
-	sensors  *mongo.Collection
+	client    *mongo.Client
+	database  *mongo.Database
+	sensors   *mongo.Collection
+	locations *mongo.Collection
 }
 
 // NewSensorStore creates a new sensor store
@@ -85,55 +229,225 @@ func NewSensorStore(uri, databaseName string) (*sensorStore, error) {
 	}
 	database := client.Database(databaseName)
 	sensors := database.Collection(sensorCollectionName)
+	// The sensors stored before tenants existed belong to the default tenant
+	_, err = sensors.UpdateMany(ctx, bson.M{"tenant": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"tenant": DefaultTenant}})
+	if err != nil {
+		return nil, err
+	}
+	err = renameDuplicateNames(ctx, sensors)
+	if err != nil {
+		return nil, err
+	}
+	err = backfillCells(ctx, sensors)
+	if err != nil {
+		return nil, err
+	}
 	indexes := []mongo.IndexModel{
 		{
-			Keys:    bson.M{"name": 1},
+			Keys:    bson.D{{Key: "tenant", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "tenant", Value: 1}, {Key: "tags", Value: 1}},
+			Options: nil,
+		},
+		{
+			Keys:    bson.D{{Key: "tenant", Value: 1}, {Key: "owner", Value: 1}},
 			Options: nil,
 		},
+		{
+			Keys:    bson.M{"cell": 1},
+			Options: nil,
+		},
+		{
+			Keys:    bson.D{{Key: "location.lat", Value: 1}, {Key: "location.lon", Value: 1}},
+			Options: nil,
+		},
+		{
+			Keys:    bson.M{"timeZone": 1},
+			Options: nil,
+		},
+		{
+			Keys:    bson.D{{Key: "type", Value: 1}, {Key: "status", Value: 1}},
+			Options: nil,
+		},
+		{
+			Keys:    bson.M{"pendingEnrichers": 1},
+			Options: options.Index().SetSparse(true),
+		},
 		{
 			Keys:    bson.M{"geoJson": "2dsphere"},
 			Options: options.Index().SetSphereVersion(2),
 		},
+		{
+			Keys:    bson.M{"coverageArea": "2dsphere"},
+			Options: options.Index().SetSphereVersion(2),
+		},
 	}
 	_, err = sensors.Indexes().CreateMany(ctx, indexes)
 	if err != nil {
 		return nil, err
 	}
-	return &sensorStore{client: client, database: database, sensors: sensors}, nil
+	locations := database.Collection(sensorLocationCollectionName)
+	_, err = locations.Indexes().CreateMany(ctx, locationIndexes)
+	if err != nil {
+		return nil, err
+	}
+	err = backfillLocationPeriods(ctx, sensors, locations)
+	if err != nil {
+		return nil, err
+	}
+	return &sensorStore{client: client, database: database, sensors: sensors, locations: locations}, nil
 }
 
-// Add adds a new sensor to the store
+// Add adds a new sensor to the tenant of the context, a context of all tenants adds it to the tenant of the sensor. The
+// principal of the context owns the sensor.
 func (store *sensorStore) Add(ctx context.Context, sensor Sensor) (primitive.ObjectID, error) {
 	sensor.prepareForDatabase()
+	if tenant := TenantFromContext(ctx); tenant != AllTenants {
+		sensor.Tenant = tenant
+	}
+	if principal := PrincipalFromContext(ctx); principal != nil {
+		sensor.Owner = principal.User
+	}
 	res, err := store.sensors.InsertOne(ctx, sensor)
+	if mongo.IsDuplicateKeyError(err) {
+		return primitive.NilObjectID, ErrDuplicateName
+	}
 	if err != nil {
 		return primitive.NilObjectID, err
 	}
-	return res.InsertedID.(primitive.ObjectID), nil
+	sensor.ID = res.InsertedID.(primitive.ObjectID)
+	err = store.setCurrentLocation(ctx, sensor)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return sensor.ID, nil
 }
 
-// Update updates an existing sensor in the store
+// Update updates an existing sensor in the store, the sensor keeps its tenant, owner and ACL
 func (store *sensorStore) Update(ctx context.Context, sensor Sensor) error {
 	sensor.prepareForDatabase()
 	if sensor.ID == primitive.NilObjectID {
 		return errors.New("Sensor ID can't be nil")
 	}
+	previous, err := store.FindByID(ctx, sensor.ID)
+	if err != nil {
+		return err
+	}
+	sensor.Tenant, sensor.Owner, sensor.ACL = previous.Tenant, previous.Owner, previous.ACL
 	filter := bson.M{"_id": sensor.ID}
+	_, err = store.sensors.UpdateOne(ctx, filter, sensorUpdate(sensor))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateName
+	}
+	if err != nil {
+		return err
+	}
+	// An update corrects the current location, moves are recorded with Move
+	return store.setCurrentLocation(ctx, sensor)
+}
+
+// sensorUpdate replaces the fields of a sensor. The fields omitted when empty are unset, so that they don't keep the
+// values of the previous version.
+func sensorUpdate(sensor Sensor) bson.M {
 	update := bson.M{"$set": sensor}
-	_, err := store.sensors.UpdateOne(ctx, filter, update)
-	return err
+	if unset := emptyDerivedFields(sensor); len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update
+}
+
+// emptyDerivedFields returns the fields computed from the location that the sensor omits when empty
+func emptyDerivedFields(sensor Sensor) bson.M {
+	unset := bson.M{}
+	if len(sensor.Derived) == 0 {
+		unset["derived"] = ""
+	}
+	if len(sensor.PendingEnrichers) == 0 {
+		unset["pendingEnrichers"] = ""
+	}
+	if sensor.TimeZone == "" {
+		unset["timeZone"] = ""
+	}
+	return unset
+}
+
+// locationUpdate replaces the location of a sensor and the fields computed from it, leaving the other fields untouched
+func locationUpdate(sensor Sensor) bson.M {
+	set := bson.M{
+		"location":     sensor.Location,
+		"geoJson":      sensor.GeoJson,
+		"cell":         sensor.Cell,
+		"coverageArea": sensor.CoverageArea,
+	}
+	unset := emptyDerivedFields(sensor)
+	if _, ok := unset["derived"]; !ok {
+		set["derived"] = sensor.Derived
+	}
+	if _, ok := unset["pendingEnrichers"]; !ok {
+		set["pendingEnrichers"] = sensor.PendingEnrichers
+	}
+	if _, ok := unset["timeZone"]; !ok {
+		set["timeZone"] = sensor.TimeZone
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update
+}
+
+// UpdateLocation changes the location of a sensor and the fields computed from it, only when the sensor is still at the
+// previous location, returning ErrSensorChanged otherwise. Changes made to the other fields meanwhile are kept.
+func (store *sensorStore) UpdateLocation(ctx context.Context, sensor Sensor, previous *Location) error {
+	sensor.prepareForDatabase()
+	filter := visibleQuery(ctx, bson.M{"_id": sensor.ID, "location": previous}, "")
+	res, err := store.sensors.UpdateOne(ctx, filter, locationUpdate(sensor))
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrSensorChanged
+	}
+	return store.setCurrentLocation(ctx, sensor)
 }
 
 // Delete deletes a sensor from the store
 func (store *sensorStore) Delete(ctx context.Context, id primitive.ObjectID) error {
-	filter := bson.M{"_id": id}
-	_, err := store.sensors.DeleteOne(ctx, filter)
+	filter := visibleQuery(ctx, bson.M{"_id": id}, "")
+	res, err := store.sensors.DeleteOne(ctx, filter)
+	if err != nil || res.DeletedCount == 0 {
+		return err
+	}
+	_, err = store.locations.DeleteMany(ctx, bson.M{"sensorId": id})
 	return err
 }
 
+// SetOwner transfers the sensor to a new owner
+func (store *sensorStore) SetOwner(ctx context.Context, id primitive.ObjectID, owner string) error {
+	return store.updateAccess(ctx, id, bson.M{"owner": owner})
+}
+
+// SetACL replaces the ACL of the sensor
+func (store *sensorStore) SetACL(ctx context.Context, id primitive.ObjectID, acl []ACLEntry) error {
+	return store.updateAccess(ctx, id, bson.M{"acl": acl})
+}
+
+func (store *sensorStore) updateAccess(ctx context.Context, id primitive.ObjectID, fields bson.M) error {
+	res, err := store.sensors.UpdateOne(ctx, visibleQuery(ctx, bson.M{"_id": id}, ""), bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
 // FindByID finds a sensor by its ID
 func (store *sensorStore) FindByID(ctx context.Context, id primitive.ObjectID) (*Sensor, error) {
-	filter := bson.M{"_id": id}
+	filter := visibleQuery(ctx, bson.M{"_id": id}, "")
 	var result Sensor
 	err := store.sensors.FindOne(ctx, filter).Decode(&result)
 	if err != nil {
@@ -144,7 +458,7 @@ func (store *sensorStore) FindByID(ctx context.Context, id primitive.ObjectID) (
 
 // FindByName finds a sensor by its name
 func (store *sensorStore) FindByName(ctx context.Context, name string) (*Sensor, error) {
-	filter := bson.M{"name": name}
+	filter := visibleQuery(ctx, bson.M{"name": name}, "")
 	var result Sensor
 	err := store.sensors.FindOne(ctx, filter).Decode(&result)
 	if err != nil {
@@ -153,10 +467,15 @@ func (store *sensorStore) FindByName(ctx context.Context, name string) (*Sensor,
 	return &result, nil
 }
 
-// FindNearest finds the sensor nearest to a location
-func (store *sensorStore) FindNearest(ctx context.Context, location Location) (*Sensor, error) {
+// FindNearest finds the sensor matching the filter nearest to a location, no farther than maxDistance meters when positive
+func (store *sensorStore) FindNearest(ctx context.Context, location Location, sensorFilter SensorFilter, maxDistance float64) (*Sensor, error) {
 	loc := location.toDatabase()
-	filter := bson.M{"geoJson": bson.M{"$near": bson.M{"$geometry": loc}}}
+	near := bson.M{"$geometry": loc}
+	if maxDistance > 0 {
+		near["$maxDistance"] = maxDistance
+	}
+	filter := visibleQuery(ctx, sensorFilter.toQuery(), "")
+	filter["geoJson"] = bson.M{"$near": near}
 	var result Sensor
 	err := store.sensors.FindOne(ctx, filter).Decode(&result)
 	if err != nil {
@@ -164,3 +483,126 @@ func (store *sensorStore) FindNearest(ctx context.Context, location Location) (*
 	}
 	return &result, nil
 }
+
+// FindPage returns up to limit sensors matching the filter with an ID greater than afterID, ordered by ID
+func (store *sensorStore) FindPage(ctx context.Context, filter SensorFilter, afterID primitive.ObjectID, limit int64) ([]Sensor, error) {
+	query := visibleQuery(ctx, filter.toQuery(), "")
+	if afterID != primitive.NilObjectID {
+		query["_id"] = bson.M{"$gt": afterID}
+	}
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit)
+	cursor, err := store.sensors.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	var result []Sensor
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindPendingEnrichment returns up to limit sensors with enrichers waiting to be retried with an ID greater than
+// afterID, ordered by ID, so that the retries go through all of them
+func (store *sensorStore) FindPendingEnrichment(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]Sensor, error) {
+	filter := visibleQuery(ctx, bson.M{"pendingEnrichers.0": bson.M{"$exists": true}}, "")
+	if afterID != primitive.NilObjectID {
+		filter["_id"] = bson.M{"$gt": afterID}
+	}
+	cursor, err := store.sensors.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	var result []Sensor
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UpdateDerived replaces only the derived fields and the pending enrichers of a sensor, when its location and pending
+// enrichers are still those it was read with, returning ErrSensorChanged otherwise. A sensor written meanwhile had its
+// fields derived again.
+func (store *sensorStore) UpdateDerived(ctx context.Context, read Sensor, derived map[string]interface{}, pending []string) error {
+	query := bson.M{"_id": read.ID, "location": read.Location, "pendingEnrichers": read.PendingEnrichers}
+	if len(read.PendingEnrichers) == 0 {
+		query["pendingEnrichers"] = nil
+	}
+	update := bson.M{"$set": bson.M{"derived": derived, "pendingEnrichers": pending}}
+	res, err := store.sensors.UpdateOne(ctx, visibleQuery(ctx, query, ""), update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrSensorChanged
+	}
+	return nil
+}
+
+// cellQuery matches the sensors inside a geohash cell, using the index on cell as the regex is anchored
+func cellQuery(cell string) bson.M {
+	return bson.M{"cell": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(cell)}}
+}
+
+// FindByCell returns up to limit sensors inside a geohash cell, ordered by cell
+func (store *sensorStore) FindByCell(ctx context.Context, cell string, limit int64) ([]Sensor, error) {
+	opts := options.Find().SetSort(bson.M{"cell": 1}).SetLimit(limit)
+	cursor, err := store.sensors.Find(ctx, visibleQuery(ctx, cellQuery(cell), ""), opts)
+	if err != nil {
+		return nil, err
+	}
+	var result []Sensor
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CountByCell counts the sensors per geohash cell of the given precision, only inside the within cell when not empty
+func (store *sensorStore) CountByCell(ctx context.Context, within string, precision int) ([]CellCount, error) {
+	match := cellQuery(within)
+	if within == "" {
+		match = bson.M{"cell": bson.M{"$gt": ""}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: visibleQuery(ctx, match, "")}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$substrCP": bson.A{"$cell", 0, precision}},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+	cursor, err := store.sensors.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var result []CellCount
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindTags returns the tags of the sensors with the number of sensors having each of them, ordered by tag
+func (store *sensorStore) FindTags(ctx context.Context) ([]TagCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: visibleQuery(ctx, bson.M{}, "")}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+	cursor, err := store.sensors.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var result []TagCount
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
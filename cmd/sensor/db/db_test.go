@@ -6,8 +6,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -156,18 +158,70 @@ func TestFindNearest(t *testing.T) {
 		_, err = s.Add(ctx, sensor)
 		require.NoError(t, err)
 	}
-	sensor, err := s.FindNearest(ctx, Location{Lat: 34, Lon: 45})
+	sensor, err := s.FindNearest(ctx, Location{Lat: 34, Lon: 45}, SensorFilter{}, 0)
 	require.NoError(t, err)
 	require.Equal(t, sensors[1].Name, sensor.Name)
-	sensor, err = s.FindNearest(ctx, Location{Lat: 34, Lon: -74})
+	sensor, err = s.FindNearest(ctx, Location{Lat: 34, Lon: -74}, SensorFilter{}, 0)
 	require.NoError(t, err)
 	require.Equal(t, sensors[0].Name, sensor.Name)
-	sensor, err = s.FindNearest(ctx, Location{Lat: 36.1627, Lon: -86.7816})
+	sensor, err = s.FindNearest(ctx, Location{Lat: 36.1627, Lon: -86.7816}, SensorFilter{}, 0)
 	require.NoError(t, err)
 	require.Equal(t, sensors[2].Name, sensor.Name)
 
 }
 
+func TestFindNearestFiltered(t *testing.T) {
+	var s SensorStore
+	var err error
+	sensors := []Sensor{
+		{
+			Name:       "Thermometer Washington",
+			Tags:       []string{"Tag1"},
+			Type:       "temperature",
+			Status:     "active",
+			Attributes: map[string]string{"vendor": "acme"},
+			Location:   &Location{Lat: 38.9072, Lon: -77.0369},
+		},
+		{
+			Name:     "Thermometer NY",
+			Tags:     []string{"Tag1"},
+			Type:     "temperature",
+			Status:   "inactive",
+			Location: &Location{Lat: 40.7128, Lon: -74.0060},
+		},
+		{
+			Name:     "Barometer NY",
+			Tags:     []string{"Tag1"},
+			Type:     "pressure",
+			Status:   "active",
+			Location: &Location{Lat: 40.7128, Lon: -74.0061},
+		},
+	}
+	s, err = NewSensorStore(`mongodb://localhost:27017`, "sensors"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	defer func() {
+		_, err = s.(*sensorStore).sensors.DeleteMany(context.Background(), bson.D{})
+		require.NoError(t, err)
+	}()
+	ctx := context.Background()
+	for i := range sensors {
+		_, err = s.Add(ctx, sensors[i])
+		require.NoError(t, err)
+	}
+	newYork := Location{Lat: 40.7, Lon: -74}
+	sensor, err := s.FindNearest(ctx, newYork, SensorFilter{Type: "temperature"}, 0)
+	require.NoError(t, err)
+	require.Equal(t, "Thermometer NY", sensor.Name)
+	sensor, err = s.FindNearest(ctx, newYork, SensorFilter{Type: "temperature", Status: "active"}, 0)
+	require.NoError(t, err)
+	require.Equal(t, "Thermometer Washington", sensor.Name)
+	sensor, err = s.FindNearest(ctx, newYork, SensorFilter{Attributes: map[string]string{"vendor": "acme"}}, 0)
+	require.NoError(t, err)
+	require.Equal(t, "Thermometer Washington", sensor.Name)
+	_, err = s.FindNearest(ctx, newYork, SensorFilter{Type: "temperature", Status: "active"}, 100000)
+	require.ErrorIs(t, err, mongo.ErrNoDocuments)
+}
+
 func workerRoutine(ch chan bool) {
 
 	a := true
@@ -209,3 +263,458 @@ func TestGoRoutine(t *testing.T) {
 	print(c.String())
 
 }
+
+func TestFindPage(t *testing.T) {
+	var s SensorStore
+	var err error
+	sensors := []Sensor{
+		{Name: "Sensor 1", Tags: []string{"Tag1", "Tag2"}},
+		{Name: "Sensor 2", Tags: []string{"Tag1"}, Location: &Location{Lat: 55, Lon: 44}},
+		{Name: "Sensor 3", Tags: []string{"Tag1", "Tag2"}},
+		{Name: "Sensor 4", Tags: []string{"Tag2"}},
+	}
+	s, err = NewSensorStore(`mongodb://localhost:27017`, "sensors"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	defer func() {
+		_, err = s.(*sensorStore).sensors.DeleteMany(context.Background(), bson.D{})
+		require.NoError(t, err)
+	}()
+	ctx := context.Background()
+	for i := range sensors {
+		_, err = s.Add(ctx, sensors[i])
+		require.NoError(t, err)
+	}
+	filter := SensorFilter{Tags: []string{"Tag1"}, MissingLocation: true}
+	page, err := s.FindPage(ctx, filter, primitive.NilObjectID, 1)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	require.Equal(t, "Sensor 1", page[0].Name)
+	page, err = s.FindPage(ctx, filter, page[0].ID, 10)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	require.Equal(t, "Sensor 3", page[0].Name)
+	page, err = s.FindPage(ctx, filter, page[0].ID, 10)
+	require.NoError(t, err)
+	require.Empty(t, page)
+}
+
+func TestCells(t *testing.T) {
+	var s SensorStore
+	var err error
+	sensors := []Sensor{
+		{Name: "Sensor Paris", Location: &Location{Lat: 48.8566, Lon: 2.3522}},
+		{Name: "Sensor Versailles", Location: &Location{Lat: 48.8049, Lon: 2.1204}},
+		{Name: "Sensor London", Location: &Location{Lat: 51.5072, Lon: -0.1276}},
+		{Name: "Sensor Nowhere"},
+	}
+	s, err = NewSensorStore(`mongodb://localhost:27017`, "sensors"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	defer func() {
+		_, err = s.(*sensorStore).sensors.DeleteMany(context.Background(), bson.D{})
+		require.NoError(t, err)
+	}()
+	ctx := context.Background()
+	for i := range sensors {
+		_, err = s.Add(ctx, sensors[i])
+		require.NoError(t, err)
+	}
+	found, err := s.FindByCell(ctx, "u09", 10)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, "u09tvw0f64r7", found[1].Cell)
+	counts, err := s.CountByCell(ctx, "", 1)
+	require.NoError(t, err)
+	require.Equal(t, []CellCount{{Cell: "g", Count: 1}, {Cell: "u", Count: 2}}, counts)
+	counts, err = s.CountByCell(ctx, "u09", 4)
+	require.NoError(t, err)
+	require.Equal(t, []CellCount{{Cell: "u09t", Count: 2}}, counts)
+}
+
+func TestCovering(t *testing.T) {
+	var s SensorStore
+	var err error
+	sensors := []Sensor{
+		{Name: "Radio", Location: &Location{Lat: 48.8566, Lon: 2.3522}, Coverage: &Coverage{Radius: 2000}},
+		{Name: "Camera", Location: &Location{Lat: 48.86, Lon: 2.36}, Coverage: &Coverage{
+			Polygon: [][][]float64{{{2.35, 48.85}, {2.39, 48.85}, {2.39, 48.87}, {2.35, 48.87}, {2.35, 48.85}}},
+		}},
+		{Name: "Thermometer", Location: &Location{Lat: 48.8566, Lon: 2.3522}},
+	}
+	s, err = NewSensorStore(`mongodb://localhost:27017`, "sensors"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	defer func() {
+		_, err = s.(*sensorStore).sensors.DeleteMany(context.Background(), bson.D{})
+		require.NoError(t, err)
+	}()
+	ctx := context.Background()
+	for i := range sensors {
+		_, err = s.Add(ctx, sensors[i])
+		require.NoError(t, err)
+	}
+	found, err := s.FindCovering(ctx, Location{Lat: 48.86, Lon: 2.36})
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	found, err = s.FindCovering(ctx, Location{Lat: 48.84, Lon: 2.3522})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "Radio", found[0].Name)
+	found, err = s.FindCoveringArea(ctx, [][][]float64{{{2.38, 48.865}, {2.5, 48.865}, {2.5, 48.9}, {2.38, 48.9}, {2.38, 48.865}}}, 10)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "Camera", found[0].Name)
+}
+
+func TestFindNearestGeometry(t *testing.T) {
+	var s SensorStore
+	var err error
+	sensors := []Sensor{
+		{Name: "Point", Location: &Location{Lat: 0, Lon: 0.5}},
+		// The cable runs north at 1 degree of longitude, its representative point is far from the query
+		{Name: "Cable", GeoJson: &GeoJson{Type: GeometryLineString, Line: [][]float64{{1, -10}, {1, 10}}}},
+	}
+	s, err = NewSensorStore(`mongodb://localhost:27017`, "sensors"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	defer func() {
+		_, err = s.(*sensorStore).sensors.DeleteMany(context.Background(), bson.D{})
+		require.NoError(t, err)
+	}()
+	ctx := context.Background()
+	for i := range sensors {
+		_, err = s.Add(ctx, sensors[i])
+		require.NoError(t, err)
+	}
+	sensor, err := s.FindNearest(ctx, Location{Lat: 5, Lon: 0.9}, SensorFilter{}, 0)
+	require.NoError(t, err)
+	require.Equal(t, "Cable", sensor.Name)
+	require.Equal(t, [][]float64{{1, -10}, {1, 10}}, sensor.GeoJson.Line)
+	require.InDelta(t, 0, sensor.Location.Lat, 1e-6)
+}
+
+func TestLocationHistory(t *testing.T) {
+	var s SensorStore
+	var err error
+	s, err = NewSensorStore(`mongodb://localhost:27017`, "sensors"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	defer func() {
+		_, err = s.(*sensorStore).sensors.DeleteMany(context.Background(), bson.D{})
+		require.NoError(t, err)
+		_, err = s.(*sensorStore).locations.DeleteMany(context.Background(), bson.D{})
+		require.NoError(t, err)
+	}()
+	ctx := context.Background()
+	before := time.Now().UTC().Add(-time.Second)
+	id, err := s.Add(ctx, Sensor{Name: "Mobile", Tags: []string{"Tag1"}, Location: &Location{Lat: 0, Lon: 0}})
+	require.NoError(t, err)
+	_, err = s.Add(ctx, Sensor{Name: "Fixed", Tags: []string{"Tag1"}, Location: &Location{Lat: 0, Lon: 1}})
+	require.NoError(t, err)
+	moved := time.Now().UTC().Add(time.Second)
+	err = s.Move(ctx, Sensor{ID: id, Name: "Mobile", Tags: []string{"Tag1"}, Location: &Location{Lat: 0, Lon: 2}}, moved)
+	require.NoError(t, err)
+	err = s.Move(ctx, Sensor{ID: id, Name: "Mobile", Location: &Location{Lat: 0, Lon: 3}}, before)
+	require.ErrorIs(t, err, ErrMoveBeforeCurrent)
+
+	history, err := s.FindLocationHistory(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, Location{Lat: 0, Lon: 0}, *history[0].Location)
+	require.WithinDuration(t, moved, *history[0].ValidTo, time.Millisecond)
+	require.Equal(t, Location{Lat: 0, Lon: 2}, *history[1].Location)
+	require.Nil(t, history[1].ValidTo)
+
+	// Before the move the mobile sensor was the nearest to the origin, after it the fixed one is
+	sensor, err := s.FindNearestAt(ctx, Location{Lat: 0, Lon: 0}, SensorFilter{Tags: []string{"Tag1"}}, 0, moved.Add(-time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, "Mobile", sensor.Name)
+	require.Equal(t, Location{Lat: 0, Lon: 0}, *sensor.Location)
+	sensor, err = s.FindNearestAt(ctx, Location{Lat: 0, Lon: 0}, SensorFilter{}, 0, moved.Add(time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, "Fixed", sensor.Name)
+	_, err = s.FindNearestAt(ctx, Location{Lat: 0, Lon: 0}, SensorFilter{}, 0, before.Add(-time.Hour))
+	require.ErrorIs(t, err, mongo.ErrNoDocuments)
+
+	// Removing the location ends the current period
+	require.NoError(t, s.Update(ctx, Sensor{ID: id, Name: "Mobile", Tags: []string{"Tag1"}}))
+	history, err = s.FindLocationHistory(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.NotNil(t, history[1].ValidTo)
+	sensor, err = s.FindNearestAt(ctx, Location{Lat: 0, Lon: 2}, SensorFilter{}, 0, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, "Fixed", sensor.Name)
+}
+
+func TestBackfillLocationPeriods(t *testing.T) {
+	ctx := context.Background()
+	database := "sensors" + primitive.NewObjectID().Hex()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(`mongodb://localhost:27017`))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, client.Database(database).Drop(ctx))
+		require.NoError(t, client.Disconnect(ctx))
+	}()
+	// Sensors stored before the location history existed
+	located := Sensor{ID: primitive.NewObjectID(), Tenant: DefaultTenant, Name: "Located", Location: &Location{Lat: 1, Lon: 1}}
+	located.prepareForDatabase()
+	_, err = client.Database(database).Collection(sensorCollectionName).InsertMany(ctx, []interface{}{
+		located,
+		Sensor{ID: primitive.NewObjectID(), Tenant: DefaultTenant, Name: "Unlocated"},
+	})
+	require.NoError(t, err)
+
+	s, err := NewSensorStore(`mongodb://localhost:27017`, database)
+	require.NoError(t, err)
+	sensor, err := s.FindNearestAt(ctx, Location{Lat: 0, Lon: 0}, SensorFilter{}, 0, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, "Located", sensor.Name)
+	history, err := s.FindLocationHistory(ctx, located.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.Equal(t, located.ID.Timestamp().UTC(), history[0].ValidFrom)
+
+	// The periods are only added once
+	_, err = NewSensorStore(`mongodb://localhost:27017`, database)
+	require.NoError(t, err)
+	history, err = s.FindLocationHistory(ctx, located.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+}
+
+func TestBackfillCells(t *testing.T) {
+	ctx := context.Background()
+	database := "sensors" + primitive.NewObjectID().Hex()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(`mongodb://localhost:27017`))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, client.Database(database).Drop(ctx))
+		require.NoError(t, client.Disconnect(ctx))
+	}()
+	// Sensors stored before the cell existed
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+	_, err = client.Database(database).Collection(sensorCollectionName).InsertMany(ctx, []interface{}{
+		bson.M{"_id": ids[0], "tenant": DefaultTenant, "name": "Located", "location": bson.M{"lat": 48.8584, "lon": 2.2945}},
+		bson.M{"_id": ids[1], "tenant": DefaultTenant, "name": "Unlocated"},
+	})
+	require.NoError(t, err)
+
+	s, err := NewSensorStore(`mongodb://localhost:27017`, database)
+	require.NoError(t, err)
+	sensor, err := s.FindByID(ctx, ids[0])
+	require.NoError(t, err)
+	require.Equal(t, geo.EncodeGeohash(48.8584, 2.2945, geo.MaxGeohashPrecision), sensor.Cell)
+	sensors, err := s.FindByCell(ctx, "u09", 10)
+	require.NoError(t, err)
+	require.Len(t, sensors, 1)
+	sensor, err = s.FindByID(ctx, ids[1])
+	require.NoError(t, err)
+	require.Empty(t, sensor.Cell)
+}
+
+func TestPendingEnrichment(t *testing.T) {
+	s, err := NewSensorStore(`mongodb://localhost:27017`, "sensors"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	defer func() {
+		_, err = s.sensors.DeleteMany(context.Background(), bson.D{})
+		require.NoError(t, err)
+	}()
+	ctx := context.Background()
+	var ids []primitive.ObjectID
+	for _, name := range []string{"Sensor 1", "Sensor 2", "Sensor 3"} {
+		id, err := s.Add(ctx, Sensor{Name: name, Derived: map[string]interface{}{"region": "Paris"}, PendingEnrichers: []string{"timezone"}})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	// The retries go through the pending sensors page by page
+	page, err := s.FindPendingEnrichment(ctx, primitive.NilObjectID, 2)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	require.Equal(t, ids[0], page[0].ID)
+	page, err = s.FindPendingEnrichment(ctx, page[1].ID, 2)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	require.Equal(t, ids[2], page[0].ID)
+
+	// An update without derived fields nor pending enrichers doesn't keep those of the previous version
+	require.NoError(t, s.Update(ctx, Sensor{ID: ids[0], Name: "Sensor 1"}))
+	sensor, err := s.FindByID(ctx, ids[0])
+	require.NoError(t, err)
+	require.Nil(t, sensor.Derived)
+	require.Nil(t, sensor.PendingEnrichers)
+	page, err = s.FindPendingEnrichment(ctx, primitive.NilObjectID, 10)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+
+	// The retried fields are only stored when the sensor did not change since it was read
+	require.NoError(t, s.UpdateDerived(ctx, page[0], map[string]interface{}{"region": "Paris", "timezone": "CET"}, nil))
+	require.NoError(t, s.Update(ctx, Sensor{ID: page[1].ID, Name: "Sensor 3", PendingEnrichers: []string{"region"}}))
+	require.ErrorIs(t, s.UpdateDerived(ctx, page[1], map[string]interface{}{"timezone": "CET"}, nil), ErrSensorChanged)
+	sensor, err = s.FindByID(ctx, page[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"region"}, sensor.PendingEnrichers)
+}
+
+func TestSensorUpdate(t *testing.T) {
+	sensor := Sensor{Name: "Sensor 1"}
+	require.Equal(t, bson.M{"$set": sensor, "$unset": bson.M{"derived": "", "pendingEnrichers": "", "timeZone": ""}}, sensorUpdate(sensor))
+	sensor.Derived = map[string]interface{}{"region": "Paris"}
+	sensor.PendingEnrichers = []string{"timezone"}
+	sensor.TimeZone = "Europe/Paris"
+	require.Equal(t, bson.M{"$set": sensor}, sensorUpdate(sensor))
+}
+
+func TestLocationUpdate(t *testing.T) {
+	sensor := Sensor{Name: "Sensor 1", Location: &Location{Lat: 1, Lon: 2}}
+	sensor.prepareForDatabase()
+	update := locationUpdate(sensor)
+	require.Equal(t, bson.M{"derived": "", "pendingEnrichers": "", "timeZone": ""}, update["$unset"])
+	require.NotContains(t, update["$set"], "name")
+	require.Equal(t, sensor.Cell, update["$set"].(bson.M)["cell"])
+	sensor.TimeZone = "Europe/Paris"
+	update = locationUpdate(sensor)
+	require.Equal(t, "Europe/Paris", update["$set"].(bson.M)["timeZone"])
+	require.Equal(t, bson.M{"derived": "", "pendingEnrichers": ""}, update["$unset"])
+}
+
+func TestUpdateLocation(t *testing.T) {
+	s, err := NewSensorStore(`mongodb://localhost:27017`, "sensors"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.database.Drop(context.Background()))
+	}()
+	ctx := context.Background()
+	id, err := s.Add(ctx, Sensor{Name: "Sensor 1"})
+	require.NoError(t, err)
+	read, err := s.FindByID(ctx, id)
+	require.NoError(t, err)
+	// The sensor is renamed while its location is being resolved
+	renamed := *read
+	renamed.Name = "Renamed"
+	require.NoError(t, s.Update(ctx, renamed))
+
+	located := *read
+	located.Location = &Location{Lat: 48.85, Lon: 2.35}
+	require.NoError(t, s.UpdateLocation(ctx, located, read.Location))
+	sensor, err := s.FindByID(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "Renamed", sensor.Name)
+	require.Equal(t, located.Location, sensor.Location)
+	require.NotEmpty(t, sensor.Cell)
+	history, err := s.FindLocationHistory(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+
+	// A sensor moved meanwhile keeps its new location
+	require.ErrorIs(t, s.UpdateLocation(ctx, located, read.Location), ErrSensorChanged)
+}
+
+func TestTenants(t *testing.T) {
+	s, err := NewSensorStore(`mongodb://localhost:27017`, "sensors"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	defer func() {
+		_, err = s.sensors.DeleteMany(context.Background(), bson.D{})
+		require.NoError(t, err)
+	}()
+	acme := WithTenant(context.Background(), "acme")
+	globex := WithTenant(context.Background(), "globex")
+	all := WithTenant(context.Background(), AllTenants)
+	id, err := s.Add(acme, Sensor{Name: "Sensor 1", Tags: []string{"Tag1", "Tag2"}, Location: &Location{Lat: 0, Lon: 0}})
+	require.NoError(t, err)
+	// Names are unique per tenant
+	_, err = s.Add(acme, Sensor{Name: "Sensor 1"})
+	require.ErrorIs(t, err, ErrDuplicateName)
+	_, err = s.Add(globex, Sensor{Name: "Sensor 1", Tags: []string{"Tag1"}, Location: &Location{Lat: 0, Lon: 1}})
+	require.NoError(t, err)
+
+	// A tenant doesn't see the sensors of the others
+	_, err = s.FindByID(globex, id)
+	require.ErrorIs(t, err, mongo.ErrNoDocuments)
+	sensor, err := s.FindByName(globex, "Sensor 1")
+	require.NoError(t, err)
+	require.Equal(t, "globex", sensor.Tenant)
+	sensor, err = s.FindNearest(globex, Location{Lat: 0, Lon: 0}, SensorFilter{}, 0)
+	require.NoError(t, err)
+	require.Equal(t, "globex", sensor.Tenant)
+	require.ErrorIs(t, s.Update(globex, Sensor{ID: id, Name: "Stolen"}), mongo.ErrNoDocuments)
+	require.NoError(t, s.Delete(globex, id))
+	_, err = s.FindByID(acme, id)
+	require.NoError(t, err)
+	tags, err := s.FindTags(globex)
+	require.NoError(t, err)
+	require.Equal(t, []TagCount{{Tag: "Tag1", Count: 1}}, tags)
+
+	// All tenants see every sensor, and updates keep the tenant of the sensor
+	tags, err = s.FindTags(all)
+	require.NoError(t, err)
+	require.Equal(t, []TagCount{{Tag: "Tag1", Count: 2}, {Tag: "Tag2", Count: 1}}, tags)
+	require.NoError(t, s.Update(all, Sensor{ID: id, Name: "Sensor 2"}))
+	sensor, err = s.FindByName(acme, "Sensor 2")
+	require.NoError(t, err)
+	require.Equal(t, "acme", sensor.Tenant)
+}
+
+func TestRenameDuplicateNames(t *testing.T) {
+	ctx := context.Background()
+	database := "sensors" + primitive.NewObjectID().Hex()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(`mongodb://localhost:27017`))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, client.Database(database).Drop(ctx))
+		require.NoError(t, client.Disconnect(ctx))
+	}()
+	// Sensors stored before names were unique per tenant
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+	_, err = client.Database(database).Collection("sensors").InsertMany(ctx, []interface{}{
+		bson.M{"_id": ids[0], "name": "Sensor 1"},
+		bson.M{"_id": ids[1], "name": "Sensor 1"},
+		bson.M{"_id": ids[2], "name": "Sensor 1", "tenant": "acme"},
+		bson.M{"_id": ids[3], "name": "Sensor 1"},
+	})
+	require.NoError(t, err)
+
+	// Without renaming them the unique index can't be created
+	s, err := NewSensorStore(`mongodb://localhost:27017`, database)
+	require.NoError(t, err)
+	for i, name := range []string{"Sensor 1", duplicateName("Sensor 1", ids[1]), "Sensor 1", duplicateName("Sensor 1", ids[3])} {
+		sensor, err := s.FindByID(WithTenant(ctx, AllTenants), ids[i])
+		require.NoError(t, err)
+		require.Equal(t, name, sensor.Name)
+	}
+	_, err = s.Add(ctx, Sensor{Name: "Sensor 1"})
+	require.ErrorIs(t, err, ErrDuplicateName)
+}
+
+func TestSensorACL(t *testing.T) {
+	s, err := NewSensorStore(`mongodb://localhost:27017`, "sensors"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	defer func() {
+		_, err = s.sensors.DeleteMany(context.Background(), bson.D{})
+		require.NoError(t, err)
+	}()
+	alice := WithPrincipal(context.Background(), Principal{User: "alice"})
+	carol := WithPrincipal(context.Background(), Principal{User: "carol", Groups: []string{"team-a"}})
+	dave := WithPrincipal(context.Background(), Principal{User: "dave"})
+	anonymous := context.Background()
+	id, err := s.Add(alice, Sensor{Name: "Sensor 1", Tags: []string{"Tag1"}})
+	require.NoError(t, err)
+	sensor, err := s.FindByID(dave, id)
+	require.NoError(t, err)
+	require.Equal(t, "alice", sensor.Owner)
+
+	// Once the ACL grants read access only the owner and the ACL read the sensor
+	require.NoError(t, s.SetACL(alice, id, []ACLEntry{{Group: "team-a", Access: AccessRead}}))
+	_, err = s.FindByID(carol, id)
+	require.NoError(t, err)
+	_, err = s.FindByID(dave, id)
+	require.ErrorIs(t, err, mongo.ErrNoDocuments)
+	page, err := s.FindPage(anonymous, SensorFilter{}, primitive.NilObjectID, 10)
+	require.NoError(t, err)
+	require.Empty(t, page)
+
+	// Updates keep the owner and the ACL
+	require.NoError(t, s.Update(alice, Sensor{ID: id, Name: "Sensor 2"}))
+	require.NoError(t, s.SetOwner(alice, id, "carol"))
+	sensor, err = s.FindByID(carol, id)
+	require.NoError(t, err)
+	require.Equal(t, "carol", sensor.Owner)
+	require.Equal(t, "Sensor 2", sensor.Name)
+	require.Len(t, sensor.ACL, 1)
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Geometry types of a sensor
+const (
+	GeometryPoint      = "Point"
+	GeometryLineString = "LineString"
+	GeometryPolygon    = "Polygon"
+)
+
+// GeoJson is the mongo gis data format. Only the coordinates of its type are set, they are all stored as coordinates.
+type GeoJson struct {
+	Type string
+	// Coordinates of a Point
+	Coordinates []float64
+	// Line has the coordinates of a LineString
+	Line [][]float64
+	// Polygon has the coordinates of a Polygon
+	Polygon [][][]float64
+}
+
+type rawGeoJson struct {
+	Type        string        `bson:"type"`
+	Coordinates bson.RawValue `bson:"coordinates"`
+}
+
+// MarshalBSON stores the coordinates of the type of the geometry
+func (g GeoJson) MarshalBSON() ([]byte, error) {
+	var coordinates interface{}
+	switch g.Type {
+	case GeometryLineString:
+		coordinates = g.Line
+	case GeometryPolygon:
+		coordinates = g.Polygon
+	default:
+		coordinates = g.Coordinates
+	}
+	return bson.Marshal(bson.D{{Key: "type", Value: g.Type}, {Key: "coordinates", Value: coordinates}})
+}
+
+// UnmarshalBSON reads the coordinates according to the type of the geometry
+func (g *GeoJson) UnmarshalBSON(data []byte) error {
+	var raw rawGeoJson
+	err := bson.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	*g = GeoJson{Type: raw.Type}
+	switch raw.Type {
+	case GeometryPoint:
+		return raw.Coordinates.Unmarshal(&g.Coordinates)
+	case GeometryLineString:
+		return raw.Coordinates.Unmarshal(&g.Line)
+	case GeometryPolygon:
+		return raw.Coordinates.Unmarshal(&g.Polygon)
+	}
+	return fmt.Errorf("unsupported geometry %s", raw.Type)
+}
+
+// IsPoint reports whether the geometry is absent or a point, which are both represented by the location
+func (g *GeoJson) IsPoint() bool {
+	return g == nil || g.Type == GeometryPoint
+}
+
+// RepresentativePoint returns a point on a line or inside a polygon, with the altitude, floor and accuracy of level when not nil
+func (g *GeoJson) RepresentativePoint(level *Location) *Location {
+	var lat, lon float64
+	switch {
+	case g.Type == GeometryLineString && len(g.Line) > 0:
+		lat, lon = geo.LineMidpoint(g.Line)
+	case g.Type == GeometryPolygon && len(g.Polygon) > 0 && len(g.Polygon[0]) > 0:
+		lat, lon = geo.PolygonRepresentativePoint(g.Polygon)
+	default:
+		return nil
+	}
+	point := &Location{Lat: lat, Lon: lon}
+	if level != nil {
+		point.Altitude = level.Altitude
+		point.AltitudeDatum = level.AltitudeDatum
+		point.Floor = level.Floor
+		point.Accuracy = level.Accuracy
+	}
+	return point
+}
+
+// DistanceTo returns the distance in meters from the geometry of the sensor to the location, or -1 without a location
+func (s Sensor) DistanceTo(lat, lon float64) float64 {
+	if s.GeoJson != nil {
+		switch s.GeoJson.Type {
+		case GeometryLineString:
+			return geo.DistanceToLine(s.GeoJson.Line, lat, lon)
+		case GeometryPolygon:
+			return geo.DistanceToPolygon(s.GeoJson.Polygon, lat, lon)
+		}
+	}
+	if s.Location != nil {
+		return geo.Distance(lat, lon, s.Location.Lat, s.Location.Lon)
+	}
+	return -1
+}
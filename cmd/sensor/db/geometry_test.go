@@ -0,0 +1,59 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGeoJsonBSON(t *testing.T) {
+	for _, geometry := range []*GeoJson{
+		{Type: GeometryPoint, Coordinates: []float64{2.35, 48.85}},
+		{Type: GeometryLineString, Line: [][]float64{{2.35, 48.85}, {2.36, 48.86}}},
+		{Type: GeometryPolygon, Polygon: [][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}},
+		nil,
+	} {
+		data, err := bson.Marshal(Sensor{Name: "Sensor", GeoJson: geometry})
+		require.NoError(t, err)
+		var raw bson.M
+		require.NoError(t, bson.Unmarshal(data, &raw))
+		if geometry != nil {
+			require.Equal(t, geometry.Type, raw["geoJson"].(bson.M)["type"])
+			require.Contains(t, raw["geoJson"], "coordinates")
+		} else {
+			require.Nil(t, raw["geoJson"])
+		}
+		var sensor Sensor
+		require.NoError(t, bson.Unmarshal(data, &sensor))
+		require.Equal(t, geometry, sensor.GeoJson)
+	}
+}
+
+func TestPrepareGeometry(t *testing.T) {
+	line := Sensor{GeoJson: &GeoJson{Type: GeometryLineString, Line: [][]float64{{0, 0}, {0, 2}}}}
+	line.prepareForDatabase()
+	require.InDelta(t, 1, line.Location.Lat, 1e-6)
+	require.Equal(t, GeometryLineString, line.GeoJson.Type)
+	require.NotEmpty(t, line.Cell)
+	require.InDelta(t, geo.Distance(1, 1, 1, 0), line.DistanceTo(1, 1), 1)
+
+	point := Sensor{Location: &Location{Lat: 1, Lon: 2}}
+	point.prepareForDatabase()
+	require.Equal(t, []float64{2, 1}, point.GeoJson.Coordinates)
+	altitude, floor := 30.0, 2
+	point.Location.Altitude = &altitude
+	point.prepareForDatabase()
+	require.Equal(t, []float64{2, 1, 30}, point.GeoJson.Coordinates)
+
+	// Lines keep the altitude, floor and accuracy of their location
+	line.Location = &Location{Altitude: &altitude, AltitudeDatum: DatumMSL, Floor: &floor, Accuracy: 3}
+	line.prepareForDatabase()
+	require.InDelta(t, 1, line.Location.Lat, 1e-6)
+	require.Equal(t, &altitude, line.Location.Altitude)
+	require.Equal(t, &floor, line.Location.Floor)
+	require.Equal(t, 3.0, line.Location.Accuracy)
+	require.Equal(t, 0.0, point.DistanceTo(1, 2))
+	require.Equal(t, -1.0, Sensor{}.DistanceTo(1, 2))
+}
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const sensorLocationCollectionName = "sensorLocations"
+
+// ErrMoveBeforeCurrent is returned when a move is not after the start of the current location of the sensor
+var ErrMoveBeforeCurrent = errors.New("a move must be after the start of the current location")
+
+// LocationPeriod is where a sensor was from ValidFrom until ValidTo, the current location has no ValidTo
+type LocationPeriod struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	SensorID  primitive.ObjectID `bson:"sensorId"`
+	Location  *Location          `bson:"location"`
+	GeoJson   *GeoJson           `bson:"geoJson"`
+	ValidFrom time.Time          `bson:"validFrom"`
+	ValidTo   *time.Time         `bson:"validTo,omitempty"`
+}
+
+var locationIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: "sensorId", Value: 1}, {Key: "validFrom", Value: 1}},
+		Options: nil,
+	},
+	{
+		Keys:    bson.M{"geoJson": "2dsphere"},
+		Options: options.Index().SetSphereVersion(2),
+	},
+}
+
+// currentLocationQuery matches the period of the current location of a sensor
+func currentLocationQuery(id primitive.ObjectID) bson.M {
+	return bson.M{"sensorId": id, "validTo": nil}
+}
+
+// setCurrentLocation corrects the current location period of the sensor, starting one now when it has none and ending
+// it now when the sensor no longer has a location
+func (store *sensorStore) setCurrentLocation(ctx context.Context, sensor Sensor) error {
+	if sensor.Location == nil {
+		_, err := store.locations.UpdateOne(ctx, currentLocationQuery(sensor.ID), bson.M{"$set": bson.M{"validTo": time.Now().UTC()}})
+		return err
+	}
+	update := bson.M{
+		"$set":         bson.M{"location": sensor.Location, "geoJson": sensor.GeoJson},
+		"$setOnInsert": bson.M{"validFrom": time.Now().UTC()},
+	}
+	_, err := store.locations.UpdateOne(ctx, currentLocationQuery(sensor.ID), update, options.Update().SetUpsert(true))
+	return err
+}
+
+// Move records that the sensor moved to its new location at the given time, which must be after the start of its current
+// location. Sensors without history get a first period from their creation to the move.
+func (store *sensorStore) Move(ctx context.Context, sensor Sensor, at time.Time) error {
+	sensor.prepareForDatabase()
+	if sensor.ID == primitive.NilObjectID {
+		return errors.New("Sensor ID can't be nil")
+	}
+	previous, err := store.FindByID(ctx, sensor.ID)
+	if err != nil {
+		return err
+	}
+	sensor.Tenant, sensor.Owner, sensor.ACL = previous.Tenant, previous.Owner, previous.ACL
+	var current LocationPeriod
+	err = store.locations.FindOne(ctx, currentLocationQuery(sensor.ID)).Decode(&current)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments) && previous.Location != nil:
+		current = LocationPeriod{
+			SensorID:  sensor.ID,
+			Location:  previous.Location,
+			GeoJson:   previous.GeoJson,
+			ValidFrom: sensor.ID.Timestamp(),
+		}
+		if !at.After(current.ValidFrom) {
+			return ErrMoveBeforeCurrent
+		}
+		current.ValidTo = &at
+		_, err = store.locations.InsertOne(ctx, current)
+	case errors.Is(err, mongo.ErrNoDocuments):
+		err = nil
+	case err == nil && !at.After(current.ValidFrom):
+		return ErrMoveBeforeCurrent
+	case err == nil:
+		_, err = store.locations.UpdateByID(ctx, current.ID, bson.M{"$set": bson.M{"validTo": at}})
+	}
+	if err != nil {
+		return err
+	}
+	if sensor.Location != nil {
+		_, err = store.locations.InsertOne(ctx, LocationPeriod{
+			SensorID:  sensor.ID,
+			Location:  sensor.Location,
+			GeoJson:   sensor.GeoJson,
+			ValidFrom: at,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = store.sensors.UpdateOne(ctx, bson.M{"_id": sensor.ID}, sensorUpdate(sensor))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateName
+	}
+	return err
+}
+
+// FindLocationHistory returns the locations of a sensor, oldest first
+func (store *sensorStore) FindLocationHistory(ctx context.Context, id primitive.ObjectID) ([]LocationPeriod, error) {
+	// The history is visible to the tenant of the sensor only
+	_, err := store.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := store.locations.Find(ctx, bson.M{"sensorId": id}, options.Find().SetSort(bson.M{"validFrom": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var result []LocationPeriod
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindNearestAt finds the sensor matching the filter that was nearest to a location at the given time, no farther than
+// maxDistance meters when positive. The sensor has the location it had at that time.
+func (store *sensorStore) FindNearestAt(ctx context.Context, location Location, sensorFilter SensorFilter, maxDistance float64, at time.Time) (*Sensor, error) {
+	// The level of the filter applies to the location at that time, the other fields to the sensor
+	periodQuery := bson.M{
+		"validFrom": bson.M{"$lte": at},
+		"$or":       bson.A{bson.M{"validTo": nil}, bson.M{"validTo": bson.M{"$gt": at}}},
+	}
+	sensorQuery := visibleQuery(ctx, bson.M{}, "sensor.")
+	for key, value := range sensorFilter.toQuery() {
+		if strings.HasPrefix(key, "location.") {
+			periodQuery[key] = value
+		} else {
+			sensorQuery["sensor."+key] = value
+		}
+	}
+	geoNear := bson.M{
+		"near":          location.toDatabase(),
+		"distanceField": "distance",
+		"key":           "geoJson",
+		"query":         periodQuery,
+		"spherical":     true,
+	}
+	if maxDistance > 0 {
+		geoNear["maxDistance"] = maxDistance
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$geoNear", Value: geoNear}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         sensorCollectionName,
+			"localField":   "sensorId",
+			"foreignField": "_id",
+			"as":           "sensor",
+		}}},
+		{{Key: "$unwind", Value: "$sensor"}},
+		{{Key: "$match", Value: sensorQuery}},
+		{{Key: "$limit", Value: 1}},
+	}
+	cursor, err := store.locations.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var result []struct {
+		LocationPeriod `bson:",inline"`
+		Sensor         Sensor `bson:"sensor"`
+	}
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	sensor := result[0].Sensor
+	sensor.Location = result[0].Location
+	sensor.GeoJson = result[0].GeoJson
+	return &sensor, nil
+}
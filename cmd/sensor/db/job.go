@@ -0,0 +1,243 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	geocodeJobCollectionName    = "geocodeJobs"
+	geocodeResultCollectionName = "geocodeJobResults"
+)
+
+// Status of a geocode job
+const (
+	JobRunning   = "RUNNING"
+	JobCompleted = "COMPLETED"
+	JobFailed    = "FAILED"
+	JobCancelled = "CANCELLED"
+)
+
+// ErrJobNotRunning is returned when changing the status of a job that is no longer running
+var ErrJobNotRunning = errors.New("the job is not running")
+
+// ErrLeaseLost is returned when another instance of the service claimed the job
+var ErrLeaseLost = errors.New("the job is run by another instance")
+
+// Status of a geocode result for a single sensor
+const (
+	ResultOK      = "OK"
+	ResultFailed  = "FAILED"
+	ResultSkipped = "SKIPPED"
+)
+
+// GeocodeJob represents a batch job that geocodes a field of the sensors into their location
+type GeocodeJob struct {
+	ID primitive.ObjectID `bson:"_id,omitempty"`
+	// Tenant is the tenant of the user who started the job, the job only processes its sensors, all of them for AllTenants
+	Tenant string `bson:"tenant"`
+	// Principal is the user who started the job, the job only geocodes the sensors it can change
+	Principal     Principal    `bson:"principal"`
+	Filter        SensorFilter `bson:"filter"`
+	Source        string       `bson:"source"`
+	TagPrefix     string       `bson:"tagPrefix"`
+	Workers       int          `bson:"workers"`
+	RatePerSecond float64      `bson:"ratePerSecond"`
+	Status        string       `bson:"status"`
+	Error         string       `bson:"error"`
+	// Owner is the instance of the service running the job, it holds the job while it renews the heartbeat
+	Owner     string    `bson:"owner"`
+	Heartbeat time.Time `bson:"heartbeat"`
+	// LastID is the last sensor of the last fully processed page, jobs resume after it
+	LastID    primitive.ObjectID `bson:"lastId"`
+	Processed int                `bson:"processed"`
+	Succeeded int                `bson:"succeeded"`
+	Failed    int                `bson:"failed"`
+	Skipped   int                `bson:"skipped"`
+	CreatedAt time.Time          `bson:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt"`
+}
+
+// GeocodeResult represents the outcome of geocoding a single sensor in a job
+type GeocodeResult struct {
+	JobID     primitive.ObjectID `bson:"jobId"`
+	SensorID  primitive.ObjectID `bson:"sensorId"`
+	Query     string             `bson:"query"`
+	Status    string             `bson:"status"`
+	Error     string             `bson:"error"`
+	Location  *Location          `bson:"location"`
+	UpdatedAt time.Time          `bson:"updatedAt"`
+}
+
+// JobStore represents the public interface of the jobStore
+type JobStore interface {
+	AddGeocodeJob(ctx context.Context, job GeocodeJob) (primitive.ObjectID, error)
+	FindGeocodeJob(ctx context.Context, id primitive.ObjectID) (*GeocodeJob, error)
+	ClaimGeocodeJob(ctx context.Context, owner string, expiredBefore time.Time) (*GeocodeJob, error)
+	RenewGeocodeJobLease(ctx context.Context, id primitive.ObjectID, owner string) error
+	UpdateGeocodeJobProgress(ctx context.Context, job GeocodeJob) error
+	SetGeocodeJobStatus(ctx context.Context, id primitive.ObjectID, status, errMessage string) error
+	SaveGeocodeResult(ctx context.Context, result GeocodeResult) error
+	FindGeocodeResults(ctx context.Context, jobID primitive.ObjectID, status string) ([]GeocodeResult, error)
+}
+
+type jobStore struct {
+	client   *mongo.Client
+	database *mongo.Database
+	jobs     *mongo.Collection
+	results  *mongo.Collection
+}
+
+// NewJobStore creates a new job store
+func NewJobStore(uri, databaseName string) (*jobStore, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+
+	err = client.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	database := client.Database(databaseName)
+	jobs := database.Collection(geocodeJobCollectionName)
+	results := database.Collection(geocodeResultCollectionName)
+	_, err = jobs.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{"status": 1},
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = results.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "jobId", Value: 1}, {Key: "sensorId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &jobStore{client: client, database: database, jobs: jobs, results: results}, nil
+}
+
+// AddGeocodeJob adds a new geocode job to the store
+func (store *jobStore) AddGeocodeJob(ctx context.Context, job GeocodeJob) (primitive.ObjectID, error) {
+	res, err := store.jobs.InsertOne(ctx, job)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return res.InsertedID.(primitive.ObjectID), nil
+}
+
+// FindGeocodeJob finds a geocode job of the tenant of the context by its ID
+func (store *jobStore) FindGeocodeJob(ctx context.Context, id primitive.ObjectID) (*GeocodeJob, error) {
+	filter := tenantQuery(ctx, bson.M{"_id": id}, "")
+	var result GeocodeJob
+	err := store.jobs.FindOne(ctx, filter).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ClaimGeocodeJob makes the owner run a running job of the tenant of the context whose heartbeat is older than
+// expiredBefore, returning mongo.ErrNoDocuments when there is none
+func (store *jobStore) ClaimGeocodeJob(ctx context.Context, owner string, expiredBefore time.Time) (*GeocodeJob, error) {
+	filter := tenantQuery(ctx, bson.M{
+		"status": JobRunning,
+		"$or":    bson.A{bson.M{"heartbeat": bson.M{"$lt": expiredBefore}}, bson.M{"heartbeat": nil}},
+	}, "")
+	update := bson.M{"$set": bson.M{"owner": owner, "heartbeat": time.Now().UTC()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var result GeocodeJob
+	err := store.jobs.FindOneAndUpdate(ctx, filter, update, opts).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RenewGeocodeJobLease renews the heartbeat of a running job, returning ErrLeaseLost when the owner no longer runs it
+func (store *jobStore) RenewGeocodeJobLease(ctx context.Context, id primitive.ObjectID, owner string) error {
+	filter := bson.M{"_id": id, "owner": owner, "status": JobRunning}
+	res, err := store.jobs.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"heartbeat": time.Now().UTC()}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// UpdateGeocodeJobProgress stores the cursor and counters of a job, leaving its status untouched. It returns
+// ErrLeaseLost when another instance claimed the job.
+func (store *jobStore) UpdateGeocodeJobProgress(ctx context.Context, job GeocodeJob) error {
+	filter := bson.M{"_id": job.ID, "owner": job.Owner}
+	update := bson.M{"$set": bson.M{
+		"lastId":    job.LastID,
+		"processed": job.Processed,
+		"succeeded": job.Succeeded,
+		"failed":    job.Failed,
+		"skipped":   job.Skipped,
+		"updatedAt": job.UpdatedAt,
+		"heartbeat": time.Now().UTC(),
+	}}
+	res, err := store.jobs.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// SetGeocodeJobStatus ends a running job with the status, returning ErrJobNotRunning when it already ended, so that a
+// job cancelled meanwhile is not completed
+func (store *jobStore) SetGeocodeJobStatus(ctx context.Context, id primitive.ObjectID, status, errMessage string) error {
+	filter := bson.M{"_id": id, "status": JobRunning}
+	update := bson.M{"$set": bson.M{
+		"status":    status,
+		"error":     errMessage,
+		"updatedAt": time.Now().UTC(),
+	}}
+	res, err := store.jobs.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrJobNotRunning
+	}
+	return nil
+}
+
+// SaveGeocodeResult stores the result for a sensor, replacing a previous result of the same job
+func (store *jobStore) SaveGeocodeResult(ctx context.Context, result GeocodeResult) error {
+	filter := bson.M{"jobId": result.JobID, "sensorId": result.SensorID}
+	_, err := store.results.ReplaceOne(ctx, filter, result, options.Replace().SetUpsert(true))
+	return err
+}
+
+// FindGeocodeResults finds the results of a job, optionally filtered by status
+func (store *jobStore) FindGeocodeResults(ctx context.Context, jobID primitive.ObjectID, status string) ([]GeocodeResult, error) {
+	filter := bson.M{"jobId": jobID}
+	if status != "" {
+		filter["status"] = status
+	}
+	cursor, err := store.results.Find(ctx, filter, options.Find().SetSort(bson.M{"sensorId": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var result []GeocodeResult
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
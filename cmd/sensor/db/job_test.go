@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestSetGeocodeJobStatus(t *testing.T) {
+	s, err := NewJobStore(`mongodb://localhost:27017`, "sensors"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	ctx := context.Background()
+	defer func() {
+		require.NoError(t, s.database.Drop(ctx))
+	}()
+	id, err := s.AddGeocodeJob(ctx, GeocodeJob{Tenant: DefaultTenant, Status: JobRunning, CreatedAt: time.Now().UTC()})
+	require.NoError(t, err)
+
+	// A cancelled job is not completed by its last page
+	require.NoError(t, s.SetGeocodeJobStatus(ctx, id, JobCancelled, ""))
+	require.ErrorIs(t, s.SetGeocodeJobStatus(ctx, id, JobCompleted, ""), ErrJobNotRunning)
+	job, err := s.FindGeocodeJob(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, JobCancelled, job.Status)
+}
+
+func TestGeocodeJobLease(t *testing.T) {
+	s, err := NewJobStore(`mongodb://localhost:27017`, "sensors"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	ctx := context.Background()
+	defer func() {
+		require.NoError(t, s.database.Drop(ctx))
+	}()
+	now := time.Now().UTC()
+	id, err := s.AddGeocodeJob(ctx, GeocodeJob{Tenant: DefaultTenant, Status: JobRunning, Owner: "instance-1", Heartbeat: now})
+	require.NoError(t, err)
+
+	// A job with a recent heartbeat is not claimed by other instances
+	_, err = s.ClaimGeocodeJob(ctx, "instance-2", now.Add(-time.Minute))
+	require.ErrorIs(t, err, mongo.ErrNoDocuments)
+	require.NoError(t, s.RenewGeocodeJobLease(ctx, id, "instance-1"))
+
+	// Once expired, a single instance claims it and the previous owner stops
+	job, err := s.ClaimGeocodeJob(ctx, "instance-2", time.Now().UTC().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, "instance-2", job.Owner)
+	_, err = s.ClaimGeocodeJob(ctx, "instance-3", now.Add(-time.Minute))
+	require.ErrorIs(t, err, mongo.ErrNoDocuments)
+	require.ErrorIs(t, s.RenewGeocodeJobLease(ctx, id, "instance-1"), ErrLeaseLost)
+	require.ErrorIs(t, s.UpdateGeocodeJobProgress(ctx, GeocodeJob{ID: id, Owner: "instance-1"}), ErrLeaseLost)
+	require.NoError(t, s.UpdateGeocodeJobProgress(ctx, *job))
+}
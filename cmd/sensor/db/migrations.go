@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrationBatchSize is how many documents a migration writes at once
+const migrationBatchSize = 1000
+
+// duplicateName is the name a duplicate sensor is renamed to, unique as it has the id of the sensor
+func duplicateName(name string, id primitive.ObjectID) string {
+	return fmt.Sprintf("%s (%s)", name, id.Hex())
+}
+
+// renameDuplicateNames renames the sensors whose name is already used by an older sensor of their tenant, so that the
+// unique index on the tenant and the name can be created. Names were not unique before tenants existed.
+func renameDuplicateNames(ctx context.Context, sensors *mongo.Collection) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"tenant": "$tenant", "name": "$name"},
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+	cursor, err := sensors.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	var duplicates []struct {
+		Key struct {
+			Tenant string `bson:"tenant"`
+			Name   string `bson:"name"`
+		} `bson:"_id"`
+		IDs []primitive.ObjectID `bson:"ids"`
+	}
+	err = cursor.All(ctx, &duplicates)
+	if err != nil {
+		return err
+	}
+	for _, duplicate := range duplicates {
+		// The oldest sensor keeps the name
+		for _, id := range duplicate.IDs[1:] {
+			name := duplicateName(duplicate.Key.Name, id)
+			_, err = sensors.UpdateByID(ctx, id, bson.M{"$set": bson.M{"name": name}})
+			if err != nil {
+				return err
+			}
+			log.Printf("renamed sensor %s of tenant %q with the duplicate name %q to %q", id.Hex(), duplicate.Key.Tenant,
+				duplicate.Key.Name, name)
+		}
+	}
+	return nil
+}
+
+// backfillLocationPeriods starts the location history of the located sensors stored before it existed, from their
+// creation, so that they are found by FindNearestAt
+func backfillLocationPeriods(ctx context.Context, sensors, locations *mongo.Collection) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"location": bson.M{"$ne": nil}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": sensorLocationCollectionName,
+			"let":  bson.M{"id": "$_id"},
+			"pipeline": mongo.Pipeline{
+				{{Key: "$match", Value: bson.M{"$expr": bson.M{"$eq": bson.A{"$sensorId", "$$id"}}}}},
+				{{Key: "$limit", Value: 1}},
+				{{Key: "$project", Value: bson.M{"_id": 1}}},
+			},
+			"as": "periods",
+		}}},
+		{{Key: "$match", Value: bson.M{"periods": bson.M{"$size": 0}}}},
+		{{Key: "$project", Value: bson.M{"location": 1, "geoJson": 1}}},
+	}
+	cursor, err := sensors.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	var periods []interface{}
+	for cursor.Next(ctx) {
+		var sensor Sensor
+		err = cursor.Decode(&sensor)
+		if err != nil {
+			return err
+		}
+		periods = append(periods, LocationPeriod{
+			SensorID:  sensor.ID,
+			Location:  sensor.Location,
+			GeoJson:   sensor.GeoJson,
+			ValidFrom: sensor.ID.Timestamp().UTC(),
+		})
+		if len(periods) == migrationBatchSize {
+			_, err = locations.InsertMany(ctx, periods)
+			if err != nil {
+				return err
+			}
+			periods = periods[:0]
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+	if len(periods) > 0 {
+		_, err = locations.InsertMany(ctx, periods)
+	}
+	return err
+}
+
+// backfillCells stores the geohash cell of the located sensors stored before it existed, so that they are counted,
+// listed and clustered by cell
+func backfillCells(ctx context.Context, sensors *mongo.Collection) error {
+	filter := bson.M{"location": bson.M{"$ne": nil}, "cell": bson.M{"$in": bson.A{nil, ""}}}
+	cursor, err := sensors.Find(ctx, filter, options.Find().SetProjection(bson.M{"location": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	var updates []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var sensor Sensor
+		err = cursor.Decode(&sensor)
+		if err != nil {
+			return err
+		}
+		cell := geo.EncodeGeohash(sensor.Location.Lat, sensor.Location.Lon, geo.MaxGeohashPrecision)
+		updates = append(updates, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": sensor.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"cell": cell}}))
+		if len(updates) == migrationBatchSize {
+			_, err = sensors.BulkWrite(ctx, updates)
+			if err != nil {
+				return err
+			}
+			updates = updates[:0]
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+	if len(updates) > 0 {
+		_, err = sensors.BulkWrite(ctx, updates)
+	}
+	return err
+}
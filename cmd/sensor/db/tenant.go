@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DefaultTenant is the tenant of the sensors added without one, such as the ones stored before tenants existed
+const DefaultTenant = ""
+
+// AllTenants is the tenant of the contexts that operate on the sensors of every tenant, such as a super-admin or the
+// background work
+const AllTenants = "*"
+
+type tenantKey struct{}
+
+// WithTenant returns a context whose store operations are limited to the sensors of the tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant of the context, DefaultTenant when it has none
+func TenantFromContext(ctx context.Context) string {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	if !ok {
+		return DefaultTenant
+	}
+	return tenant
+}
+
+// tenantQuery limits the query to the tenant of the context, prefixing the field when the document is nested
+func tenantQuery(ctx context.Context, query bson.M, prefix string) bson.M {
+	if tenant := TenantFromContext(ctx); tenant != AllTenants {
+		query[prefix+"tenant"] = tenant
+	}
+	return query
+}
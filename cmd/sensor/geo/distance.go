@@ -0,0 +1,48 @@
+package geo
+
+import "math"
+
+// EarthRadius is the mean radius of the earth in meters
+const EarthRadius = 6371008.8
+
+// MetersPerDegreeLat is the length of a degree of latitude in meters
+const MetersPerDegreeLat = EarthRadius * math.Pi / 180
+
+// Distance returns the great circle distance in meters between two locations
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := phi2 - phi1
+	dLambda := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Destination returns the location at the distance in meters from the origin following the bearing in degrees
+func Destination(lat, lon, bearing, distance float64) (float64, float64) {
+	phi1 := lat * math.Pi / 180
+	lambda1 := lon * math.Pi / 180
+	theta := bearing * math.Pi / 180
+	delta := distance / EarthRadius
+	phi2 := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta))
+	lambda2 := lambda1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(phi1), math.Cos(delta)-math.Sin(phi1)*math.Sin(phi2))
+	return phi2 * 180 / math.Pi, normalizeLon(lambda2 * 180 / math.Pi)
+}
+
+func normalizeLon(lon float64) float64 {
+	return math.Mod(math.Mod(lon+180, 360)+360, 360) - 180
+}
+
+// CirclePolygon returns a GeoJSON polygon with the given number of sides around the circle of the radius in meters,
+// so every point of the circle is inside the polygon
+func CirclePolygon(lat, lon, radius float64, sides int) [][][]float64 {
+	// The apothem of the polygon is the radius of the circle
+	circumradius := radius / math.Cos(math.Pi/float64(sides))
+	ring := make([][]float64, 0, sides+1)
+	for i := 0; i < sides; i++ {
+		pLat, pLon := Destination(lat, lon, float64(i)*360/float64(sides), circumradius)
+		ring = append(ring, []float64{pLon, pLat})
+	}
+	ring = append(ring, ring[0])
+	return [][][]float64{ring}
+}
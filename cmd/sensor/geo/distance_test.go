@@ -0,0 +1,35 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistance(t *testing.T) {
+	// Paris to London
+	require.InDelta(t, 343500, Distance(48.8566, 2.3522, 51.5072, -0.1276), 1000)
+	require.Equal(t, 0.0, Distance(10, 10, 10, 10))
+	require.InDelta(t, MetersPerDegreeLat, Distance(0, 0, 1, 0), 1e-6)
+}
+
+func TestDestination(t *testing.T) {
+	lat, lon := Destination(0, 0, 0, MetersPerDegreeLat)
+	require.InDelta(t, 1, lat, 1e-9)
+	require.InDelta(t, 0, lon, 1e-9)
+	lat, lon = Destination(48.8566, 2.3522, 37, 5000)
+	require.InDelta(t, 5000, Distance(48.8566, 2.3522, lat, lon), 1e-3)
+	_, lon = Destination(0, 179.9, 90, 50000)
+	require.Less(t, lon, -179.0)
+}
+
+func TestCirclePolygon(t *testing.T) {
+	polygon := CirclePolygon(48.8566, 2.3522, 1000, 32)
+	require.Len(t, polygon[0], 33)
+	require.Equal(t, polygon[0][0], polygon[0][32])
+	for bearing := 0.0; bearing < 360; bearing += 5 {
+		lat, lon := Destination(48.8566, 2.3522, bearing, 1000)
+		require.True(t, PolygonContains(polygon, lon, lat))
+	}
+	require.False(t, PolygonContains(polygon, 2.3522, 48.8566+1100/MetersPerDegreeLat))
+}
@@ -0,0 +1,131 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dmsPart is a number of the angle followed by its optional unit, the numbers without unit follow the previous one
+var dmsPart = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*(°|º|D|''|'|′|M|"|″|S|:)?\s*`)
+
+// dmsUnits is the index of the part each unit is for, degrees, minutes or seconds
+var dmsUnits = map[string]int{"°": 0, "º": 0, "D": 0, "'": 1, "′": 1, "M": 1, "''": 2, "\"": 2, "″": 2, "S": 2}
+
+// ParseDMS parses an angle in degrees, minutes and seconds such as 48°51'24.5"N, 48d51m24.5sN, 48 51 24.5 N or
+// -48:51:24.5. Minutes and seconds are optional, the numbers are read by their unit, or in order without one. The
+// hemisphere may be a leading or trailing N or S for latitudes, E or W for longitudes, or a leading minus sign.
+func ParseDMS(text string, latitude bool) (float64, error) {
+	value := strings.ToUpper(strings.TrimSpace(text))
+	sign := 1.0
+	positive, negative, other := "E", "W", "NS"
+	if latitude {
+		positive, negative, other = "N", "S", "EW"
+	}
+	hemispheres := 0
+	for _, letter := range []string{positive, negative} {
+		if strings.HasPrefix(value, letter) {
+			hemispheres++
+			if letter == negative {
+				sign = -1
+			}
+			value = strings.TrimSpace(value[1:])
+			break
+		}
+	}
+	for _, letter := range []string{positive, negative} {
+		if strings.HasSuffix(value, letter) && !isSecondsUnit(value) {
+			hemispheres++
+			if letter == negative {
+				sign = -1
+			}
+			value = strings.TrimSpace(value[:len(value)-1])
+			break
+		}
+	}
+	if strings.HasPrefix(value, "-") {
+		hemispheres++
+		sign = -1
+		value = value[1:]
+	}
+	if hemispheres > 1 {
+		return 0, fmt.Errorf("invalid angle %q, it has more than one hemisphere", text)
+	}
+	if value != "" && (strings.ContainsAny(value[:1], other) ||
+		strings.ContainsAny(value[len(value)-1:], other) && !isSecondsUnit(value)) {
+		return 0, fmt.Errorf("invalid angle %q, the hemisphere must be %s or %s", text, positive, negative)
+	}
+	parts, ok := parseDMSParts(value)
+	if !ok {
+		return 0, fmt.Errorf("invalid angle %q, it must be degrees, minutes and seconds", text)
+	}
+	if parts[1] >= 60 || parts[2] >= 60 {
+		return 0, fmt.Errorf("invalid angle %q, minutes and seconds must be less than 60", text)
+	}
+	angle := sign * (parts[0] + parts[1]/60 + parts[2]/3600)
+	limit := 180.0
+	if latitude {
+		limit = 90
+	}
+	if math.Abs(angle) > limit {
+		return 0, fmt.Errorf("invalid angle %q, it is out of range", text)
+	}
+	return angle, nil
+}
+
+// parseDMSParts reads the degrees, minutes and seconds of an angle without hemisphere. Each number goes to the part of
+// its unit, or to the part after the previous number without one. Parts must be in order and appear once, and the S
+// unit of the seconds is only used along the D and M units.
+func parseDMSParts(value string) (parts [3]float64, ok bool) {
+	letterUnits := strings.ContainsAny(value, "DM")
+	next := 0
+	for value != "" {
+		match := dmsPart.FindStringSubmatch(value)
+		if match == nil || match[2] == "S" && !letterUnits {
+			return parts, false
+		}
+		index, hasUnit := dmsUnits[match[2]]
+		if !hasUnit {
+			index = next
+		}
+		if index < next || index > 2 {
+			return parts, false
+		}
+		parts[index], _ = strconv.ParseFloat(match[1], 64)
+		next = index + 1
+		value = value[len(match[0]):]
+	}
+	return parts, next > 0
+}
+
+// isSecondsUnit tells whether the trailing S of the angle is the unit of its seconds, as in 48d51m30s, rather than the
+// southern hemisphere. It is when it follows the seconds of an angle with the letter units.
+func isSecondsUnit(value string) bool {
+	if !strings.HasSuffix(value, "S") || len(value) < 2 || value[len(value)-2] < '0' || value[len(value)-2] > '9' {
+		return false
+	}
+	return strings.ContainsAny(value, "DM")
+}
+
+// FormatDMS formats an angle as degrees, minutes and seconds with hundredths of second and its hemisphere, e.g. 48°51'24.50"N
+func FormatDMS(angle float64, latitude bool) string {
+	hemisphere := "E"
+	if latitude {
+		hemisphere = "N"
+	}
+	if angle < 0 {
+		hemisphere = "W"
+		if latitude {
+			hemisphere = "S"
+		}
+		angle = -angle
+	}
+	// Rounding is done on hundredths of second so 59.999 seconds carry to the next minute
+	hundredths := int64(math.Round(angle * 360000))
+	degrees := hundredths / 360000
+	minutes := hundredths % 360000 / 6000
+	seconds := float64(hundredths%6000) / 100
+	return fmt.Sprintf("%d°%02d'%05.2f\"%s", degrees, minutes, seconds, hemisphere)
+}
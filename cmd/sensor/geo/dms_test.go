@@ -0,0 +1,61 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDMS(t *testing.T) {
+	for text, expected := range map[string]float64{
+		`48°51'30.24"N`: 48.8584,
+		`48 51 30.24 N`: 48.8584,
+		`N48:51:30.24`:  48.8584,
+		`-48°51'30.24"`: -48.8584,
+		`48°51'30.24"S`: -48.8584,
+		`48°30'`:        48.5,
+		`12`:            12,
+		// The trailing s of the letter units is the unit of the seconds, not the southern hemisphere
+		`48d51m30.24s`:   48.8584,
+		`48d51m30.24sN`:  48.8584,
+		`48d51m30.24sS`:  -48.8584,
+		`48d 51m 30s S`:  -48.8583333333,
+		`N48d51m30.24s`:  48.8584,
+		`48 51 30.24S`:   -48.8584,
+		`48D51M30.24S N`: 48.8584,
+		// Numbers are read by their unit
+		`48d30s`:  48.0083333333,
+		`48°30"`:  48.0083333333,
+		`48°30''`: 48.0083333333,
+		`48°30`:   48.5,
+	} {
+		angle, err := ParseDMS(text, true)
+		require.NoError(t, err, text)
+		require.InDelta(t, expected, angle, 1e-9, text)
+	}
+	angle, err := ParseDMS(`2°17'40.20"W`, false)
+	require.NoError(t, err)
+	require.InDelta(t, -2.2945, angle, 1e-9)
+	angle, err = ParseDMS(`2d17m40.2s`, false)
+	require.NoError(t, err)
+	require.InDelta(t, 2.2945, angle, 1e-9)
+	for _, text := range []string{"", `48°61'N`, `91°N`, `-48°N`, `48°51'30"E`, "1 2 3 4", "12x", "N48S", "S48d51m30sN",
+		"48d51m30sNS", `30' 48°`, `48°30'15'`, `48°30"15`} {
+		_, err = ParseDMS(text, true)
+		require.Error(t, err, text)
+	}
+	// The hemispheres of latitudes are not taken for longitudes
+	for _, text := range []string{"48 51 24 S", "48 51 24S", "N48 51 24", `48°51'24"N`} {
+		_, err = ParseDMS(text, false)
+		require.Error(t, err, text)
+	}
+}
+
+func TestFormatDMS(t *testing.T) {
+	require.Equal(t, `48°51'30.24"N`, FormatDMS(48.8584, true))
+	require.Equal(t, `2°17'40.20"W`, FormatDMS(-2.2945, false))
+	require.Equal(t, `11°00'00.00"N`, FormatDMS(10.99999999, true))
+	angle, err := ParseDMS(FormatDMS(-151.2153, false), false)
+	require.NoError(t, err)
+	require.InDelta(t, -151.2153, angle, 1e-6)
+}
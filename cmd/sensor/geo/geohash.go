@@ -0,0 +1,116 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+	// MaxGeohashPrecision is the longest geohash supported, about 3.7cm x 1.9cm
+	MaxGeohashPrecision = 12
+)
+
+// Directions of the neighbours of a geohash cell
+var Directions = []string{"n", "ne", "e", "se", "s", "sw", "w", "nw"}
+
+var directionOffsets = map[string][2]float64{
+	"n": {0, 1}, "ne": {1, 1}, "e": {1, 0}, "se": {1, -1},
+	"s": {0, -1}, "sw": {-1, -1}, "w": {-1, 0}, "nw": {-1, 1},
+}
+
+// EncodeGeohash returns the geohash of a location with precision characters
+func EncodeGeohash(lat, lon float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	var hash strings.Builder
+	bit, ch := 0, 0
+	even := true
+	for hash.Len() < precision {
+		// Even bits refine the longitude and odd bits the latitude
+		rng, value := &latRange, lat
+		if even {
+			rng, value = &lonRange, lon
+		}
+		mid := (rng[0] + rng[1]) / 2
+		ch <<= 1
+		if value >= mid {
+			ch |= 1
+			rng[0] = mid
+		} else {
+			rng[1] = mid
+		}
+		even = !even
+		bit++
+		if bit == 5 {
+			hash.WriteByte(geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return hash.String()
+}
+
+// ValidateGeohash returns an error if the hash is empty, too long or has invalid characters
+func ValidateGeohash(hash string) error {
+	if hash == "" || len(hash) > MaxGeohashPrecision {
+		return fmt.Errorf("geohash must have between 1 and %d characters", MaxGeohashPrecision)
+	}
+	for _, c := range hash {
+		if !strings.ContainsRune(geohashAlphabet, c) {
+			return fmt.Errorf("invalid geohash character %q", c)
+		}
+	}
+	return nil
+}
+
+// DecodeGeohash returns the bounding box of a geohash cell, the hash must be valid
+func DecodeGeohash(hash string) BBox {
+	box := BBox{MinLon: -180, MinLat: -90, MaxLon: 180, MaxLat: 90}
+	even := true
+	for _, c := range hash {
+		ch := strings.IndexRune(geohashAlphabet, c)
+		for bit := 4; bit >= 0; bit-- {
+			set := ch&(1<<bit) != 0
+			if even {
+				mid := (box.MinLon + box.MaxLon) / 2
+				if set {
+					box.MinLon = mid
+				} else {
+					box.MaxLon = mid
+				}
+			} else {
+				mid := (box.MinLat + box.MaxLat) / 2
+				if set {
+					box.MinLat = mid
+				} else {
+					box.MaxLat = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return box
+}
+
+// GeohashNeighbours returns the cells with the same precision around a valid geohash, indexed by direction.
+// Longitudes wrap around the antimeridian and there are no neighbours beyond the poles.
+func GeohashNeighbours(hash string) map[string]string {
+	box := DecodeGeohash(hash)
+	width := box.MaxLon - box.MinLon
+	height := box.MaxLat - box.MinLat
+	centerLon := (box.MinLon + box.MaxLon) / 2
+	centerLat := (box.MinLat + box.MaxLat) / 2
+	neighbours := make(map[string]string, len(Directions))
+	for _, direction := range Directions {
+		offset := directionOffsets[direction]
+		lat := centerLat + offset[1]*height
+		if lat < -90 || lat > 90 {
+			continue
+		}
+		lon := centerLon + offset[0]*width
+		lon = math.Mod(lon+540, 360) - 180
+		neighbours[direction] = EncodeGeohash(lat, lon, len(hash))
+	}
+	return neighbours
+}
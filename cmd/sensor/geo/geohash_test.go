@@ -0,0 +1,42 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeGeohash(t *testing.T) {
+	require.Equal(t, "u4pruydqqvj", EncodeGeohash(57.64911, 10.40744, 11))
+	require.Equal(t, "u09tvw0f6", EncodeGeohash(48.8566, 2.3522, 9))
+	require.Equal(t, "", EncodeGeohash(0, 0, 0))
+}
+
+func TestDecodeGeohash(t *testing.T) {
+	box := DecodeGeohash("u09tvw0f6")
+	require.True(t, box.Contains(2.3522, 48.8566))
+	require.InDelta(t, 0.000043, box.MaxLat-box.MinLat, 0.000001)
+	require.NoError(t, ValidateGeohash("u09tvw0f6"))
+	require.Error(t, ValidateGeohash("u09a"))
+	require.Error(t, ValidateGeohash(""))
+	require.Error(t, ValidateGeohash("0123456789bcd"))
+}
+
+func TestGeohashNeighbours(t *testing.T) {
+	box := DecodeGeohash("gcpuyy")
+	width := box.MaxLon - box.MinLon
+	height := box.MaxLat - box.MinLat
+	neighbours := GeohashNeighbours("gcpuyy")
+	require.Len(t, neighbours, 8)
+	require.Equal(t, "gcpuyz", neighbours["n"])
+	require.Equal(t, "gcpuzn", neighbours["e"])
+	for direction, hash := range neighbours {
+		offset := directionOffsets[direction]
+		neighbour := DecodeGeohash(hash)
+		require.InDelta(t, box.MinLon+offset[0]*width, neighbour.MinLon, 1e-9, direction)
+		require.InDelta(t, box.MinLat+offset[1]*height, neighbour.MinLat, 1e-9, direction)
+	}
+	neighbours = GeohashNeighbours("b")
+	require.Len(t, neighbours, 5)
+	require.Equal(t, "z", neighbours["w"])
+}
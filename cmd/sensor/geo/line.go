@@ -0,0 +1,44 @@
+package geo
+
+import "math"
+
+// LineLength returns the length in meters of a GeoJSON LineString, whose positions are [lon, lat]
+func LineLength(line [][]float64) float64 {
+	length := 0.0
+	for i := 1; i < len(line); i++ {
+		length += Distance(line[i-1][1], line[i-1][0], line[i][1], line[i][0])
+	}
+	return length
+}
+
+// LocateOnLine returns where the location is relative to a GeoJSON LineString: the distance in meters along the line
+// to the closest point of the line, and the distance to that point, positive on the left of the line and negative on
+// its right. Segments are projected on a plane tangent at their middle, which is accurate for segments of a few
+// hundred kilometers.
+func LocateOnLine(line [][]float64, lat, lon float64) (along, offset float64) {
+	offset = math.Inf(1)
+	start := 0.0
+	for i := 1; i < len(line); i++ {
+		aLon, aLat := line[i-1][0], line[i-1][1]
+		bLon, bLat := line[i][0], line[i][1]
+		scale := math.Cos((aLat + bLat) / 2 * math.Pi / 180)
+		// Differences of longitude are normalized so segments may cross the antimeridian
+		bx, by := normalizeLon(bLon-aLon)*scale, bLat-aLat
+		px, py := normalizeLon(lon-aLon)*scale, lat-aLat
+		t := 0.0
+		if squared := bx*bx + by*by; squared > 0 {
+			t = math.Max(0, math.Min(1, (px*bx+py*by)/squared))
+		}
+		length := Distance(aLat, aLon, bLat, bLon)
+		d := Distance(lat, lon, aLat+t*(bLat-aLat), normalizeLon(aLon+t*normalizeLon(bLon-aLon)))
+		if d < math.Abs(offset) {
+			along = start + t*length
+			offset = d
+			if bx*py-by*px < 0 {
+				offset = -d
+			}
+		}
+		start += length
+	}
+	return along, offset
+}
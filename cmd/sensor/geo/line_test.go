@@ -0,0 +1,37 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocateOnLine(t *testing.T) {
+	// Eastward along the equator then northward
+	line := [][]float64{{0, 0}, {1, 0}, {1, 1}}
+	require.InDelta(t, 2*MetersPerDegreeLat, LineLength(line), 1)
+
+	along, offset := LocateOnLine(line, 0.01, 0.5)
+	require.InDelta(t, 0.5*MetersPerDegreeLat, along, 1)
+	require.InDelta(t, 0.01*MetersPerDegreeLat, offset, 1)
+
+	along, offset = LocateOnLine(line, -0.01, 0.5)
+	require.InDelta(t, 0.5*MetersPerDegreeLat, along, 1)
+	require.InDelta(t, -0.01*MetersPerDegreeLat, offset, 1)
+
+	// East of the northward segment is its right
+	along, offset = LocateOnLine(line, 0.5, 1.02)
+	require.InDelta(t, 1.5*MetersPerDegreeLat, along, 10)
+	require.Less(t, offset, 0.0)
+	require.InDelta(t, 0.02*MetersPerDegreeLat, -offset, 10)
+
+	// Before the start of the line the closest point is the start
+	along, offset = LocateOnLine(line, 0, -0.1)
+	require.Equal(t, 0.0, along)
+	require.InDelta(t, 0.1*MetersPerDegreeLat, offset, 1)
+
+	// Across the antimeridian
+	along, offset = LocateOnLine([][]float64{{179.5, 0}, {-179.5, 0}}, 0.001, 180)
+	require.InDelta(t, 0.5*MetersPerDegreeLat, along, 1)
+	require.InDelta(t, 0.001*MetersPerDegreeLat, offset, 1)
+}
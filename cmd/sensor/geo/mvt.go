@@ -0,0 +1,90 @@
+package geo
+
+// This file encodes point layers in the Mapbox Vector Tile format version 2,
+// see https://github.com/mapbox/vector-tile-spec/tree/master/2.1
+
+const (
+	// TileExtent is the size of a tile in tile coordinates
+	TileExtent = 4096
+
+	wireVarint = 0
+	wireBytes  = 2
+
+	mvtPoint  = 1
+	mvtMoveTo = 1
+)
+
+// PointFeature is a point of a vector tile layer with string properties
+type PointFeature struct {
+	// X and Y are in tile coordinates, see Tile.Project
+	X          int
+	Y          int
+	Properties map[string]string
+}
+
+// EncodePointLayer encodes a tile with a single layer of points. Properties are written in the order of keys,
+// properties missing from the keys are ignored.
+func EncodePointLayer(name string, keys []string, features []PointFeature) []byte {
+	var values []string
+	valueIndex := map[string]int{}
+	var layer []byte
+	layer = appendVarintField(layer, 15, 2)
+	layer = appendBytesField(layer, 1, []byte(name))
+	for _, feature := range features {
+		var tags []byte
+		for k, key := range keys {
+			value, ok := feature.Properties[key]
+			if !ok {
+				continue
+			}
+			index, ok := valueIndex[value]
+			if !ok {
+				index = len(values)
+				valueIndex[value] = index
+				values = append(values, value)
+			}
+			tags = appendVarint(tags, uint64(k))
+			tags = appendVarint(tags, uint64(index))
+		}
+		var geometry []byte
+		geometry = appendVarint(geometry, mvtMoveTo|1<<3)
+		geometry = appendVarint(geometry, zigzag(feature.X))
+		geometry = appendVarint(geometry, zigzag(feature.Y))
+		var encoded []byte
+		encoded = appendBytesField(encoded, 2, tags)
+		encoded = appendVarintField(encoded, 3, mvtPoint)
+		encoded = appendBytesField(encoded, 4, geometry)
+		layer = appendBytesField(layer, 2, encoded)
+	}
+	for _, key := range keys {
+		layer = appendBytesField(layer, 3, []byte(key))
+	}
+	for _, value := range values {
+		layer = appendBytesField(layer, 4, appendBytesField(nil, 1, []byte(value)))
+	}
+	layer = appendVarintField(layer, 5, TileExtent)
+	return appendBytesField(nil, 3, layer)
+}
+
+func zigzag(n int) uint64 {
+	return uint64((n << 1) ^ (n >> 63))
+}
+
+func appendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+func appendVarintField(buf []byte, field int, v uint64) []byte {
+	buf = appendVarint(buf, uint64(field<<3|wireVarint))
+	return appendVarint(buf, v)
+}
+
+func appendBytesField(buf []byte, field int, data []byte) []byte {
+	buf = appendVarint(buf, uint64(field<<3|wireBytes))
+	buf = appendVarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
@@ -0,0 +1,88 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Open Location Code constants, see https://github.com/google/open-location-code
+const (
+	plusCodeAlphabet  = "23456789CFGHJMPQRVWX"
+	plusCodeSeparator = '+'
+	plusCodePadding   = '0'
+	// plusCodePairs is the number of digits encoded as latitude and longitude pairs, the following ones refine a 4 x 5 grid
+	plusCodePairs  = 10
+	plusCodeMaxLen = 15
+	gridRows       = 5
+	gridColumns    = 4
+)
+
+// EncodePlusCode returns the 10 digit plus code of a location, e.g. 8FVC9G8F+6X, an area of about 14 x 14 meters
+func EncodePlusCode(lat, lon float64) string {
+	lat = math.Min(math.Max(lat, -90), 90) + 90
+	lon = normalizeLon(lon) + 180
+	resolution := 20.0
+	if lat >= 180 {
+		// The north pole is in the last row of codes
+		lat = 180 - math.Pow(20, -3)/2
+	}
+	var code strings.Builder
+	for i := 0; i < plusCodePairs/2; i++ {
+		if i == 4 {
+			code.WriteByte(plusCodeSeparator)
+		}
+		digit := math.Floor(lat / resolution)
+		lat -= digit * resolution
+		code.WriteByte(plusCodeAlphabet[int(digit)])
+		digit = math.Min(math.Floor(lon/resolution), 19)
+		lon -= digit * resolution
+		code.WriteByte(plusCodeAlphabet[int(digit)])
+		resolution /= 20
+	}
+	return code.String()
+}
+
+// DecodePlusCode returns the center of the area of a full plus code, short codes relative to a place are not supported
+func DecodePlusCode(code string) (float64, float64, error) {
+	value := strings.ToUpper(strings.TrimSpace(code))
+	separator := strings.IndexByte(value, plusCodeSeparator)
+	if separator != 8 || strings.Count(value, string(plusCodeSeparator)) != 1 {
+		return 0, 0, fmt.Errorf("invalid plus code %q, it must be a full code with the separator after 8 digits", code)
+	}
+	digits := value[:separator] + value[separator+1:]
+	if padding := strings.IndexByte(digits, plusCodePadding); padding >= 0 {
+		if padding == 0 || padding%2 != 0 || strings.Trim(digits[padding:], string(plusCodePadding)) != "" {
+			return 0, 0, fmt.Errorf("invalid plus code %q, it has invalid padding", code)
+		}
+		digits = digits[:padding]
+	}
+	if len(digits) < 2 || len(digits) > plusCodeMaxLen || len(digits) == plusCodePairs-1 {
+		return 0, 0, fmt.Errorf("invalid plus code %q", code)
+	}
+	lat, lon := -90.0, -180.0
+	latSize, lonSize := 400.0, 400.0
+	for i := 0; i < len(digits); i++ {
+		digit := strings.IndexByte(plusCodeAlphabet, digits[i])
+		if digit < 0 {
+			return 0, 0, fmt.Errorf("invalid plus code %q, it has invalid digits", code)
+		}
+		switch {
+		case i < plusCodePairs && i%2 == 0:
+			latSize /= 20
+			lat += float64(digit) * latSize
+		case i < plusCodePairs:
+			lonSize /= 20
+			lon += float64(digit) * lonSize
+		default:
+			latSize /= gridRows
+			lonSize /= gridColumns
+			lat += float64(digit/gridColumns) * latSize
+			lon += float64(digit%gridColumns) * lonSize
+		}
+	}
+	if lat >= 90 || lon >= 180 {
+		return 0, 0, fmt.Errorf("invalid plus code %q, it is out of range", code)
+	}
+	return lat + latSize/2, lon + lonSize/2, nil
+}
@@ -0,0 +1,32 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodePlusCode(t *testing.T) {
+	require.Equal(t, "8FVC9G8F+6X", EncodePlusCode(47.365590, 8.524997))
+	require.Equal(t, "22222222+22", EncodePlusCode(-90, -180))
+	require.Equal(t, "CFX3X2X2+X2", EncodePlusCode(90, 1))
+}
+
+func TestDecodePlusCode(t *testing.T) {
+	lat, lon, err := DecodePlusCode("8fvc9g8f+6x")
+	require.NoError(t, err)
+	require.InDelta(t, 47.3655625, lat, 1e-9)
+	require.InDelta(t, 8.5249375, lon, 1e-9)
+	lat, lon, err = DecodePlusCode("8FVC9G8F+6XQ")
+	require.NoError(t, err)
+	require.InDelta(t, 47.3655875, lat, 1e-9)
+	require.InDelta(t, 8.524984375, lon, 1e-9)
+	lat, lon, err = DecodePlusCode("8FVC0000+")
+	require.NoError(t, err)
+	require.InDelta(t, 47.5, lat, 1e-9)
+	require.InDelta(t, 8.5, lon, 1e-9)
+	for _, code := range []string{"9G8F+6X", "8FVC9G8F6X", "8FVC9G8F+6I", "8FV00000+", "8F0C0000+", "8FVC9G8F+6", "8FVC0000+6X"} {
+		_, _, err = DecodePlusCode(code)
+		require.Error(t, err, code)
+	}
+}
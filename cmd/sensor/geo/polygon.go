@@ -0,0 +1,107 @@
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// BBox is a bounding box in degrees
+type BBox struct {
+	MinLon float64
+	MinLat float64
+	MaxLon float64
+	MaxLat float64
+}
+
+// EmptyBBox returns a box that contains nothing and grows with Extend
+func EmptyBBox() BBox {
+	return BBox{MinLon: math.Inf(1), MinLat: math.Inf(1), MaxLon: math.Inf(-1), MaxLat: math.Inf(-1)}
+}
+
+// Extend grows the box to contain the point
+func (b *BBox) Extend(lon, lat float64) {
+	b.MinLon = math.Min(b.MinLon, lon)
+	b.MinLat = math.Min(b.MinLat, lat)
+	b.MaxLon = math.Max(b.MaxLon, lon)
+	b.MaxLat = math.Max(b.MaxLat, lat)
+}
+
+// ParseBBox parses a minLon,minLat,maxLon,maxLat box. MinLon may be greater than MaxLon when the box crosses the antimeridian.
+func ParseBBox(text string) (BBox, error) {
+	fields := strings.Split(text, ",")
+	if len(fields) != 4 {
+		return BBox{}, errors.New("bbox must be minLon,minLat,maxLon,maxLat")
+	}
+	var values [4]float64
+	for i, field := range fields {
+		value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return BBox{}, fmt.Errorf("invalid bbox coordinate %q", field)
+		}
+		values[i] = value
+	}
+	box := BBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	if box.MinLat > box.MaxLat || box.MinLat < -90 || box.MaxLat > 90 ||
+		box.MinLon < -180 || box.MinLon > 180 || box.MaxLon < -180 || box.MaxLon > 180 {
+		return BBox{}, errors.New("bbox is out of range")
+	}
+	return box, nil
+}
+
+// CrossesAntimeridian reports whether the box wraps from 180 to -180 degrees of longitude
+func (b BBox) CrossesAntimeridian() bool {
+	return b.MinLon > b.MaxLon
+}
+
+// Contains reports whether the point is inside the box, borders included
+func (b BBox) Contains(lon, lat float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.CrossesAntimeridian() {
+		return lon >= b.MinLon || lon <= b.MaxLon
+	}
+	return lon >= b.MinLon && lon <= b.MaxLon
+}
+
+// PolygonBBox returns the bounding box of the outer ring of a GeoJSON polygon
+func PolygonBBox(polygon [][][]float64) BBox {
+	box := EmptyBBox()
+	if len(polygon) == 0 {
+		return box
+	}
+	for _, position := range polygon[0] {
+		box.Extend(position[0], position[1])
+	}
+	return box
+}
+
+// PolygonContains reports whether the point is inside a GeoJSON polygon, that is
+// inside the outer ring and outside all of its holes. Coordinates are [lon, lat].
+func PolygonContains(polygon [][][]float64, lon, lat float64) bool {
+	if len(polygon) == 0 || !ringContains(polygon[0], lon, lat) {
+		return false
+	}
+	for _, hole := range polygon[1:] {
+		if ringContains(hole, lon, lat) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains uses ray casting, the ring may be closed or not
+func ringContains(ring [][]float64, lon, lat float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
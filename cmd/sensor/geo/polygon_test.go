@@ -0,0 +1,40 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolygonContains(t *testing.T) {
+	square := [][][]float64{
+		{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}},
+		{{4, 4}, {6, 4}, {6, 6}, {4, 6}, {4, 4}},
+	}
+	require.True(t, PolygonContains(square, 1, 1))
+	require.True(t, PolygonContains(square, 9, 5))
+	require.False(t, PolygonContains(square, 5, 5))
+	require.False(t, PolygonContains(square, 11, 5))
+	require.False(t, PolygonContains(nil, 1, 1))
+	require.Equal(t, BBox{MinLon: 0, MinLat: 0, MaxLon: 10, MaxLat: 10}, PolygonBBox(square))
+	require.True(t, PolygonBBox(square).Contains(10, 10))
+}
+
+func TestParseBBox(t *testing.T) {
+	box, err := ParseBBox("-10, 40,10,50")
+	require.NoError(t, err)
+	require.Equal(t, BBox{MinLon: -10, MinLat: 40, MaxLon: 10, MaxLat: 50}, box)
+	require.False(t, box.CrossesAntimeridian())
+	box, err = ParseBBox("170,-20,-170,20")
+	require.NoError(t, err)
+	require.True(t, box.CrossesAntimeridian())
+	require.True(t, box.Contains(175, 0))
+	require.True(t, box.Contains(-175, 0))
+	require.False(t, box.Contains(0, 0))
+	_, err = ParseBBox("1,2,3")
+	require.Error(t, err)
+	_, err = ParseBBox("0,50,10,40")
+	require.EqualError(t, err, "bbox is out of range")
+	_, err = ParseBBox("0,a,10,40")
+	require.Error(t, err)
+}
@@ -0,0 +1,84 @@
+package geo
+
+import (
+	"math"
+	"sort"
+)
+
+// LineMidpoint returns the point of a GeoJSON LineString halfway along its length, as lat, lon
+func LineMidpoint(line [][]float64) (float64, float64) {
+	half := LineLength(line) / 2
+	for i := 1; i < len(line); i++ {
+		length := Distance(line[i-1][1], line[i-1][0], line[i][1], line[i][0])
+		if length >= half && length > 0 {
+			t := half / length
+			return line[i-1][1] + t*(line[i][1]-line[i-1][1]), normalizeLon(line[i-1][0] + t*normalizeLon(line[i][0]-line[i-1][0]))
+		}
+		half -= length
+	}
+	return line[0][1], line[0][0]
+}
+
+// PolygonRepresentativePoint returns a point inside a GeoJSON polygon, as lat, lon. It is the centroid of the outer
+// ring when inside the polygon, otherwise the middle of the widest inside span at the latitude of the centroid.
+func PolygonRepresentativePoint(polygon [][][]float64) (float64, float64) {
+	lat, lon := ringCentroid(polygon[0])
+	if PolygonContains(polygon, lon, lat) {
+		return lat, lon
+	}
+	var crossings []float64
+	for _, ring := range polygon {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			xi, yi := ring[i][0], ring[i][1]
+			xj, yj := ring[j][0], ring[j][1]
+			if (yi > lat) != (yj > lat) {
+				crossings = append(crossings, (xj-xi)*(lat-yi)/(yj-yi)+xi)
+			}
+		}
+	}
+	sort.Float64s(crossings)
+	width := -1.0
+	for i := 0; i+1 < len(crossings); i += 2 {
+		if crossings[i+1]-crossings[i] > width {
+			width = crossings[i+1] - crossings[i]
+			lon = (crossings[i] + crossings[i+1]) / 2
+		}
+	}
+	return lat, lon
+}
+
+// ringCentroid returns the centroid of the area of a ring, or the mean of its vertices when it has no area
+func ringCentroid(ring [][]float64) (float64, float64) {
+	area, cx, cy := 0.0, 0.0, 0.0
+	sx, sy := 0.0, 0.0
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		cross := ring[j][0]*ring[i][1] - ring[i][0]*ring[j][1]
+		area += cross
+		cx += (ring[j][0] + ring[i][0]) * cross
+		cy += (ring[j][1] + ring[i][1]) * cross
+		sx += ring[i][0]
+		sy += ring[i][1]
+	}
+	if math.Abs(area) < 1e-12 {
+		return sy / float64(len(ring)), sx / float64(len(ring))
+	}
+	return cy / (3 * area), cx / (3 * area)
+}
+
+// DistanceToLine returns the distance in meters between the location and the closest point of a GeoJSON LineString
+func DistanceToLine(line [][]float64, lat, lon float64) float64 {
+	_, offset := LocateOnLine(line, lat, lon)
+	return math.Abs(offset)
+}
+
+// DistanceToPolygon returns the distance in meters between the location and a GeoJSON polygon, zero when inside
+func DistanceToPolygon(polygon [][][]float64, lat, lon float64) float64 {
+	if PolygonContains(polygon, lon, lat) {
+		return 0
+	}
+	distance := math.Inf(1)
+	for _, ring := range polygon {
+		distance = math.Min(distance, DistanceToLine(ring, lat, lon))
+	}
+	return distance
+}
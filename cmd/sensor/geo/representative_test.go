@@ -0,0 +1,40 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineMidpoint(t *testing.T) {
+	lat, lon := LineMidpoint([][]float64{{0, 0}, {1, 0}, {1, 1}})
+	require.InDelta(t, 0, lat, 1e-6)
+	require.InDelta(t, 1, lon, 1e-6)
+	lat, lon = LineMidpoint([][]float64{{0, 0}, {0, 2}})
+	require.InDelta(t, 1, lat, 1e-6)
+	require.InDelta(t, 0, lon, 1e-6)
+}
+
+func TestPolygonRepresentativePoint(t *testing.T) {
+	square := [][][]float64{{{0, 0}, {2, 0}, {2, 2}, {0, 2}, {0, 0}}}
+	lat, lon := PolygonRepresentativePoint(square)
+	require.InDelta(t, 1, lat, 1e-9)
+	require.InDelta(t, 1, lon, 1e-9)
+
+	// The centroid of a U shape is in its hole
+	u := [][][]float64{{{0, 0}, {3, 0}, {3, 3}, {2, 3}, {2, 1}, {1, 1}, {1, 3}, {0, 3}, {0, 0}}}
+	lat, lon = PolygonRepresentativePoint(u)
+	require.True(t, PolygonContains(u, lon, lat))
+
+	// A hole in the centre of the square
+	holed := [][][]float64{square[0], {{0.5, 0.5}, {1.5, 0.5}, {1.5, 1.5}, {0.5, 1.5}, {0.5, 0.5}}}
+	lat, lon = PolygonRepresentativePoint(holed)
+	require.True(t, PolygonContains(holed, lon, lat))
+}
+
+func TestDistanceToGeometry(t *testing.T) {
+	require.InDelta(t, MetersPerDegreeLat, DistanceToLine([][]float64{{0, 0}, {2, 0}}, 1, 1), 1)
+	square := [][][]float64{{{0, 0}, {2, 0}, {2, 2}, {0, 2}, {0, 0}}}
+	require.Equal(t, 0.0, DistanceToPolygon(square, 1, 1))
+	require.InDelta(t, MetersPerDegreeLat, DistanceToPolygon(square, 3, 1), 1)
+}
@@ -0,0 +1,63 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+)
+
+// Tile is a web mercator (XYZ) map tile
+type Tile struct {
+	Z int
+	X int
+	Y int
+}
+
+// NewTile returns the tile if its coordinates exist at its zoom
+func NewTile(z, x, y, maxZoom int) (Tile, error) {
+	if z < 0 || z > maxZoom {
+		return Tile{}, fmt.Errorf("zoom must be between 0 and %d", maxZoom)
+	}
+	n := 1 << z
+	if x < 0 || x >= n || y < 0 || y >= n {
+		return Tile{}, fmt.Errorf("tile %d/%d/%d does not exist", z, x, y)
+	}
+	return Tile{Z: z, X: x, Y: y}, nil
+}
+
+// BBox returns the box covered by the tile, grown by buffer as a fraction of the tile size
+func (t Tile) BBox(buffer float64) BBox {
+	n := float64(int(1) << t.Z)
+	box := BBox{
+		MinLon: tileLon(float64(t.X)-buffer, n),
+		MaxLon: tileLon(float64(t.X+1)+buffer, n),
+		MinLat: tileLat(float64(t.Y+1)+buffer, n),
+		MaxLat: tileLat(float64(t.Y)-buffer, n),
+	}
+	box.MinLon = math.Max(box.MinLon, -180)
+	box.MaxLon = math.Min(box.MaxLon, 180)
+	return box
+}
+
+// Project returns the position of a location inside the tile, with the tile covering 0 to extent on both axes
+// and y growing southwards. Positions outside the tile are outside that range.
+func (t Tile) Project(lat, lon float64, extent int) (x, y int) {
+	n := float64(int(1) << t.Z)
+	lat = math.Max(math.Min(lat, maxMercatorLat), -maxMercatorLat)
+	latRad := lat * math.Pi / 180
+	tileX := (lon + 180) / 360 * n
+	tileY := (1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * n
+	x = int(math.Round((tileX - float64(t.X)) * float64(extent)))
+	y = int(math.Round((tileY - float64(t.Y)) * float64(extent)))
+	return x, y
+}
+
+// maxMercatorLat is the latitude where web mercator tiles end
+const maxMercatorLat = 85.0511287798066
+
+func tileLon(x, n float64) float64 {
+	return x/n*360 - 180
+}
+
+func tileLat(y, n float64) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+}
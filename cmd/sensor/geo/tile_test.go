@@ -0,0 +1,50 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTile(t *testing.T) {
+	_, err := NewTile(2, 4, 0, 22)
+	require.EqualError(t, err, "tile 2/4/0 does not exist")
+	_, err = NewTile(23, 0, 0, 22)
+	require.Error(t, err)
+	world, err := NewTile(0, 0, 0, 22)
+	require.NoError(t, err)
+	box := world.BBox(0)
+	require.Equal(t, -180.0, box.MinLon)
+	require.Equal(t, 180.0, box.MaxLon)
+	require.InDelta(t, maxMercatorLat, box.MaxLat, 1e-9)
+	x, y := world.Project(0, 0, TileExtent)
+	require.Equal(t, TileExtent/2, x)
+	require.Equal(t, TileExtent/2, y)
+
+	// Paris is in tile 10/518/352
+	paris := Tile{Z: 10, X: 518, Y: 352}
+	require.True(t, paris.BBox(0).Contains(2.3522, 48.8566))
+	x, y = paris.Project(48.8566, 2.3522, TileExtent)
+	require.True(t, x >= 0 && x < TileExtent && y >= 0 && y < TileExtent)
+	x, _ = paris.Project(48.8566, 5, TileExtent)
+	require.Greater(t, x, TileExtent)
+}
+
+func TestEncodePointLayer(t *testing.T) {
+	tile := EncodePointLayer("s", []string{"id", "name"}, []PointFeature{
+		{X: 1, Y: 2, Properties: map[string]string{"id": "a"}},
+	})
+	require.Equal(t, []byte{
+		0x1A, 0x24, // layer
+		0x78, 0x02, // version 2
+		0x0A, 0x01, 's', // name
+		0x12, 0x0B, // feature
+		0x12, 0x02, 0x00, 0x00, // tags id=a
+		0x18, 0x01, // point
+		0x22, 0x03, 0x09, 0x02, 0x04, // MoveTo(1, 2)
+		0x1A, 0x02, 'i', 'd', // keys
+		0x1A, 0x04, 'n', 'a', 'm', 'e',
+		0x22, 0x03, 0x0A, 0x01, 'a', // values
+		0x28, 0x80, 0x20, // extent 4096
+	}, tile)
+}
@@ -0,0 +1,246 @@
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WGS84 ellipsoid and UTM projection constants
+const (
+	wgs84A       = 6378137.0
+	wgs84F       = 1 / 298.257223563
+	utmK0        = 0.9996
+	utmEasting0  = 500000.0
+	utmNorthing0 = 10000000.0
+	// utmMinLat and utmMaxLat are the limits of UTM, the polar regions use UPS which is not supported
+	utmMinLat = -80.0
+	utmMaxLat = 84.0
+)
+
+// utmBands are the latitude bands of 8 degrees from 80°S, X is extended to 84°N
+const utmBands = "CDEFGHJKLMNPQRSTUVWX"
+
+// UTM is a position in the Universal Transverse Mercator projection on the WGS84 ellipsoid
+type UTM struct {
+	Zone int
+	// Band is the latitude band letter, N and the following letters are in the northern hemisphere
+	Band     byte
+	Easting  float64
+	Northing float64
+}
+
+// String formats the position as zone and band, easting and northing in meters, e.g. 31U 448252 5411933
+func (u UTM) String() string {
+	return fmt.Sprintf("%d%c %.0f %.0f", u.Zone, u.Band, math.Floor(u.Easting), math.Floor(u.Northing))
+}
+
+func (u UTM) north() bool {
+	return u.Band >= 'N'
+}
+
+func utmZone(lat, lon float64) int {
+	zone := int(math.Floor((lon+180)/6)) + 1
+	if zone > 60 {
+		zone = 60
+	}
+	// Exceptions of southwest Norway and Svalbard
+	switch {
+	case lat >= 56 && lat < 64 && lon >= 3 && lon < 12:
+		return 32
+	case lat >= 72 && lat <= 84 && lon >= 0 && lon < 9:
+		return 31
+	case lat >= 72 && lat <= 84 && lon >= 9 && lon < 21:
+		return 33
+	case lat >= 72 && lat <= 84 && lon >= 21 && lon < 33:
+		return 35
+	case lat >= 72 && lat <= 84 && lon >= 33 && lon < 42:
+		return 37
+	}
+	return zone
+}
+
+func utmBand(lat float64) byte {
+	index := int(math.Floor((lat - utmMinLat) / 8))
+	if index > len(utmBands)-1 {
+		index = len(utmBands) - 1
+	}
+	return utmBands[index]
+}
+
+func centralMeridian(zone int) float64 {
+	return float64(zone-1)*6 - 180 + 3
+}
+
+// meridianArc returns the distance in meters along the central meridian from the equator to the latitude in radians
+func meridianArc(phi float64) float64 {
+	e2 := wgs84F * (2 - wgs84F)
+	e4, e6 := e2*e2, e2*e2*e2
+	return wgs84A * ((1-e2/4-3*e4/64-5*e6/256)*phi -
+		(3*e2/8+3*e4/32+45*e6/1024)*math.Sin(2*phi) +
+		(15*e4/256+45*e6/1024)*math.Sin(4*phi) -
+		(35*e6/3072)*math.Sin(6*phi))
+}
+
+// ToUTM converts a location to UTM, the zone is chosen by the location
+func ToUTM(lat, lon float64) (UTM, error) {
+	if lat < utmMinLat || lat > utmMaxLat || math.Abs(lon) > 180 {
+		return UTM{}, errors.New("UTM is only defined between 80°S and 84°N")
+	}
+	zone := utmZone(lat, lon)
+	easting, northing := toTransverseMercator(lat, lon, zone)
+	if lat < 0 {
+		northing += utmNorthing0
+	}
+	return UTM{Zone: zone, Band: utmBand(lat), Easting: easting, Northing: northing}, nil
+}
+
+func toTransverseMercator(lat, lon float64, zone int) (easting, northing float64) {
+	e2 := wgs84F * (2 - wgs84F)
+	ep2 := e2 / (1 - e2)
+	phi := lat * math.Pi / 180
+	n := wgs84A / math.Sqrt(1-e2*math.Sin(phi)*math.Sin(phi))
+	t := math.Tan(phi) * math.Tan(phi)
+	c := ep2 * math.Cos(phi) * math.Cos(phi)
+	a := math.Cos(phi) * normalizeLon(lon-centralMeridian(zone)) * math.Pi / 180
+	easting = utmK0*n*(a+(1-t+c)*math.Pow(a, 3)/6+(5-18*t+t*t+72*c-58*ep2)*math.Pow(a, 5)/120) + utmEasting0
+	northing = utmK0 * (meridianArc(phi) + n*math.Tan(phi)*(a*a/2+(5-t+9*c+4*c*c)*math.Pow(a, 4)/24+
+		(61-58*t+t*t+600*c-330*ep2)*math.Pow(a, 6)/720))
+	return easting, northing
+}
+
+// LatLon converts the UTM position to a location
+func (u UTM) LatLon() (float64, float64) {
+	e2 := wgs84F * (2 - wgs84F)
+	ep2 := e2 / (1 - e2)
+	northing := u.Northing
+	if !u.north() {
+		northing -= utmNorthing0
+	}
+	e4, e6 := e2*e2, e2*e2*e2
+	mu := northing / utmK0 / (wgs84A * (1 - e2/4 - 3*e4/64 - 5*e6/256))
+	e1 := (1 - math.Sqrt(1-e2)) / (1 + math.Sqrt(1-e2))
+	phi1 := mu + (3*e1/2-27*math.Pow(e1, 3)/32)*math.Sin(2*mu) +
+		(21*e1*e1/16-55*math.Pow(e1, 4)/32)*math.Sin(4*mu) +
+		(151*math.Pow(e1, 3)/96)*math.Sin(6*mu) +
+		(1097*math.Pow(e1, 4)/512)*math.Sin(8*mu)
+	sin1 := math.Sin(phi1)
+	n1 := wgs84A / math.Sqrt(1-e2*sin1*sin1)
+	t1 := math.Tan(phi1) * math.Tan(phi1)
+	c1 := ep2 * math.Cos(phi1) * math.Cos(phi1)
+	r1 := wgs84A * (1 - e2) / math.Pow(1-e2*sin1*sin1, 1.5)
+	d := (u.Easting - utmEasting0) / (n1 * utmK0)
+	phi := phi1 - (n1*math.Tan(phi1)/r1)*(d*d/2-(5+3*t1+10*c1-4*c1*c1-9*ep2)*math.Pow(d, 4)/24+
+		(61+90*t1+298*c1+45*t1*t1-252*ep2-3*c1*c1)*math.Pow(d, 6)/720)
+	lambda := (d - (1+2*t1+c1)*math.Pow(d, 3)/6 + (5-2*c1+28*t1-3*c1*c1+8*ep2+24*t1*t1)*math.Pow(d, 5)/120) / math.Cos(phi1)
+	return phi * 180 / math.Pi, normalizeLon(centralMeridian(u.Zone) + lambda*180/math.Pi)
+}
+
+// parseZoneBand parses a zone number followed by a latitude band letter, e.g. 31U
+func parseZoneBand(text string) (int, byte, error) {
+	if len(text) < 2 {
+		return 0, 0, fmt.Errorf("invalid zone %q", text)
+	}
+	band := text[len(text)-1]
+	zone, err := strconv.Atoi(text[:len(text)-1])
+	if err != nil || zone < 1 || zone > 60 || strings.IndexByte(utmBands, band) < 0 {
+		return 0, 0, fmt.Errorf("invalid zone %q, it must be a zone from 1 to 60 and a latitude band letter", text)
+	}
+	return zone, band, nil
+}
+
+// ParseUTM parses a UTM position written as zone and band, easting and northing in meters, e.g. 31U 448252 5411933
+func ParseUTM(text string) (UTM, error) {
+	fields := strings.Fields(strings.ToUpper(text))
+	if len(fields) != 3 {
+		return UTM{}, fmt.Errorf("invalid UTM position %q, it must be zone and band, easting and northing", text)
+	}
+	zone, band, err := parseZoneBand(fields[0])
+	if err != nil {
+		return UTM{}, err
+	}
+	easting, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "E"), 64)
+	if err != nil || easting < 100000 || easting > 900000 {
+		return UTM{}, fmt.Errorf("invalid UTM easting %q", fields[1])
+	}
+	northing, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "N"), 64)
+	if err != nil || northing < 0 || northing > utmNorthing0 {
+		return UTM{}, fmt.Errorf("invalid UTM northing %q", fields[2])
+	}
+	return UTM{Zone: zone, Band: band, Easting: easting, Northing: northing}, nil
+}
+
+// MGRS 100 km square letters of the rows and of the columns of each set of zones
+const mgrsRows = "ABCDEFGHJKLMNPQRSTUV"
+
+var mgrsColumns = [3]string{"STUVWXYZ", "ABCDEFGH", "JKLMNPQR"}
+
+// FormatMGRS formats a location as a Military Grid Reference System position with 1 meter precision, e.g. 31U DQ 48251 11932
+func FormatMGRS(lat, lon float64) (string, error) {
+	u, err := ToUTM(lat, lon)
+	if err != nil {
+		return "", err
+	}
+	column := int(math.Floor(u.Easting/100000)) - 1
+	row := (int(math.Floor(u.Northing/100000)) + mgrsRowOffset(u.Zone)) % len(mgrsRows)
+	return fmt.Sprintf("%d%c %c%c %05d %05d", u.Zone, u.Band, mgrsColumns[u.Zone%3][column], mgrsRows[row],
+		int(math.Floor(u.Easting))%100000, int(math.Floor(u.Northing))%100000), nil
+}
+
+// mgrsRowOffset returns the shift of the row letters, which start at F in even zones
+func mgrsRowOffset(zone int) int {
+	if zone%2 == 0 {
+		return 5
+	}
+	return 0
+}
+
+// ParseMGRS parses a Military Grid Reference System position with 0 to 5 digits of easting and northing, spaces are optional,
+// e.g. 31U DQ 48251 11932 or 31UDQ4811. The position is the south west corner of the square of its precision.
+func ParseMGRS(text string) (UTM, error) {
+	value := strings.ToUpper(strings.Join(strings.Fields(text), ""))
+	i := 0
+	for i < len(value) && value[i] >= '0' && value[i] <= '9' {
+		i++
+	}
+	if len(value) < i+3 {
+		return UTM{}, fmt.Errorf("invalid MGRS position %q", text)
+	}
+	zone, band, err := parseZoneBand(value[:i+1])
+	if err != nil {
+		return UTM{}, err
+	}
+	column := strings.IndexByte(mgrsColumns[zone%3], value[i+1])
+	row := strings.IndexByte(mgrsRows, value[i+2])
+	digits := value[i+3:]
+	if column < 0 || row < 0 || len(digits)%2 != 0 || len(digits) > 10 {
+		return UTM{}, fmt.Errorf("invalid MGRS position %q", text)
+	}
+	precision := len(digits) / 2
+	easting, northing := 0, 0
+	if precision > 0 {
+		easting, err = strconv.Atoi(digits[:precision])
+		if err == nil {
+			northing, err = strconv.Atoi(digits[precision:])
+		}
+		if err != nil {
+			return UTM{}, fmt.Errorf("invalid MGRS position %q", text)
+		}
+	}
+	scale := math.Pow(10, float64(5-precision))
+	u := UTM{Zone: zone, Band: band, Easting: float64(column+1)*100000 + float64(easting)*scale}
+	// The row letters repeat every 2000 km, the band tells which cycle the position is in
+	row = (row - mgrsRowOffset(zone) + len(mgrsRows)) % len(mgrsRows)
+	u.Northing = float64(row)*100000 + float64(northing)*scale
+	bandLat := utmMinLat + 8*float64(strings.IndexByte(utmBands, band))
+	_, minNorthing := toTransverseMercator(bandLat, centralMeridian(zone), zone)
+	if bandLat < 0 {
+		minNorthing += utmNorthing0
+	}
+	for u.Northing < minNorthing-100000 {
+		u.Northing += 2000000
+	}
+	return u, nil
+}
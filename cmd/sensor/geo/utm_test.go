@@ -0,0 +1,67 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToUTM(t *testing.T) {
+	u, err := ToUTM(0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 31, u.Zone)
+	require.Equal(t, byte('N'), u.Band)
+	require.InDelta(t, 166021.44, u.Easting, 0.01)
+	require.InDelta(t, 0, u.Northing, 0.01)
+	u, err = ToUTM(0, 3)
+	require.NoError(t, err)
+	require.InDelta(t, 500000, u.Easting, 1e-6)
+	// Southwest Norway and Svalbard exceptions
+	u, _ = ToUTM(60, 5)
+	require.Equal(t, 32, u.Zone)
+	u, _ = ToUTM(78, 15)
+	require.Equal(t, 33, u.Zone)
+	u, _ = ToUTM(78, 8)
+	require.Equal(t, 31, u.Zone)
+	_, err = ToUTM(85, 0)
+	require.Error(t, err)
+}
+
+func TestUTMRoundTrip(t *testing.T) {
+	for _, location := range [][2]float64{{48.8584, 2.2945}, {-33.8568, 151.2153}, {-79.5, -179.9}, {83.9, 179.9}, {0.0001, -0.0001}} {
+		u, err := ToUTM(location[0], location[1])
+		require.NoError(t, err)
+		parsed, err := ParseUTM(u.String())
+		require.NoError(t, err)
+		lat, lon := parsed.LatLon()
+		require.Less(t, Distance(location[0], location[1], lat, lon), 2.0, u.String())
+	}
+	_, err := ParseUTM("31U 448252")
+	require.Error(t, err)
+	_, err = ParseUTM("61U 448252 5411954")
+	require.Error(t, err)
+	_, err = ParseUTM("31I 448252 5411954")
+	require.Error(t, err)
+}
+
+func TestMGRS(t *testing.T) {
+	mgrs, err := FormatMGRS(48.8584, 2.2945)
+	require.NoError(t, err)
+	require.Equal(t, "31U DQ 48252 11954", mgrs)
+	for _, location := range [][2]float64{{48.8584, 2.2945}, {-33.8568, 151.2153}, {-79.5, -179.9}, {83.9, 179.9}, {0.0001, -0.0001}, {-0.0001, 0.0001}} {
+		mgrs, err = FormatMGRS(location[0], location[1])
+		require.NoError(t, err)
+		u, err := ParseMGRS(mgrs)
+		require.NoError(t, err, mgrs)
+		lat, lon := u.LatLon()
+		require.Less(t, Distance(location[0], location[1], lat, lon), 2.0, mgrs)
+	}
+	// Lower precision is the south west corner of the square
+	u, err := ParseMGRS("31udq4811")
+	require.NoError(t, err)
+	require.Equal(t, UTM{Zone: 31, Band: 'U', Easting: 448000, Northing: 5411000}, u)
+	for _, text := range []string{"31U DQ 4825 119", "31U DI 48252 11954", "31U DQ 48252 1195", "31U"} {
+		_, err = ParseMGRS(text)
+		require.Error(t, err, text)
+	}
+}
@@ -0,0 +1,62 @@
+package geo
+
+// Point is a position in a planar projection
+type Point struct {
+	X float64
+	Y float64
+}
+
+// VoronoiCells returns the Voronoi cell of each site clipped to the area, as open rings in the same order as the sites.
+// Each cell is the area clipped by the half-planes closer to its site than to every other site, so this is
+// O(n²) and meant for at most a few thousand sites. Sites with the same position get empty cells but the first one.
+func VoronoiCells(sites []Point, area []Point) [][]Point {
+	cells := make([][]Point, len(sites))
+	for i, site := range sites {
+		cell := area
+		for j, other := range sites {
+			if i == j {
+				continue
+			}
+			if other == site {
+				if j < i {
+					cell = nil
+					break
+				}
+				continue
+			}
+			cell = clipCloser(cell, site, other)
+			if len(cell) == 0 {
+				break
+			}
+		}
+		cells[i] = cell
+	}
+	return cells
+}
+
+// clipCloser keeps the part of the polygon closer to site than to other using Sutherland-Hodgman
+func clipCloser(polygon []Point, site, other Point) []Point {
+	// Points p closer to site satisfy n·p <= c, with n = other - site and c = n·midpoint
+	n := Point{X: other.X - site.X, Y: other.Y - site.Y}
+	c := n.X*(site.X+other.X)/2 + n.Y*(site.Y+other.Y)/2
+	side := func(p Point) float64 {
+		return n.X*p.X + n.Y*p.Y - c
+	}
+	var result []Point
+	for i := range polygon {
+		current := polygon[i]
+		previous := polygon[(i+len(polygon)-1)%len(polygon)]
+		currentSide, previousSide := side(current), side(previous)
+		if (currentSide <= 0) != (previousSide <= 0) {
+			t := previousSide / (previousSide - currentSide)
+			result = append(result, Point{
+				X: previous.X + t*(current.X-previous.X),
+				Y: previous.Y + t*(current.Y-previous.Y),
+			})
+		}
+		if currentSide <= 0 {
+			result = append(result, current)
+		}
+	}
+	return result
+}
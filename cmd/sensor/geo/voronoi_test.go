@@ -0,0 +1,17 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVoronoiCells(t *testing.T) {
+	area := []Point{{0, 0}, {4, 0}, {4, 2}, {0, 2}}
+	cells := VoronoiCells([]Point{{1, 1}, {3, 1}, {3, 1}}, area)
+	require.Equal(t, []Point{{0, 0}, {2, 0}, {2, 2}, {0, 2}}, cells[0])
+	require.Equal(t, []Point{{2, 0}, {4, 0}, {4, 2}, {2, 2}}, cells[1])
+	require.Empty(t, cells[2])
+	cells = VoronoiCells([]Point{{1, 1}}, area)
+	require.Equal(t, area, cells[0])
+}
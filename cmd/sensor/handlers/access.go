@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/service"
+	"github.com/gorilla/mux"
+)
+
+func (app *Application) transferOwnership(w http.ResponseWriter, r *http.Request) {
+	var transfer service.OwnerTransfer
+	ctx := r.Context()
+	err := json.NewDecoder(r.Body).Decode(&transfer)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	err = app.sensors.TransferOwnership(ctx, mux.Vars(r)["id"], transfer)
+	if err != nil {
+		app.jsonErrorReturn(w, err, accessStatus(err, http.StatusBadRequest))
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
+
+func (app *Application) setACL(w http.ResponseWriter, r *http.Request) {
+	var acl []service.ACLEntry
+	ctx := r.Context()
+	err := json.NewDecoder(r.Body).Decode(&acl)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	err = app.sensors.SetACL(ctx, mux.Vars(r)["id"], acl)
+	if err != nil {
+		app.jsonErrorReturn(w, err, accessStatus(err, http.StatusBadRequest))
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
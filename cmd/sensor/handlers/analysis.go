@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/service"
+	"github.com/gorilla/mux"
+)
+
+func (app *Application) analyzeCoverage(w http.ResponseWriter, r *http.Request) {
+	var request service.AnalysisRequest
+	ctx := r.Context()
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	m, err := app.sensors.AnalyzeCoverage(ctx, request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, m)
+}
+
+func (app *Application) catchments(w http.ResponseWriter, r *http.Request) {
+	var request service.AnalysisRequest
+	ctx := r.Context()
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	m, err := app.sensors.Catchments(ctx, request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, m)
+}
+
+func (app *Application) findCovering(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	m, err := app.sensors.FindCovering(ctx, vars["lat"], vars["lon"])
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, m)
+}
+
+func (app *Application) checkAreaCoverage(w http.ResponseWriter, r *http.Request) {
+	var area service.GeoJSONPolygon
+	ctx := r.Context()
+	err := json.NewDecoder(r.Body).Decode(&area)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	m, err := app.sensors.CheckAreaCoverage(ctx, area)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, m)
+}
+
+func (app *Application) findAlong(w http.ResponseWriter, r *http.Request) {
+	var request service.AlongRequest
+	ctx := r.Context()
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	m, err := app.sensors.FindAlong(ctx, request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, m)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAPIKeyCacheTTL = time.Minute
+	apiKeyRequestTimeout  = 5 * time.Second
+)
+
+// ErrInvalidAPIKey is returned for the API keys the authenticator rejects
+var ErrInvalidAPIKey = errors.New("API key is invalid")
+
+// apiKeyValidator validates API keys with the authenticator, caching the result so that it is not called on every
+// request. A revoked key is rejected once the revocation list is refreshed, an expired one when its cache entry expires.
+type apiKeyValidator struct {
+	url    string
+	client *http.Client
+	cache  *claimsCache
+}
+
+func newAPIKeyValidator(authenticatorURL string, ttl time.Duration) *apiKeyValidator {
+	return &apiKeyValidator{
+		url:    strings.TrimSuffix(authenticatorURL, "/") + "/apikeys/validate",
+		client: &http.Client{Timeout: apiKeyRequestTimeout},
+		cache:  newClaimsCache(ttl),
+	}
+}
+
+// validate returns the claims of the key, ErrInvalidAPIKey when the authenticator rejects it
+func (v *apiKeyValidator) validate(key string) (*TokenClaims, error) {
+	now := time.Now()
+	if cached, ok := v.cache.get(key, now); ok {
+		return cached.claims, cached.err
+	}
+	claims, err := v.request(context.Background(), key)
+	if err != nil && !errors.Is(err, ErrInvalidAPIKey) {
+		// The key is validated again on the next request
+		return nil, err
+	}
+	v.cache.put(key, claims, err, now)
+	return claims, err
+}
+
+// request validates the key with the authenticator
+func (v *apiKeyValidator) request(ctx context.Context, key string) (*TokenClaims, error) {
+	body, err := json.Marshal(map[string]string{"key": key})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := v.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errAuthenticatorUnavailable, err)
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, ErrInvalidAPIKey
+	default:
+		return nil, fmt.Errorf("%w: status %d for the API key", errAuthenticatorUnavailable, response.StatusCode)
+	}
+	var claims TokenClaims
+	err = json.NewDecoder(response.Body).Decode(&claims)
+	if err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// newAPIKeyValidatorFromEnv validates API keys with the authenticator at AUTHENTICATOR_URL, caching them for
+// API_KEY_CACHE_TTL, it returns nil when no authenticator is configured
+func newAPIKeyValidatorFromEnv() (func(key string) (*TokenClaims, error), error) {
+	authenticatorURL := os.Getenv("AUTHENTICATOR_URL")
+	if authenticatorURL == "" {
+		return nil, nil
+	}
+	ttl, err := durationFromEnv("API_KEY_CACHE_TTL", defaultAPIKeyCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	return newAPIKeyValidator(authenticatorURL, ttl).validate, nil
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyValidator(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		require.Equal(t, "/apikeys/validate", r.URL.Path)
+		var request map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		if request["key"] != "valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(TokenClaims{UserName: "ingest", Scope: "sensor:write"}))
+	}))
+	t.Cleanup(server.Close)
+
+	validator := newAPIKeyValidator(server.URL+"/", time.Minute)
+	claims, err := validator.validate("valid")
+	require.NoError(t, err)
+	require.Equal(t, "ingest", claims.UserName)
+	_, err = validator.validate("invalid")
+	require.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	// Valid and invalid keys are cached
+	_, err = validator.validate("valid")
+	require.NoError(t, err)
+	_, err = validator.validate("invalid")
+	require.ErrorIs(t, err, ErrInvalidAPIKey)
+	require.Equal(t, 2, calls)
+
+	// Unreachable authenticators are not cached
+	server.Close()
+	_, err = validator.validate("other")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrInvalidAPIKey)
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	app := &Application{errorLog: logger, infoLog: logger}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	write := app.authorize(routePolicy{http.MethodPost, "/", ok, PermissionSensorWrite})
+	status := func(key string) int {
+		request := httptest.NewRequest(http.MethodPost, "/", nil)
+		request.Header.Set("Authorization", "ApiKey "+key)
+		recorder := httptest.NewRecorder()
+		write(recorder, request)
+		return recorder.Code
+	}
+
+	// Without an authenticator API keys are not accepted
+	require.Equal(t, http.StatusUnauthorized, status("valid"))
+
+	app.ValidateAPIKey = func(key string) (*TokenClaims, error) {
+		if key != "valid" {
+			return nil, ErrInvalidAPIKey
+		}
+		return &TokenClaims{UserName: "ingest", Scope: "sensor:write"}, nil
+	}
+	require.Equal(t, http.StatusOK, status("valid"))
+	require.Equal(t, http.StatusUnauthorized, status("invalid"))
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// Defaults of the expected claims of the tokens issued by the authenticator
+const (
+	defaultIssuer    = "sensor-metadata-authenticator"
+	defaultAudience  = "sensor-metadata"
+	defaultClockSkew = 30 * time.Second
+)
+
+// TokenValidation holds the checks of the registered claims of a token
+type TokenValidation struct {
+	Issuer   string
+	Audience string
+	// ClockSkew is the tolerance on expiry and issue times for clocks out of sync
+	ClockSkew time.Duration
+}
+
+// Validate checks that the token has not expired, was issued, and that its issuer and audience are the expected ones
+func (v TokenValidation) Validate(claims TokenClaims, now time.Time) error {
+	if claims.ExpiresAt == nil || now.After(claims.ExpiresAt.Add(v.ClockSkew)) {
+		return errors.New("token has expired")
+	}
+	if claims.IssuedAt != nil && claims.IssuedAt.After(now.Add(v.ClockSkew)) {
+		return errors.New("token used before issued")
+	}
+	if claims.NotBefore != nil && claims.NotBefore.After(now.Add(v.ClockSkew)) {
+		return errors.New("token is not valid yet")
+	}
+	if claims.Issuer != v.Issuer {
+		return errors.New("token has an invalid issuer")
+	}
+	if !claims.VerifyAudience(v.Audience, true) {
+		return errors.New("token has an invalid audience")
+	}
+	return nil
+}
+
+// NewTokenValidationFromEnv reads the expected issuer and audience and the clock skew from JWT_ISSUER, JWT_AUDIENCE
+// and JWT_CLOCK_SKEW, using the defaults of the authenticator for the ones not set
+func NewTokenValidationFromEnv() (TokenValidation, error) {
+	validation := TokenValidation{
+		Issuer:    os.Getenv("JWT_ISSUER"),
+		Audience:  os.Getenv("JWT_AUDIENCE"),
+		ClockSkew: defaultClockSkew,
+	}
+	if validation.Issuer == "" {
+		validation.Issuer = defaultIssuer
+	}
+	if validation.Audience == "" {
+		validation.Audience = defaultAudience
+	}
+	if skew := os.Getenv("JWT_CLOCK_SKEW"); skew != "" {
+		var err error
+		validation.ClockSkew, err = time.ParseDuration(skew)
+		if err != nil || validation.ClockSkew < 0 {
+			return validation, errors.New("JWT_CLOCK_SKEW must be a positive duration such as 30s")
+		}
+	}
+	return validation, nil
+}
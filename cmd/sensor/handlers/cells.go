@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/service"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultCellPrecision = 7
+	mvtContentType       = "application/vnd.mapbox-vector-tile"
+	// tiles are revalidated after a minute, the ETag changes whenever the sensors of the tile change
+	tileCacheControl = "public, max-age=60"
+	// the tiles of a tenant must not be cached by shared caches
+	privateTileCacheControl = "private, max-age=60"
+)
+
+func (app *Application) findByCell(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	cell := vars["cell"]
+	limit, err := intQueryParam(r, "limit", defaultListLimit)
+	if err != nil || limit <= 0 || limit > maxListLimit {
+		app.jsonErrorReturn(w, errors.New("limit must be between 1 and 1000"), http.StatusBadRequest)
+		return
+	}
+	m, err := app.sensors.FindByCell(ctx, cell, int64(limit))
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, m)
+}
+
+func (app *Application) countByCell(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	within := r.URL.Query().Get("within")
+	precision, err := intQueryParam(r, "precision", len(within)+1)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	m, err := app.sensors.CountByCell(ctx, within, precision)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, m)
+}
+
+func (app *Application) tags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	m, err := app.sensors.Tags(ctx)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, m)
+}
+
+func (app *Application) findNeighbourCells(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	id := vars["id"]
+	precision, err := intQueryParam(r, "precision", defaultCellPrecision)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	m, err := app.sensors.FindNeighbourCells(ctx, id, precision)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, m)
+}
+
+func (app *Application) clusters(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	zoom, err := intQueryParam(r, "zoom", 0)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	level, err := levelFilter(r)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	m, err := app.sensors.Clusters(ctx, service.ClusterQuery{
+		LevelFilter: level,
+		BBox:        query.Get("bbox"),
+		Zoom:        zoom,
+		Tags:        query["tag"],
+	})
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, m)
+}
+
+func (app *Application) tile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	var query service.TileQuery
+	var err error
+	for name, value := range map[string]*int{"z": &query.Z, "x": &query.X, "y": &query.Y} {
+		*value, err = strconv.Atoi(vars[name])
+		if err != nil {
+			app.jsonErrorReturn(w, errors.New(name+" must be an integer"), http.StatusBadRequest)
+			return
+		}
+	}
+	query.Tags = r.URL.Query()["tag"]
+	tile, err := app.sensors.Tile(ctx, query)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	hash := sha256.Sum256(tile)
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	// The tiles of the callers with a token are those of their tenant, shared caches only keep the anonymous ones
+	w.Header().Set("Vary", "Authorization")
+	if hasToken(r) || db.PrincipalFromContext(ctx) != nil {
+		w.Header().Set("Cache-Control", privateTileCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", tileCacheControl)
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		app.emptyReturn(w, http.StatusNotModified)
+		return
+	}
+	app.binaryReturn(w, http.StatusOK, mvtContentType, tile)
+}
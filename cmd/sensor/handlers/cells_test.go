@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/service"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+// tileService returns the same tile to every caller
+type tileService struct {
+	service.SensorMetadataService
+}
+
+func (tileService) Tile(ctx context.Context, _ service.TileQuery) ([]byte, error) {
+	return []byte("tile"), nil
+}
+
+func TestTileCacheControl(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	app := &Application{
+		errorLog: logger,
+		infoLog:  logger,
+		sensors:  tileService{},
+		ParseToken: func(token string) (*TokenClaims, error) {
+			return &TokenClaims{UserName: "test", Tenant: "acme", Scope: PermissionSensorRead}, nil
+		},
+	}
+	tile := app.authorize(routePolicy{http.MethodGet, "/tiles/{z}/{x}/{y}.mvt", app.tile, PermissionSensorRead})
+	headers := func(token string) http.Header {
+		request := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/tiles/1/0/0.mvt", nil),
+			map[string]string{"z": "1", "x": "0", "y": "0"})
+		if token != "" {
+			request.Header.Set("Authorization", "token "+token)
+		}
+		recorder := httptest.NewRecorder()
+		tile(recorder, request)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		return recorder.Header()
+	}
+
+	// Shared caches keep the anonymous tiles apart from the ones of the tenants
+	anonymous := headers("")
+	require.Equal(t, tileCacheControl, anonymous.Get("Cache-Control"))
+	require.Equal(t, "Authorization", anonymous.Get("Vary"))
+	authenticated := headers("acme")
+	require.Equal(t, privateTileCacheControl, authenticated.Get("Cache-Control"))
+	require.Equal(t, "Authorization", authenticated.Get("Vary"))
+
+	// Tiles read with authentication required are all private
+	app.authenticateReads = true
+	tile = app.authorize(routePolicy{http.MethodGet, "/tiles/{z}/{x}/{y}.mvt", app.tile, PermissionSensorRead})
+	require.Equal(t, privateTileCacheControl, headers("acme").Get("Cache-Control"))
+}
@@ -9,6 +9,11 @@ import (
 	"github.com/gorilla/mux"
 )
 
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
 func (app *Application) findByID(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
@@ -18,6 +23,13 @@ func (app *Application) findByID(w http.ResponseWriter, r *http.Request) {
 		app.jsonErrorReturn(w, err, http.StatusBadRequest)
 		return
 	}
+	if format := r.URL.Query().Get("coords"); format != "" {
+		m.Location, err = service.FormatLocation(m.Location, format)
+		if err != nil {
+			app.jsonErrorReturn(w, err, http.StatusBadRequest)
+			return
+		}
+	}
 	app.jsonReturn(w, http.StatusOK, m)
 }
 
@@ -37,20 +49,75 @@ func (app *Application) findNearestByLocatioName(w http.ResponseWriter, r *http.
 	ctx := r.Context()
 	vars := mux.Vars(r)
 	id := vars["location"]
-	m, err := app.sensors.FindNearestByLocatioName(ctx, id)
+	filter, err := nearestFilter(r)
 	if err != nil {
 		app.jsonErrorReturn(w, err, http.StatusBadRequest)
 		return
 	}
+	m, err := app.sensors.FindNearestByLocatioName(ctx, id, filter)
+	if err != nil {
+		app.jsonErrorReturn(w, err, notFoundStatus(err, http.StatusBadRequest))
+		return
+	}
 	app.jsonReturn(w, http.StatusOK, m)
 }
 
 func (app *Application) findNearest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	location := service.Location{
+		Lat:         vars["lat"],
+		Lon:         vars["lon"],
+		Format:      query.Get("format"),
+		Coordinates: query.Get("coordinates"),
+	}
+	// Without path values lat and lon may be query parameters
+	if location.Lat == "" && location.Lon == "" {
+		location.Lat = query.Get("lat")
+		location.Lon = query.Get("lon")
+	}
+	filter, err := nearestFilter(r)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	m, err := app.sensors.FindNearest(ctx, location, filter)
+	if err != nil {
+		app.jsonErrorReturn(w, err, notFoundStatus(err, http.StatusBadRequest))
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, m)
+}
+
+func (app *Application) list(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	filter := service.SensorListFilter{
+		Tags:     query["tag"],
+		TimeZone: query.Get("timeZone"),
+		After:    query.Get("after"),
+	}
+	limit, err := intQueryParam(r, "limit", defaultListLimit)
+	if err != nil || limit <= 0 || limit > maxListLimit {
+		app.jsonErrorReturn(w, errors.New("limit must be between 1 and 1000"), http.StatusBadRequest)
+		return
+	}
+	filter.Limit = int64(limit)
+	m, err := app.sensors.List(ctx, filter)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, m)
+}
+
+func (app *Application) findTimeZone(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
 	lat := vars["lat"]
 	lon := vars["lon"]
-	m, err := app.sensors.FindNearest(ctx, lat, lon)
+	m, err := app.sensors.FindTimeZone(ctx, lat, lon)
 	if err != nil {
 		app.jsonErrorReturn(w, err, http.StatusBadRequest)
 		return
@@ -68,7 +135,7 @@ func (app *Application) insert(w http.ResponseWriter, r *http.Request) {
 	}
 	id, err := app.sensors.Add(ctx, sensor)
 	if err != nil {
-		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		app.jsonErrorReturn(w, err, writeStatus(err, http.StatusInternalServerError))
 		return
 	}
 	app.jsonReturn(w, http.StatusCreated, ID{ID: id})
@@ -84,7 +151,7 @@ func (app *Application) insertWithLocationName(w http.ResponseWriter, r *http.Re
 	}
 	id, err := app.sensors.AddWithLocationName(ctx, sensor)
 	if err != nil {
-		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		app.jsonErrorReturn(w, err, writeStatus(err, http.StatusInternalServerError))
 		return
 	}
 	app.jsonReturn(w, http.StatusCreated, ID{ID: id})
@@ -96,7 +163,7 @@ func (app *Application) delete(w http.ResponseWriter, r *http.Request) {
 	id := vars["id"]
 	err := app.sensors.Delete(ctx, id)
 	if err != nil {
-		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		app.jsonErrorReturn(w, err, accessStatus(err, http.StatusBadRequest))
 		return
 	}
 	app.emptyReturn(w, http.StatusNoContent)
@@ -119,7 +186,7 @@ func (app *Application) update(w http.ResponseWriter, r *http.Request) {
 	}
 	err = app.sensors.Update(ctx, sensor)
 	if err != nil {
-		app.jsonErrorReturn(w, err, http.StatusInternalServerError)
+		app.jsonErrorReturn(w, err, writeStatus(err, http.StatusInternalServerError))
 		return
 	}
 	app.emptyReturn(w, http.StatusNoContent)
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/service"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+// duplicateNameService is a service where every sensor name is already used
+type duplicateNameService struct {
+	service.SensorMetadataService
+}
+
+func (duplicateNameService) Add(context.Context, service.SensorMetadata) (string, error) {
+	return "", db.ErrDuplicateName
+}
+
+func (duplicateNameService) Update(context.Context, service.SensorMetadata) error {
+	return db.ErrDuplicateName
+}
+
+func TestDuplicateName(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	app := &Application{errorLog: logger, infoLog: logger, sensors: duplicateNameService{}}
+
+	recorder := httptest.NewRecorder()
+	app.insert(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"Sensor 1"}`)))
+	require.Equal(t, http.StatusConflict, recorder.Code)
+
+	id := "63bcf00cf3ed6129b61c137b"
+	request := httptest.NewRequest(http.MethodPut, "/"+id, strings.NewReader(`{"id":"`+id+`","name":"Sensor 1"}`))
+	recorder = httptest.NewRecorder()
+	app.update(recorder, mux.SetURLVars(request, map[string]string{"id": id}))
+	require.Equal(t, http.StatusConflict, recorder.Code)
+}
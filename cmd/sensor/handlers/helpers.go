@@ -2,7 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/service"
 )
 
 // Juca is a structure to return errors in json format
@@ -39,3 +46,125 @@ func (app Application) emptyReturn(w http.ResponseWriter, statusCode int) {
 	w.WriteHeader(statusCode)
 	app.infoLog.Printf("return empty %d", statusCode)
 }
+
+// intQueryParam returns the integer query parameter or the default value when absent
+func intQueryParam(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.New(name + " must be an integer")
+	}
+	return result, nil
+}
+
+func (app Application) binaryReturn(w http.ResponseWriter, statusCode int, contentType string, body []byte) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(statusCode)
+	_, err := w.Write(body)
+	if err != nil {
+		app.errorLog.Printf("could not write binary return: %s", err.Error())
+	}
+	app.infoLog.Printf("return %s response with %d bytes", contentType, len(body))
+}
+
+// floatQueryParam returns the float query parameter or the default value when absent
+func floatQueryParam(r *http.Request, name string, defaultValue float64) (float64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, errors.New(name + " must be a number")
+	}
+	return result, nil
+}
+
+// nearestFilter reads the tag, type, status, attribute (as name:value), level, maxDistance and at (RFC 3339) query parameters
+func nearestFilter(r *http.Request) (service.NearestFilter, error) {
+	query := r.URL.Query()
+	filter := service.NearestFilter{
+		Tags:   query["tag"],
+		Type:   query.Get("type"),
+		Status: query.Get("status"),
+	}
+	for _, attribute := range query["attribute"] {
+		name, value, ok := strings.Cut(attribute, ":")
+		if !ok {
+			return filter, errors.New("attribute must be name:value")
+		}
+		if filter.Attributes == nil {
+			filter.Attributes = map[string]string{}
+		}
+		filter.Attributes[name] = value
+	}
+	var err error
+	filter.LevelFilter, err = levelFilter(r)
+	if err != nil {
+		return filter, err
+	}
+	filter.MaxDistance, err = floatQueryParam(r, "maxDistance", 0)
+	if err != nil {
+		return filter, err
+	}
+	if at := query.Get("at"); at != "" {
+		moment, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return filter, errors.New("at must be an RFC 3339 timestamp")
+		}
+		filter.At = &moment
+	}
+	return filter, nil
+}
+
+// levelFilter reads the floor, minAltitude, maxAltitude and altitudeDatum query parameters
+func levelFilter(r *http.Request) (service.LevelFilter, error) {
+	query := r.URL.Query()
+	filter := service.LevelFilter{AltitudeDatum: query.Get("altitudeDatum")}
+	if query.Get("floor") != "" {
+		floor, err := intQueryParam(r, "floor", 0)
+		if err != nil {
+			return filter, err
+		}
+		filter.Floor = &floor
+	}
+	for name, value := range map[string]**float64{"minAltitude": &filter.MinAltitude, "maxAltitude": &filter.MaxAltitude} {
+		if query.Get(name) == "" {
+			continue
+		}
+		altitude, err := floatQueryParam(r, name, 0)
+		if err != nil {
+			return filter, err
+		}
+		*value = &altitude
+	}
+	return filter, nil
+}
+
+// writeStatus returns 409 when the tenant already has a sensor with the name, or accessStatus otherwise
+func writeStatus(err error, httpStatus int) int {
+	if errors.Is(err, db.ErrDuplicateName) {
+		return http.StatusConflict
+	}
+	return accessStatus(err, httpStatus)
+}
+
+// accessStatus returns 403 when the user can't change the sensor, or notFoundStatus otherwise
+func accessStatus(err error, httpStatus int) int {
+	if errors.Is(err, service.ErrForbidden) {
+		return http.StatusForbidden
+	}
+	return notFoundStatus(err, httpStatus)
+}
+
+// notFoundStatus returns 404 when nothing matched the query, or the status otherwise
+func notFoundStatus(err error, httpStatus int) int {
+	if errors.Is(err, service.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return httpStatus
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/service"
+	"github.com/gorilla/mux"
+)
+
+func (app *Application) move(w http.ResponseWriter, r *http.Request) {
+	var move service.Move
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	id := vars["id"]
+	err := json.NewDecoder(r.Body).Decode(&move)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	err = app.sensors.Move(ctx, id, move)
+	if err != nil {
+		app.jsonErrorReturn(w, err, writeStatus(err, http.StatusBadRequest))
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
+
+func (app *Application) locationHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	id := vars["id"]
+	m, err := app.sensors.LocationHistory(ctx, id)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, m)
+}
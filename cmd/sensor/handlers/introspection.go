@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Modes of TOKEN_VALIDATION
+const (
+	tokenValidationJWT           = "jwt"
+	tokenValidationIntrospection = "introspection"
+)
+
+const (
+	defaultIntrospectionCacheTTL = 30 * time.Second
+	introspectionRequestTimeout  = 5 * time.Second
+	// claimsCacheSize is the maximum number of cached secrets, the oldest are evicted first
+	claimsCacheSize = 10000
+)
+
+// ErrInactiveToken is returned for the tokens the introspection endpoint reports inactive
+var ErrInactiveToken = errors.New("token is not active")
+
+// errAuthenticatorUnavailable is returned when the authenticator can't validate a token or an API key
+var errAuthenticatorUnavailable = errors.New("authenticator is unavailable")
+
+// claimsCache caches the result of the validation of secrets by the authenticator, by their hash so that the secrets are
+// not kept in memory. It holds at most size secrets, so that random secrets can't grow it without bounds.
+type claimsCache struct {
+	ttl  time.Duration
+	size int
+
+	mu sync.Mutex
+	// order has the entries from the oldest written to the newest
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cachedClaims struct {
+	hash      string
+	claims    *TokenClaims
+	err       error
+	expiresAt time.Time
+}
+
+func newClaimsCache(ttl time.Duration) *claimsCache {
+	return &claimsCache{ttl: ttl, size: claimsCacheSize, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the unexpired result of the validation of the secret
+func (c *claimsCache) get(secret string, now time.Time) (cachedClaims, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[hashSecret(secret)]
+	if !ok {
+		return cachedClaims{}, false
+	}
+	cached := element.Value.(cachedClaims)
+	return cached, now.Before(cached.expiresAt)
+}
+
+// put caches the result of the validation of the secret for the ttl, or until the claims expire if sooner, evicting
+// the oldest secrets when the cache is full
+func (c *claimsCache) put(secret string, claims *TokenClaims, err error, now time.Time) {
+	cached := cachedClaims{hash: hashSecret(secret), claims: claims, err: err, expiresAt: now.Add(c.ttl)}
+	if claims != nil && claims.ExpiresAt != nil && claims.ExpiresAt.Before(cached.expiresAt) {
+		cached.expiresAt = claims.ExpiresAt.Time
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[cached.hash]; ok {
+		c.order.Remove(element)
+		delete(c.entries, cached.hash)
+	}
+	for c.order.Len() >= c.size {
+		oldest := c.order.Remove(c.order.Front()).(cachedClaims)
+		delete(c.entries, oldest.hash)
+	}
+	c.entries[cached.hash] = c.order.PushBack(cached)
+}
+
+// tokenIntrospector validates tokens with the introspection endpoint of RFC 7662 instead of their signature, so that
+// the authenticator decides whether they are active. The results are cached for a while.
+type tokenIntrospector struct {
+	url          string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+	cache        *claimsCache
+}
+
+// introspectionResponse is the description of a token returned by the introspection endpoint
+type introspectionResponse struct {
+	Active bool `json:"active"`
+	TokenClaims
+}
+
+func newTokenIntrospector(introspectionURL, clientID, clientSecret string, ttl time.Duration) *tokenIntrospector {
+	return &tokenIntrospector{
+		url:          introspectionURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: introspectionRequestTimeout},
+		cache:        newClaimsCache(ttl),
+	}
+}
+
+// parse returns the claims of an active token, ErrInactiveToken for the others
+func (i *tokenIntrospector) parse(token string) (*TokenClaims, error) {
+	now := time.Now()
+	if cached, ok := i.cache.get(token, now); ok {
+		return cached.claims, cached.err
+	}
+	claims, err := i.request(context.Background(), token)
+	if err != nil && !errors.Is(err, ErrInactiveToken) {
+		// The token is introspected again on the next request
+		return nil, err
+	}
+	i.cache.put(token, claims, err, now)
+	return claims, err
+}
+
+// request introspects the token with the authenticator, authenticated as the client of the sensor service
+func (i *tokenIntrospector) request(ctx context.Context, token string) (*TokenClaims, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, i.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(i.clientID), url.QueryEscape(i.clientSecret))
+	response, err := i.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errAuthenticatorUnavailable, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d for the introspection", errAuthenticatorUnavailable, response.StatusCode)
+	}
+	var introspection introspectionResponse
+	err = json.NewDecoder(response.Body).Decode(&introspection)
+	if err != nil {
+		return nil, err
+	}
+	if !introspection.Active {
+		return nil, ErrInactiveToken
+	}
+	claims := introspection.TokenClaims
+	if claims.UserName == "" {
+		claims.UserName = claims.Subject
+	}
+	return &claims, nil
+}
+
+// newTokenIntrospectorFromEnv returns the introspector of the tokens when TOKEN_VALIDATION is introspection, and nil
+// when it is jwt or not set. The introspection endpoint is OAUTH_INTROSPECTION_URL, by default the one of the
+// authenticator at AUTHENTICATOR_URL, called with the client OAUTH_CLIENT_ID and OAUTH_CLIENT_SECRET. Results are
+// cached for INTROSPECTION_CACHE_TTL.
+func newTokenIntrospectorFromEnv() (*tokenIntrospector, error) {
+	switch os.Getenv("TOKEN_VALIDATION") {
+	case "", tokenValidationJWT:
+		return nil, nil
+	case tokenValidationIntrospection:
+	default:
+		return nil, fmt.Errorf("TOKEN_VALIDATION must be %s or %s", tokenValidationJWT, tokenValidationIntrospection)
+	}
+	introspectionURL := os.Getenv("OAUTH_INTROSPECTION_URL")
+	if introspectionURL == "" {
+		authenticatorURL := os.Getenv("AUTHENTICATOR_URL")
+		if authenticatorURL == "" {
+			return nil, errors.New("OAUTH_INTROSPECTION_URL or AUTHENTICATOR_URL is required to introspect tokens")
+		}
+		introspectionURL = strings.TrimSuffix(authenticatorURL, "/") + "/oauth/introspect"
+	}
+	clientID := os.Getenv("OAUTH_CLIENT_ID")
+	clientSecret := os.Getenv("OAUTH_CLIENT_SECRET")
+	if clientID == "" || clientSecret == "" {
+		return nil, errors.New("OAUTH_CLIENT_ID and OAUTH_CLIENT_SECRET are required to introspect tokens")
+	}
+	ttl, err := durationFromEnv("INTROSPECTION_CACHE_TTL", defaultIntrospectionCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	return newTokenIntrospector(introspectionURL, clientID, clientSecret, ttl), nil
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenIntrospector(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		// The credentials are form-urlencoded before being encoded in base64
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "sensor" || secret != url.QueryEscape("s3cret+/") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		require.NoError(t, r.ParseForm())
+		if r.PostForm.Get("token") != "active" {
+			require.NoError(t, json.NewEncoder(w).Encode(map[string]bool{"active": false}))
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true, "sub": "ingest", "scope": "sensor:write", "tenant": "acme", "exp": time.Now().Add(time.Hour).Unix(),
+		}))
+	}))
+	t.Cleanup(server.Close)
+
+	introspector := newTokenIntrospector(server.URL, "sensor", "s3cret+/", time.Minute)
+	claims, err := introspector.parse("active")
+	require.NoError(t, err)
+	require.Equal(t, "ingest", claims.UserName)
+	require.Equal(t, "acme", claims.Tenant)
+	require.True(t, claims.HasPermission(PermissionSensorWrite))
+	_, err = introspector.parse("inactive")
+	require.ErrorIs(t, err, ErrInactiveToken)
+
+	// Active and inactive tokens are cached
+	_, err = introspector.parse("active")
+	require.NoError(t, err)
+	_, err = introspector.parse("inactive")
+	require.ErrorIs(t, err, ErrInactiveToken)
+	require.Equal(t, 2, calls)
+
+	// The sensor service must be a registered client
+	_, err = newTokenIntrospector(server.URL, "sensor", "wrong", time.Minute).parse("active")
+	require.ErrorIs(t, err, errAuthenticatorUnavailable)
+}
+
+func TestClaimsCacheSize(t *testing.T) {
+	cache := newClaimsCache(time.Minute)
+	cache.size = 2
+	now := time.Now()
+	cache.put("valid", &TokenClaims{UserName: "test"}, nil, now)
+	cache.put("invalid-1", nil, ErrInvalidAPIKey, now)
+	cache.put("valid", &TokenClaims{UserName: "test"}, nil, now)
+	cache.put("invalid-2", nil, ErrInvalidAPIKey, now)
+
+	// Random secrets evict the oldest written ones instead of growing the cache
+	require.Len(t, cache.entries, 2)
+	require.Equal(t, 2, cache.order.Len())
+	_, ok := cache.get("invalid-1", now)
+	require.False(t, ok)
+	cached, ok := cache.get("valid", now)
+	require.True(t, ok)
+	require.Equal(t, "test", cached.claims.UserName)
+	_, ok = cache.get("valid", now.Add(time.Minute))
+	require.False(t, ok)
+}
+
+func TestBearerToken(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	app := &Application{
+		errorLog: logger,
+		infoLog:  logger,
+		ParseToken: func(token string) (*TokenClaims, error) {
+			if token == "unavailable" {
+				return nil, errAuthenticatorUnavailable
+			}
+			return &TokenClaims{UserName: "test", Scope: token}, nil
+		},
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	write := app.authorize(routePolicy{http.MethodPost, "/", ok, PermissionSensorWrite})
+	status := func(authorization string) int {
+		request := httptest.NewRequest(http.MethodPost, "/", nil)
+		request.Header.Set("Authorization", authorization)
+		recorder := httptest.NewRecorder()
+		write(recorder, request)
+		return recorder.Code
+	}
+
+	require.Equal(t, http.StatusOK, status("Bearer sensor:write"))
+	require.Equal(t, http.StatusForbidden, status("Bearer sensor:read"))
+	require.Equal(t, http.StatusServiceUnavailable, status("Bearer unavailable"))
+}
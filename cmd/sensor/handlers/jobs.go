@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/service"
+	"github.com/gorilla/mux"
+)
+
+func (app *Application) startGeocodeJob(w http.ResponseWriter, r *http.Request) {
+	var request service.GeocodeJobRequest
+	ctx := r.Context()
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	id, err := app.jobs.Start(ctx, request)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusAccepted, ID{ID: id})
+}
+
+func (app *Application) findGeocodeJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	id := vars["id"]
+	job, err := app.jobs.Find(ctx, id)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, job)
+}
+
+func (app *Application) geocodeJobResults(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	id := vars["id"]
+	status := r.URL.Query().Get("status")
+	results, err := app.jobs.Results(ctx, id, status)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.jsonReturn(w, http.StatusOK, results)
+}
+
+func (app *Application) cancelGeocodeJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	id := vars["id"]
+	err := app.jobs.Cancel(ctx, id)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	app.emptyReturn(w, http.StatusNoContent)
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// jwksMinRefresh limits how often the JWKS is fetched again for tokens with an unknown kid
+	jwksMinRefresh     = 10 * time.Second
+	jwksRequestTimeout = 5 * time.Second
+)
+
+// signingAlgorithms are the algorithms tokens can be signed with
+var signingAlgorithms = []string{"RS256", "ES256", "EdDSA"}
+
+// ErrUnknownKey is returned when a token is signed with a key that is not published by the authenticator
+var ErrUnknownKey = errors.New("token is signed with an unknown key")
+
+// VerificationKeys resolves the public key a token is verified with from the kid in its header
+type VerificationKeys interface {
+	VerificationKey(kid string) (interface{}, error)
+}
+
+// staticKey is the public key of tls.crt, it verifies all the tokens when no JWKS is configured
+type staticKey struct {
+	key *rsa.PublicKey
+	err error
+}
+
+func newStaticKey(pem []byte) staticKey {
+	key, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+	if err != nil {
+		err = fmt.Errorf("invalid tls.crt: %v", err)
+	}
+	return staticKey{key: key, err: err}
+}
+
+func (k staticKey) VerificationKey(string) (interface{}, error) {
+	return k.key, k.err
+}
+
+// jsonWebKey is a public key of a JWKS, see RFC 7517 and RFC 8037
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes the key, nil is returned for keys of unsupported types or uses
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, nil
+	}
+	switch {
+	case k.Kty == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key %s", k.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid exponent of key %s", k.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if errX != nil || errY != nil || !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("invalid point of key %s", k.Kid)
+		}
+		return key, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid key %s", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+// jwksCache is a local copy of the JWKS of the authenticator. It is fetched again when a token has an unknown kid, which
+// happens after each rotation of the signing key.
+type jwksCache struct {
+	url    string
+	client *http.Client
+
+	// fetch serializes the requests to the authenticator
+	fetch     sync.Mutex
+	mu        sync.RWMutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+func newJWKSCache(url string) *jwksCache {
+	return &jwksCache{
+		url:    url,
+		client: &http.Client{Timeout: jwksRequestTimeout},
+		keys:   map[string]interface{}{},
+	}
+}
+
+// refresh replaces the local copy with the keys published by the authenticator
+func (c *jwksCache) refresh(ctx context.Context) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("authenticator returned status %d for the JWKS", response.StatusCode)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&set)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			return err
+		}
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	return nil
+}
+
+// VerificationKey returns the cached key with the kid, fetching the JWKS again when it is unknown
+func (c *jwksCache) VerificationKey(kid string) (interface{}, error) {
+	key, fetchedAt := c.cached(kid)
+	if key != nil {
+		return key, nil
+	}
+	c.fetch.Lock()
+	defer c.fetch.Unlock()
+	key, lastFetch := c.cached(kid)
+	if key != nil {
+		return key, nil
+	}
+	// Another request fetched the keys meanwhile, or they were fetched too recently
+	if lastFetch != fetchedAt || time.Since(lastFetch) < jwksMinRefresh {
+		return nil, ErrUnknownKey
+	}
+	err := c.refresh(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the JWKS: %v", err)
+	}
+	key, _ = c.cached(kid)
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (c *jwksCache) cached(kid string) (interface{}, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.keys[kid], c.fetchedAt
+}
+
+// newVerificationKeysFromEnv returns the JWKS of JWKS_URL, or by default of the authenticator at AUTHENTICATOR_URL, and
+// the public key of tls.crt when neither is configured
+func newVerificationKeysFromEnv(errorLog *log.Logger) VerificationKeys {
+	url := os.Getenv("JWKS_URL")
+	if url == "" && os.Getenv("AUTHENTICATOR_URL") != "" {
+		url = strings.TrimSuffix(os.Getenv("AUTHENTICATOR_URL"), "/") + "/.well-known/jwks.json"
+	}
+	if url == "" {
+		return newStaticKey([]byte(os.Getenv("tls.crt")))
+	}
+	cache := newJWKSCache(url)
+	// The service starts even when the authenticator is not reachable yet, the keys are fetched with the first token
+	err := cache.refresh(context.Background())
+	if err != nil {
+		errorLog.Printf("could not load the JWKS: %s", err.Error())
+	}
+	return cache
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/service"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	// maxNearestBatchBytes is the maximum size of the body of a batch, far above MaxNearestBatch points
+	maxNearestBatchBytes = 16 << 20
+)
+
+// errBatchTooLarge is returned when a batch has more than service.MaxNearestBatch points
+var errBatchTooLarge = fmt.Errorf("a batch can have at most %d points", service.MaxNearestBatch)
+
+// findNearestBatch accepts a JSON array of points, answered with an array, or NDJSON with a point per line,
+// answered with a result per line
+func (app *Application) findNearestBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	ndjson := mediaType == ndjsonContentType
+	var queries []service.NearestQuery
+	var err error
+	r.Body = http.MaxBytesReader(w, r.Body, maxNearestBatchBytes)
+	if ndjson {
+		queries, err = readNDJSONQueries(r)
+	} else {
+		queries, err = readJSONQueries(r)
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		app.jsonErrorReturn(w, fmt.Errorf("a batch can have at most %d bytes", maxNearestBatchBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	results, err := app.sensors.FindNearestBatch(ctx, queries)
+	if err != nil {
+		app.jsonErrorReturn(w, err, http.StatusBadRequest)
+		return
+	}
+	if !ndjson {
+		app.jsonReturn(w, http.StatusOK, results)
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	for i := range results {
+		err = encoder.Encode(results[i])
+		if err != nil {
+			app.errorLog.Printf("could not write ndjson return: %s", err.Error())
+			return
+		}
+	}
+	app.infoLog.Printf("return ndjson response with %d results", len(results))
+}
+
+// readJSONQueries reads the points of a JSON array one by one, so that a batch with too many points is rejected
+// without reading all of them
+func readJSONQueries(r *http.Request) ([]service.NearestQuery, error) {
+	decoder := json.NewDecoder(r.Body)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token != json.Delim('[') {
+		return nil, errors.New("the batch must be an array of points")
+	}
+	var queries []service.NearestQuery
+	for decoder.More() {
+		if len(queries) == service.MaxNearestBatch {
+			return nil, errBatchTooLarge
+		}
+		var query service.NearestQuery
+		err = decoder.Decode(&query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid point %d: %w", len(queries)+1, err)
+		}
+		queries = append(queries, query)
+	}
+	_, err = decoder.Token()
+	return queries, err
+}
+
+func readNDJSONQueries(r *http.Request) ([]service.NearestQuery, error) {
+	var queries []service.NearestQuery
+	scanner := bufio.NewScanner(r.Body)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if len(queries) == service.MaxNearestBatch {
+			return nil, errBatchTooLarge
+		}
+		var query service.NearestQuery
+		err := json.Unmarshal(scanner.Bytes(), &query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid point in line %d: %v", line, err)
+		}
+		queries = append(queries, query)
+	}
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return nil, errors.New("a line of the batch is too long")
+	}
+	return queries, scanner.Err()
+}
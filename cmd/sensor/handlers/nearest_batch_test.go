@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/service"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadNearestQueries(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/nearest/batch", strings.NewReader(
+		`[{"id":"a","lat":"1","lon":"2"},{"id":"b","lat":"3","lon":"4"}]`))
+	queries, err := readJSONQueries(request)
+	require.NoError(t, err)
+	require.Len(t, queries, 2)
+	require.Equal(t, "b", queries[1].ID)
+
+	request = httptest.NewRequest(http.MethodPost, "/nearest/batch", strings.NewReader(
+		"{\"id\":\"a\",\"lat\":\"1\",\"lon\":\"2\"}\n\n{\"id\":\"b\",\"lat\":\"3\",\"lon\":\"4\"}\n"))
+	queries, err = readNDJSONQueries(request)
+	require.NoError(t, err)
+	require.Len(t, queries, 2)
+
+	for _, invalid := range []string{`{"id":"a"}`, `[{"id":"a"}`, `[{"id":1}]`} {
+		_, err = readJSONQueries(httptest.NewRequest(http.MethodPost, "/nearest/batch", strings.NewReader(invalid)))
+		require.Error(t, err, invalid)
+	}
+
+	// Batches with too many points are rejected before all of them are read
+	tooMany := "[" + strings.Repeat(`{},`, service.MaxNearestBatch) + "{}]"
+	_, err = readJSONQueries(httptest.NewRequest(http.MethodPost, "/nearest/batch", strings.NewReader(tooMany)))
+	require.ErrorIs(t, err, errBatchTooLarge)
+	tooMany = strings.Repeat("{}\n", service.MaxNearestBatch+1)
+	_, err = readNDJSONQueries(httptest.NewRequest(http.MethodPost, "/nearest/batch", strings.NewReader(tooMany)))
+	require.ErrorIs(t, err, errBatchTooLarge)
+}
+
+func TestNearestBatchBodyLimit(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	app := &Application{errorLog: logger, infoLog: logger}
+	body := `[{"id":"` + strings.Repeat("a", maxNearestBatchBytes) + `"}]`
+	request := httptest.NewRequest(http.MethodPost, "/nearest/batch", strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	app.findNearestBatch(recorder, request)
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"golang.org/x/exp/slices"
+)
+
+// externalPermissions are the permissions the scopes and roles of an external issuer can be mapped to
+var externalPermissions = []string{PermissionSensorRead, PermissionSensorWrite, PermissionSensorDelete,
+	PermissionSensorAdmin, PermissionUserAdmin, PermissionTenantAll}
+
+// tokenIssuer is an issuer tokens are accepted from, with the keys and the checks they are verified with
+type tokenIssuer struct {
+	validation TokenValidation
+	keys       VerificationKeys
+	// mapping maps the claims of an external issuer to those of the authenticator, nil for the authenticator
+	mapping *claimsMapping
+}
+
+// claimsMapping is how the claims of an external issuer are trusted. Its users are told apart from those of the
+// authenticator by the issuer, their permissions are only those configured for their scopes and role, and they belong to
+// the configured tenant whatever their tenant claim.
+type claimsMapping struct {
+	issuer string
+	// permissions are the permissions granted by each scope or role of the issuer
+	permissions map[string][]string
+	tenant      string
+}
+
+// apply replaces the claims of the issuer with those of the authenticator, it rejects the tokens granting no permission
+func (m claimsMapping) apply(claims *TokenClaims) error {
+	if claims.Subject == "" {
+		return errors.New("token has no subject")
+	}
+	var permissions []string
+	for _, external := range append(strings.Fields(claims.Scope), claims.Role) {
+		for _, permission := range m.permissions[external] {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	if len(permissions) == 0 {
+		return errors.New("token grants no permission")
+	}
+	claims.UserName = m.qualify(claims.Subject)
+	claims.Scope = strings.Join(permissions, " ")
+	claims.Role = ""
+	claims.Tenant = m.tenant
+	for i, group := range claims.Groups {
+		claims.Groups[i] = m.qualify(group)
+	}
+	return nil
+}
+
+// qualify prefixes the name of a user or group with the issuer, so that it can't be taken for one of the authenticator
+func (m claimsMapping) qualify(name string) string {
+	return m.issuer + "#" + name
+}
+
+// parseClaimsMapping parses the permissions of the scopes and roles of an external issuer, as a comma separated list of
+// scope or role, equal sign and space separated permissions, e.g. "sensors.read=sensor:read,admin=sensor:read sensor:write"
+func parseClaimsMapping(value string) (map[string][]string, error) {
+	mapping := map[string][]string{}
+	for _, entry := range strings.Split(value, ",") {
+		external, permissions, ok := strings.Cut(entry, "=")
+		external = strings.TrimSpace(external)
+		if !ok || external == "" || len(strings.Fields(permissions)) == 0 {
+			return nil, fmt.Errorf("invalid scope mapping %q", entry)
+		}
+		for _, permission := range strings.Fields(permissions) {
+			if !slices.Contains(externalPermissions, permission) {
+				return nil, fmt.Errorf("unknown permission %s in the scope mapping", permission)
+			}
+			mapping[external] = append(mapping[external], permission)
+		}
+	}
+	return mapping, nil
+}
+
+// tokenIssuers are the issuers tokens are accepted from, the authenticator and optionally an external OpenID Connect
+// issuer
+type tokenIssuers struct {
+	authenticator tokenIssuer
+	external      map[string]tokenIssuer
+}
+
+// parse parses the token with the issuer of its iss claim, tokens of other issuers are rejected by the checks of the
+// authenticator. The claims of external issuers are mapped to those of the authenticator.
+func (i tokenIssuers) parse(token string) (*TokenClaims, error) {
+	issuer := i.authenticator
+	var unverified TokenClaims
+	_, _, err := jwt.NewParser().ParseUnverified(token, &unverified)
+	if err == nil {
+		if external, ok := i.external[unverified.Issuer]; ok {
+			issuer = external
+		}
+	}
+	claims, err := ParseJWTToken(token, issuer.keys, issuer.validation)
+	if err != nil || issuer.mapping == nil {
+		return claims, err
+	}
+	err = issuer.mapping.apply(claims)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// openIDConfiguration is the part of the discovery document of an OpenID Connect issuer its tokens are verified with
+type openIDConfiguration struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// discoverIssuer reads the discovery document of an OpenID Connect issuer. Its tokens must be for the audience, they
+// have the permissions the mapping grants to their scopes and role.
+func discoverIssuer(discoveryURL, audience string, clockSkew time.Duration, mapping claimsMapping) (string, tokenIssuer, error) {
+	client := &http.Client{Timeout: jwksRequestTimeout}
+	request, err := http.NewRequestWithContext(context.Background(), http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return "", tokenIssuer{}, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", tokenIssuer{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", tokenIssuer{}, fmt.Errorf("issuer returned status %d for its discovery document", response.StatusCode)
+	}
+	var configuration openIDConfiguration
+	err = json.NewDecoder(response.Body).Decode(&configuration)
+	if err != nil {
+		return "", tokenIssuer{}, err
+	}
+	if configuration.Issuer == "" || configuration.JWKSURI == "" {
+		return "", tokenIssuer{}, fmt.Errorf("discovery document of %s has no issuer or jwks_uri", discoveryURL)
+	}
+	keys := newJWKSCache(configuration.JWKSURI)
+	err = keys.refresh(context.Background())
+	if err != nil {
+		return "", tokenIssuer{}, fmt.Errorf("could not load the JWKS of %s: %v", configuration.Issuer, err)
+	}
+	mapping.issuer = configuration.Issuer
+	return configuration.Issuer, tokenIssuer{
+		validation: TokenValidation{Issuer: configuration.Issuer, Audience: audience, ClockSkew: clockSkew},
+		keys:       keys,
+		mapping:    &mapping,
+	}, nil
+}
+
+// newTokenIssuersFromEnv accepts the tokens of the authenticator and of the OpenID Connect issuer discovered at
+// OIDC_DISCOVERY_URL, for the audience OIDC_AUDIENCE or by default the one of the authenticator. The permissions of
+// the scopes and roles of the issuer are those of OIDC_SCOPE_MAP and its users belong to the tenant OIDC_TENANT.
+func newTokenIssuersFromEnv(validation TokenValidation, keys VerificationKeys) (tokenIssuers, error) {
+	issuers := tokenIssuers{authenticator: tokenIssuer{validation: validation, keys: keys}}
+	discoveryURL := os.Getenv("OIDC_DISCOVERY_URL")
+	if discoveryURL == "" {
+		return issuers, nil
+	}
+	audience := os.Getenv("OIDC_AUDIENCE")
+	if audience == "" {
+		audience = validation.Audience
+	}
+	scopeMap := os.Getenv("OIDC_SCOPE_MAP")
+	if scopeMap == "" {
+		return issuers, errors.New("OIDC_SCOPE_MAP is required with OIDC_DISCOVERY_URL")
+	}
+	permissions, err := parseClaimsMapping(scopeMap)
+	if err != nil {
+		return issuers, fmt.Errorf("invalid OIDC_SCOPE_MAP: %v", err)
+	}
+	mapping := claimsMapping{permissions: permissions, tenant: os.Getenv("OIDC_TENANT")}
+	name, issuer, err := discoverIssuer(discoveryURL, audience, validation.ClockSkew, mapping)
+	if err != nil {
+		return issuers, err
+	}
+	issuers.external = map[string]tokenIssuer{name: issuer}
+	return issuers, nil
+}
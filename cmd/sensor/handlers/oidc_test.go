@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// stubIssuer is an OpenID Connect issuer publishing an ES256 and an EdDSA key
+type stubIssuer struct {
+	server   *httptest.Server
+	ecKey    *ecdsa.PrivateKey
+	edKey    ed25519.PrivateKey
+	requests int
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	issuer := &stubIssuer{}
+	var err error
+	issuer.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, issuer.edKey, err = ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	encode := base64.RawURLEncoding.EncodeToString
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   issuer.server.URL,
+			"jwks_uri": issuer.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		issuer.requests++
+		_ = json.NewEncoder(w).Encode(map[string][]jsonWebKey{"keys": {
+			{Kty: "EC", Kid: "ec", Use: "sig", Crv: "P-256", X: encode(issuer.ecKey.X.FillBytes(make([]byte, 32))),
+				Y: encode(issuer.ecKey.Y.FillBytes(make([]byte, 32)))},
+			{Kty: "OKP", Kid: "ed", Crv: "Ed25519", X: encode(issuer.edKey.Public().(ed25519.PublicKey))},
+			// Keys of other uses are ignored
+			{Kty: "RSA", Kid: "enc", Use: "enc"},
+		}})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (s *stubIssuer) sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims TokenClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestExternalIssuer(t *testing.T) {
+	stub := newStubIssuer(t)
+	authenticator := TokenValidation{Issuer: defaultIssuer, Audience: defaultAudience, ClockSkew: defaultClockSkew}
+	mapping := claimsMapping{
+		permissions: map[string][]string{
+			"sensors.read": {PermissionSensorRead},
+			"ADMIN":        {PermissionSensorRead, PermissionSensorWrite},
+		},
+		tenant: "acme",
+	}
+	name, issuer, err := discoverIssuer(stub.server.URL+"/.well-known/openid-configuration", "sensors", time.Second, mapping)
+	require.NoError(t, err)
+	require.Equal(t, stub.server.URL, name)
+	issuers := tokenIssuers{
+		authenticator: tokenIssuer{validation: authenticator, keys: staticKey{}},
+		external:      map[string]tokenIssuer{name: issuer},
+	}
+	now := time.Now()
+	claims := TokenClaims{Role: "ADMIN", RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    stub.server.URL,
+		Subject:   "alice",
+		Audience:  jwt.ClaimStrings{"sensors"},
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}}
+
+	parsed, err := issuers.parse(stub.sign(t, jwt.SigningMethodES256, "ec", stub.ecKey, claims))
+	require.NoError(t, err)
+	require.Equal(t, stub.server.URL+"#alice", parsed.UserName)
+	require.Equal(t, "", parsed.Role)
+	require.Equal(t, "sensor:read sensor:write", parsed.Scope)
+	require.Equal(t, "acme", parsed.TenantScope())
+	_, err = issuers.parse(stub.sign(t, jwt.SigningMethodEdDSA, "ed", stub.edKey, claims))
+	require.NoError(t, err)
+
+	// A key of another type than the algorithm, another audience and unknown keys are rejected
+	_, err = issuers.parse(stub.sign(t, jwt.SigningMethodEdDSA, "ec", stub.edKey, claims))
+	require.Error(t, err)
+	other := claims
+	other.RegisteredClaims.Audience = jwt.ClaimStrings{"other"}
+	_, err = issuers.parse(stub.sign(t, jwt.SigningMethodES256, "ec", stub.ecKey, other))
+	require.Error(t, err)
+	requests := stub.requests
+	_, err = issuers.parse(stub.sign(t, jwt.SigningMethodES256, "unknown", stub.ecKey, claims))
+	require.ErrorIs(t, err, ErrUnknownKey)
+	// The JWKS was fetched too recently to be fetched again for the unknown key
+	require.Equal(t, requests, stub.requests)
+
+	// Tokens of other issuers are checked as tokens of the authenticator
+	other = claims
+	other.RegisteredClaims.Issuer = "https://unknown.example.com"
+	_, err = issuers.parse(stub.sign(t, jwt.SigningMethodES256, "ec", stub.ecKey, other))
+	require.Error(t, err)
+
+	// Only the mapped scopes grant permissions, the tenant and the username of the issuer are not trusted
+	other = claims
+	other.Role = ""
+	other.Scope = "sensors.read user:admin tenant:all"
+	other.Tenant = "globex"
+	other.UserName = "root"
+	other.Groups = []string{"admins"}
+	parsed, err = issuers.parse(stub.sign(t, jwt.SigningMethodES256, "ec", stub.ecKey, other))
+	require.NoError(t, err)
+	require.Equal(t, stub.server.URL+"#alice", parsed.UserName)
+	require.Equal(t, []string{PermissionSensorRead}, parsed.Permissions())
+	require.Equal(t, "acme", parsed.TenantScope())
+	require.Equal(t, []string{stub.server.URL + "#admins"}, parsed.Groups)
+	other.Scope = "user:admin"
+	_, err = issuers.parse(stub.sign(t, jwt.SigningMethodES256, "ec", stub.ecKey, other))
+	require.Error(t, err)
+	other.Scope = "sensors.read"
+	other.RegisteredClaims.Subject = ""
+	_, err = issuers.parse(stub.sign(t, jwt.SigningMethodES256, "ec", stub.ecKey, other))
+	require.Error(t, err)
+}
+
+func TestParseClaimsMapping(t *testing.T) {
+	mapping, err := parseClaimsMapping("sensors.read=sensor:read, admin = sensor:read sensor:write")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		"sensors.read": {PermissionSensorRead},
+		"admin":        {PermissionSensorRead, PermissionSensorWrite},
+	}, mapping)
+	for _, invalid := range []string{"", "sensors.read", "=sensor:read", "sensors.read=", "sensors.read=sensor:all"} {
+		_, err = parseClaimsMapping(invalid)
+		require.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+
+	"golang.org/x/exp/slices"
+)
+
+// Permissions granted by the scopes of the tokens
+const (
+	PermissionSensorRead   = "sensor:read"
+	PermissionSensorWrite  = "sensor:write"
+	PermissionSensorDelete = "sensor:delete"
+	PermissionUserAdmin    = "user:admin"
+	// PermissionSensorAdmin reads and changes every sensor of the tenant, whatever its owner and ACL
+	PermissionSensorAdmin = "sensor:admin"
+	// PermissionTenantAll lets a super-admin operate on the sensors of every tenant
+	PermissionTenantAll = "tenant:all"
+)
+
+// Permissions returns the permissions in the scope of the token. Legacy tokens of older authenticators, without a
+// scope nor a jti, have all the permissions with the ADMIN role and only sensor:read otherwise. Newer tokens always
+// have a scope, they have no permission without one.
+func (c TokenClaims) Permissions() []string {
+	if c.Scope != "" {
+		return strings.Fields(c.Scope)
+	}
+	if c.ID != "" {
+		return nil
+	}
+	if c.Role == "ADMIN" {
+		return []string{PermissionSensorRead, PermissionSensorWrite, PermissionSensorDelete, PermissionSensorAdmin, PermissionUserAdmin}
+	}
+	return []string{PermissionSensorRead}
+}
+
+// HasPermission tells whether the token grants the permission
+func (c TokenClaims) HasPermission(permission string) bool {
+	return slices.Contains(c.Permissions(), permission)
+}
+
+// TenantScope returns the tenant whose sensors the token can operate on, db.AllTenants with tenant:all
+func (c TokenClaims) TenantScope() string {
+	if c.HasPermission(PermissionTenantAll) {
+		return db.AllTenants
+	}
+	return c.Tenant
+}
+
+// Principal returns the user of the token the sensor store reads and writes for
+func (c TokenClaims) Principal() db.Principal {
+	return db.Principal{User: c.UserName, Groups: c.Groups, Admin: c.HasPermission(PermissionSensorAdmin)}
+}
+
+// authenticatedReads are the reads requiring a token even when reads are public, a single request of them fans out to
+// many queries
+var authenticatedReads = []string{"/nearest/batch"}
+
+// routePolicy is an endpoint with the permission required to call it
+type routePolicy struct {
+	method     string
+	path       string
+	handler    http.HandlerFunc
+	permission string
+}
+
+// routePolicies is the table of the endpoints of the service. Endpoints requiring sensor:read are public unless
+// REQUIRE_AUTH_FOR_READS is set, but for authenticatedReads, anonymous reads see the sensors of the default tenant.
+func (app *Application) routePolicies() []routePolicy {
+	return []routePolicy{
+		{http.MethodGet, "/nearest", app.findNearest, PermissionSensorRead},
+		{http.MethodGet, "/nearest/{lat}/{lon}", app.findNearest, PermissionSensorRead},
+		{http.MethodPost, "/nearest/batch", app.findNearestBatch, PermissionSensorRead},
+		{http.MethodGet, "/timezone/{lat}/{lon}", app.findTimeZone, PermissionSensorRead},
+		{http.MethodGet, "/", app.list, PermissionSensorRead},
+		{http.MethodGet, "/cells/counts", app.countByCell, PermissionSensorRead},
+		{http.MethodGet, "/tags", app.tags, PermissionSensorRead},
+		{http.MethodGet, "/clusters", app.clusters, PermissionSensorRead},
+		{http.MethodGet, "/tiles/{z:[0-9]+}/{x:[0-9]+}/{y:[0-9]+}.mvt", app.tile, PermissionSensorRead},
+		{http.MethodGet, "/covering/{lat}/{lon}", app.findCovering, PermissionSensorRead},
+		{http.MethodPost, "/covering", app.checkAreaCoverage, PermissionSensorRead},
+		{http.MethodPost, "/along", app.findAlong, PermissionSensorRead},
+		{http.MethodPost, "/analysis/coverage", app.analyzeCoverage, PermissionSensorRead},
+		{http.MethodPost, "/analysis/voronoi", app.catchments, PermissionSensorRead},
+		{http.MethodGet, "/cells/{cell}/sensors", app.findByCell, PermissionSensorRead},
+		{http.MethodGet, "/{id}/neighbours", app.findNeighbourCells, PermissionSensorRead},
+		{http.MethodGet, "/{id}/locations", app.locationHistory, PermissionSensorRead},
+		{http.MethodPost, "/{id}/moves", app.move, PermissionSensorWrite},
+		{http.MethodPut, "/{id}/owner", app.transferOwnership, PermissionSensorWrite},
+		{http.MethodPut, "/{id}/acl", app.setACL, PermissionSensorWrite},
+		{http.MethodGet, "/{id}", app.findByID, PermissionSensorRead},
+		{http.MethodPost, "/", app.insert, PermissionSensorWrite},
+		{http.MethodPost, "/sensor", app.insertWithLocationName, PermissionSensorWrite},
+		{http.MethodDelete, "/{id}", app.delete, PermissionSensorDelete},
+		{http.MethodPut, "/{id}", app.update, PermissionSensorWrite},
+		{http.MethodGet, "/by-name/{name}", app.findByName, PermissionSensorRead},
+		{http.MethodGet, "/nearest-by-name/{location}", app.findNearestByLocatioName, PermissionSensorRead},
+		{http.MethodPost, "/jobs/geocode", app.startGeocodeJob, PermissionSensorAdmin},
+		{http.MethodGet, "/jobs/geocode/{id}", app.findGeocodeJob, PermissionSensorAdmin},
+		{http.MethodGet, "/jobs/geocode/{id}/results", app.geocodeJobResults, PermissionSensorAdmin},
+		{http.MethodPost, "/jobs/geocode/{id}/cancel", app.cancelGeocodeJob, PermissionSensorAdmin},
+	}
+}
+
+// authorize wraps the handler of the route with the authentication its permission requires
+func (app *Application) authorize(policy routePolicy) http.HandlerFunc {
+	authenticated := app.requireAuthentication(policy.handler, policy.permission)
+	if policy.permission != PermissionSensorRead || app.authenticateReads || slices.Contains(authenticatedReads, policy.path) {
+		return authenticated
+	}
+	// Public reads are still authenticated when a token is sent, so that they see the sensors of its tenant
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hasToken(r) {
+			policy.handler(w, r)
+			return
+		}
+		authenticated(w, r)
+	}
+}
+
+// hasToken tells whether the request sends a token or an API key, in the Authorization header or the token query
+// parameter
+func hasToken(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.URL.Query().Get("token") != ""
+}
+
+// durationFromEnv reads a positive duration from an environment variable, defaultValue when not set
+func durationFromEnv(name string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return defaultValue, fmt.Errorf("%s must be a positive duration such as 1m", name)
+	}
+	return duration, nil
+}
+
+// boolFromEnv reads a boolean environment variable, false when not set
+func boolFromEnv(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", name)
+	}
+	return result, nil
+}
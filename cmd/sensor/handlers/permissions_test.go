@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissions(t *testing.T) {
+	require.Equal(t, []string{"sensor:read", "sensor:write"}, TokenClaims{Scope: "sensor:read sensor:write"}.Permissions())
+	// Legacy tokens without scopes nor jti get the permissions of their role
+	require.True(t, TokenClaims{Role: "ADMIN"}.HasPermission(PermissionSensorDelete))
+	require.False(t, TokenClaims{Role: "ADMIN", RegisteredClaims: jwt.RegisteredClaims{ID: "jti"}}.HasPermission(PermissionSensorRead))
+	require.True(t, TokenClaims{Role: "USER"}.HasPermission(PermissionSensorRead))
+	require.False(t, TokenClaims{Role: "USER"}.HasPermission(PermissionSensorWrite))
+	// The scope takes precedence over the role
+	require.False(t, TokenClaims{Role: "ADMIN", Scope: "sensor:read"}.HasPermission(PermissionSensorWrite))
+}
+
+func TestAuthorize(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	app := &Application{
+		errorLog: logger,
+		infoLog:  logger,
+		// The token is the scope of the test
+		ParseToken: func(token string) (*TokenClaims, error) {
+			if token == "invalid" {
+				return nil, errors.New("invalid")
+			}
+			return &TokenClaims{UserName: "test", Scope: token}, nil
+		},
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	status := func(handler http.HandlerFunc, token string) int {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			request.Header.Set("Authorization", "token "+token)
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		return recorder.Code
+	}
+
+	read := app.authorize(routePolicy{http.MethodGet, "/", ok, PermissionSensorRead})
+	require.Equal(t, http.StatusOK, status(read, ""))
+	write := app.authorize(routePolicy{http.MethodPost, "/", ok, PermissionSensorWrite})
+	require.Equal(t, http.StatusUnauthorized, status(write, ""))
+	require.Equal(t, http.StatusBadRequest, status(write, "invalid"))
+	require.Equal(t, http.StatusForbidden, status(write, "sensor:read"))
+	require.Equal(t, http.StatusOK, status(write, "sensor:read sensor:write"))
+	// A batch fans out to many queries, it is not public
+	batch := app.authorize(routePolicy{http.MethodPost, "/nearest/batch", ok, PermissionSensorRead})
+	require.Equal(t, http.StatusUnauthorized, status(batch, ""))
+	require.Equal(t, http.StatusOK, status(batch, "sensor:read"))
+
+	app.authenticateReads = true
+	read = app.authorize(routePolicy{http.MethodGet, "/", ok, PermissionSensorRead})
+	require.Equal(t, http.StatusUnauthorized, status(read, ""))
+	require.Equal(t, http.StatusForbidden, status(read, "sensor:write"))
+	require.Equal(t, http.StatusOK, status(read, "sensor:read"))
+
+	// Every route requires a permission of the service, the paid geocode jobs are for admins
+	for _, policy := range app.routePolicies() {
+		require.True(t, strings.HasPrefix(policy.permission, "sensor:"), policy.path)
+		if strings.HasPrefix(policy.path, "/jobs/") {
+			require.Equal(t, PermissionSensorAdmin, policy.permission, policy.path)
+		}
+	}
+}
+
+func TestTenantScope(t *testing.T) {
+	app := &Application{
+		// The token is the scope of the test
+		ParseToken: func(token string) (*TokenClaims, error) {
+			return &TokenClaims{UserName: "test", Tenant: "acme", Scope: token}, nil
+		},
+	}
+	var tenant string
+	handler := func(w http.ResponseWriter, r *http.Request) { tenant = db.TenantFromContext(r.Context()) }
+	read := app.authorize(routePolicy{http.MethodGet, "/", handler, PermissionSensorRead})
+	tenantOf := func(token string) string {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			request.Header.Set("Authorization", "token "+token)
+		}
+		read(httptest.NewRecorder(), request)
+		return tenant
+	}
+
+	// Anonymous reads see the default tenant, authenticated ones the tenant of the token
+	require.Equal(t, db.DefaultTenant, tenantOf(""))
+	require.Equal(t, "acme", tenantOf("sensor:read"))
+	require.Equal(t, db.AllTenants, tenantOf("sensor:read tenant:all"))
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRevocationRefresh = 30 * time.Second
+	revocationRequestTimeout = 5 * time.Second
+)
+
+// revocationList is a local copy of the tokens revoked in the authenticator, refreshed in background. It is read as the
+// OAuth2 client of the sensor service.
+type revocationList struct {
+	url          string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+	errorLog     *log.Logger
+
+	mu     sync.RWMutex
+	tokens map[string]bool
+	// users maps the users with revoked tokens to the time until which their tokens are revoked
+	users map[string]time.Time
+}
+
+// revocationListResponse is the revocation list returned by the authenticator
+type revocationListResponse struct {
+	Tokens []string `json:"tokens"`
+	Users  []struct {
+		Username  string    `json:"username"`
+		RevokedAt time.Time `json:"revokedAt"`
+	} `json:"users"`
+}
+
+func newRevocationList(authenticatorURL, clientID, clientSecret string, errorLog *log.Logger) *revocationList {
+	return &revocationList{
+		url:          strings.TrimSuffix(authenticatorURL, "/") + "/tokens/revoked",
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: revocationRequestTimeout},
+		errorLog:     errorLog,
+		tokens:       map[string]bool{},
+		users:        map[string]time.Time{},
+	}
+}
+
+// refresh replaces the local copy with the list of the authenticator
+func (l *revocationList) refresh(ctx context.Context) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, l.url, nil)
+	if err != nil {
+		return err
+	}
+	request.SetBasicAuth(url.QueryEscape(l.clientID), url.QueryEscape(l.clientSecret))
+	response, err := l.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("authenticator returned status %d for the revocation list", response.StatusCode)
+	}
+	var list revocationListResponse
+	err = json.NewDecoder(response.Body).Decode(&list)
+	if err != nil {
+		return err
+	}
+	tokens := make(map[string]bool, len(list.Tokens))
+	for _, jti := range list.Tokens {
+		tokens[jti] = true
+	}
+	users := make(map[string]time.Time, len(list.Users))
+	for _, user := range list.Users {
+		users[user.Username] = user.RevokedAt
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = tokens
+	l.users = users
+	return nil
+}
+
+// run refreshes the list every interval, keeping the last copy when the authenticator can't be reached
+func (l *revocationList) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := l.refresh(context.Background())
+		if err != nil {
+			l.errorLog.Printf("could not refresh the revocation list: %s", err.Error())
+		}
+	}
+}
+
+// isRevoked tells whether the token was revoked by its JTI or with all the tokens of its user. Issue times are in
+// seconds, so a token issued in the same second as the revocation of its user is revoked.
+func (l *revocationList) isRevoked(claims *TokenClaims) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if claims.ID != "" && l.tokens[claims.ID] {
+		return true
+	}
+	revokedAt, ok := l.users[claims.UserName]
+	return ok && (claims.IssuedAt == nil || !claims.IssuedAt.After(revokedAt))
+}
+
+// newRevocationListFromEnv starts refreshing the revocation list of the authenticator at AUTHENTICATOR_URL every
+// REVOCATION_REFRESH, read as the client OAUTH_CLIENT_ID and OAUTH_CLIENT_SECRET. It returns nil when no authenticator
+// is configured.
+func newRevocationListFromEnv(errorLog *log.Logger) (*revocationList, error) {
+	authenticatorURL := os.Getenv("AUTHENTICATOR_URL")
+	if authenticatorURL == "" {
+		return nil, nil
+	}
+	clientID := os.Getenv("OAUTH_CLIENT_ID")
+	clientSecret := os.Getenv("OAUTH_CLIENT_SECRET")
+	if clientID == "" || clientSecret == "" {
+		return nil, errors.New("OAUTH_CLIENT_ID and OAUTH_CLIENT_SECRET are required to read the revoked tokens")
+	}
+	interval := defaultRevocationRefresh
+	if value := os.Getenv("REVOCATION_REFRESH"); value != "" {
+		var err error
+		interval, err = time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return nil, errors.New("REVOCATION_REFRESH must be a positive duration such as 30s")
+		}
+	}
+	list := newRevocationList(authenticatorURL, clientID, clientSecret, errorLog)
+	// The service starts even when the authenticator is not reachable yet
+	err := list.refresh(context.Background())
+	if err != nil {
+		errorLog.Printf("could not load the revocation list: %s", err.Error())
+	}
+	go list.run(interval)
+	return list, nil
+}
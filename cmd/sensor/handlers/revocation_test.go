@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevocationList(t *testing.T) {
+	revokedAt := time.Now().Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/tokens/revoked", r.URL.Path)
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "sensor" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"tokens": []string{"revoked"},
+			"users":  []map[string]interface{}{{"username": "mallory", "revokedAt": revokedAt}},
+		}))
+	}))
+	t.Cleanup(server.Close)
+	logger := log.New(io.Discard, "", 0)
+
+	list := newRevocationList(server.URL+"/", "sensor", "s3cret", logger)
+	require.NoError(t, list.refresh(context.Background()))
+	require.True(t, list.isRevoked(&TokenClaims{RegisteredClaims: jwt.RegisteredClaims{ID: "revoked"}}))
+	require.False(t, list.isRevoked(&TokenClaims{RegisteredClaims: jwt.RegisteredClaims{ID: "active"}}))
+	require.True(t, list.isRevoked(&TokenClaims{UserName: "mallory", RegisteredClaims: jwt.RegisteredClaims{
+		IssuedAt: jwt.NewNumericDate(revokedAt),
+	}}))
+	require.False(t, list.isRevoked(&TokenClaims{UserName: "mallory", RegisteredClaims: jwt.RegisteredClaims{
+		IssuedAt: jwt.NewNumericDate(revokedAt.Add(time.Second)),
+	}}))
+
+	// The sensor service must be a registered client
+	require.Error(t, newRevocationList(server.URL, "sensor", "wrong", logger).refresh(context.Background()))
+	t.Setenv("AUTHENTICATOR_URL", server.URL)
+	_, err := newRevocationListFromEnv(logger)
+	require.Error(t, err)
+}
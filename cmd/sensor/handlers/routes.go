@@ -7,11 +7,11 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	jwt "github.com/golang-jwt/jwt/v4"
-	"github.com/mitchellh/mapstructure"
-	"golang.org/x/exp/slices"
 
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
 	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/service"
 	"github.com/gorilla/mux"
 )
@@ -20,8 +20,14 @@ type Application struct {
 	errorLog   *log.Logger
 	infoLog    *log.Logger
 	sensors    service.SensorMetadataService
-	jwtPubKey  []byte
-	ParseToken func(token string, pubKey []byte) (*TokenClaims, error)
+	jobs       service.GeocodeJobService
+	ParseToken func(token string) (*TokenClaims, error)
+	// ValidateAPIKey is nil when no authenticator is configured, then API keys are not accepted
+	ValidateAPIKey func(key string) (*TokenClaims, error)
+	// revocations is nil when no authenticator is configured, then tokens are only checked by their expiry
+	revocations *revocationList
+	// authenticateReads requires a token with sensor:read for the endpoints reading sensors
+	authenticateReads bool
 }
 
 func (app Application) ErrorLog() *log.Logger {
@@ -33,7 +39,13 @@ func (app Application) ErrorLog() *log.Logger {
 type TokenClaims struct {
 	UserName string `json:"username"`
 	Role     string `json:"role"`
-	jwt.StandardClaims
+	// Scope is the space separated list of the permissions of the token
+	Scope string `json:"scope,omitempty"`
+	// Tenant is the tenant of the user, the default tenant when empty
+	Tenant string `json:"tenant,omitempty"`
+	// Groups are the groups of the user, which the ACLs of the sensors grant access to
+	Groups []string `json:"groups,omitempty"`
+	jwt.RegisteredClaims
 }
 
 func NewApplication(uri, databaseName string) (*Application, error) {
@@ -45,75 +57,146 @@ func NewApplication(uri, databaseName string) (*Application, error) {
 	if err != nil {
 		return nil, err
 	}
+	jobs, err := service.NewGeocodeJobService(uri, databaseName, srv)
+	if err != nil {
+		return nil, err
+	}
+	validation, err := NewTokenValidationFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	revocations, err := newRevocationListFromEnv(errLog)
+	if err != nil {
+		return nil, err
+	}
+	validateAPIKey, err := newAPIKeyValidatorFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	issuers, err := newTokenIssuersFromEnv(validation, newVerificationKeysFromEnv(errLog))
+	if err != nil {
+		return nil, err
+	}
+	parseToken := issuers.parse
+	introspector, err := newTokenIntrospectorFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if introspector != nil {
+		// The authenticator tells whether the tokens are active instead of their signature
+		parseToken = introspector.parse
+	}
+	authenticateReads, err := boolFromEnv("REQUIRE_AUTH_FOR_READS")
+	if err != nil {
+		return nil, err
+	}
 	return &Application{
-		errorLog:   errLog,
-		infoLog:    infoLog,
-		sensors:    srv,
-		jwtPubKey:  []byte(os.Getenv("tls.crt")),
-		ParseToken: ParseJWTToken,
+		errorLog:          errLog,
+		infoLog:           infoLog,
+		sensors:           srv,
+		jobs:              jobs,
+		ParseToken:        parseToken,
+		ValidateAPIKey:    validateAPIKey,
+		revocations:       revocations,
+		authenticateReads: authenticateReads,
 	}, nil
 
 }
 
-func (app *Application) requireAuthentication(fn http.HandlerFunc, allowedRoles []string) http.HandlerFunc {
+// requireAuthentication calls the handler for valid tokens or API keys granting the permission
+func (app *Application) requireAuthentication(fn http.HandlerFunc, permission string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		var authToken string
-
-		if strings.HasPrefix(strings.ToLower(authHeader), "token ") {
-			authToken = authHeader[len("token "):]
-		} else {
-			query := r.URL.Query()
-			authToken = query.Get("token")
-		}
-
-		if authToken == "" {
-			app.jsonErrorReturn(w, errors.New("Token is required"), http.StatusUnauthorized)
+		claims, status, err := app.authenticate(r)
+		if err != nil {
+			app.jsonErrorReturn(w, err, status)
 			return
 		}
-		claims, err := app.ParseToken(authToken, app.jwtPubKey)
-		if err != nil {
-			app.jsonErrorReturn(w, errors.New("Token is invalid"), http.StatusBadRequest)
+		if app.revocations.isRevoked(claims) {
+			app.jsonErrorReturn(w, errors.New("Token was revoked"), http.StatusUnauthorized)
 			return
 		}
-		if len(allowedRoles) > 0 && !slices.Contains(allowedRoles, claims.Role) {
+		if !claims.HasPermission(permission) {
 			app.jsonErrorReturn(w, errors.New("This user can't perform this function"), http.StatusForbidden)
 			return
 		}
-		fn(w, r)
+		ctx := db.WithPrincipal(db.WithTenant(r.Context(), claims.TenantScope()), claims.Principal())
+		fn(w, r.WithContext(ctx))
 	}
 }
 
-func ParseJWTToken(token string, pubKey []byte) (*TokenClaims, error) {
-	jwtToken, err := jwt.Parse(token, func(tk *jwt.Token) (interface{}, error) {
-		a, err := jwt.ParseRSAPublicKeyFromPEM(pubKey)
-		return a, err
+// authenticate returns the claims of the API key in the Authorization header, or else of the token in the header, as
+// a token or a bearer token, or in the token query parameter, along with the status to reply when they are missing or
+// invalid
+func (app *Application) authenticate(r *http.Request) (*TokenClaims, int, error) {
+	authHeader := r.Header.Get("Authorization")
+	if strings.HasPrefix(strings.ToLower(authHeader), "apikey ") {
+		if app.ValidateAPIKey == nil {
+			return nil, http.StatusUnauthorized, errors.New("API keys are not supported")
+		}
+		claims, err := app.ValidateAPIKey(authHeader[len("apikey "):])
+		if errors.Is(err, ErrInvalidAPIKey) {
+			return nil, http.StatusUnauthorized, ErrInvalidAPIKey
+		}
+		if err != nil {
+			app.errorLog.Printf("could not validate an API key: %s", err.Error())
+			return nil, http.StatusServiceUnavailable, errors.New("API key could not be validated")
+		}
+		return claims, 0, nil
+	}
+
+	var authToken string
+	if strings.HasPrefix(strings.ToLower(authHeader), "token ") {
+		authToken = authHeader[len("token "):]
+	} else if strings.HasPrefix(strings.ToLower(authHeader), "bearer ") {
+		// The tokens of the OAuth2 token endpoint are bearer tokens
+		authToken = authHeader[len("bearer "):]
+	} else {
+		query := r.URL.Query()
+		authToken = query.Get("token")
+	}
+
+	if authToken == "" {
+		return nil, http.StatusUnauthorized, errors.New("Token is required")
+	}
+	claims, err := app.ParseToken(authToken)
+	if errors.Is(err, errAuthenticatorUnavailable) {
+		app.errorLog.Printf("could not introspect a token: %s", err.Error())
+		return nil, http.StatusServiceUnavailable, errors.New("Token could not be validated")
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("Token is invalid")
+	}
+	return claims, 0, nil
+}
+
+// ParseJWTToken parses a token signed with the key of its kid and checks its expiry, issuer and audience
+func ParseJWTToken(token string, keys VerificationKeys, validation TokenValidation) (*TokenClaims, error) {
+	var tokenClaims TokenClaims
+	// The claims are validated below with the clock skew
+	parser := jwt.NewParser(jwt.WithValidMethods(signingAlgorithms), jwt.WithoutClaimsValidation())
+	_, err := parser.ParseWithClaims(token, &tokenClaims, func(tk *jwt.Token) (interface{}, error) {
+		kid, _ := tk.Header["kid"].(string)
+		return keys.VerificationKey(kid)
 	})
 	if err != nil {
 		return nil, err
 	}
-	if jwtToken.Valid {
-		var tokenClaims *TokenClaims
-		err = mapstructure.Decode(jwtToken.Claims, &tokenClaims)
-		if err != nil {
-			return nil, fmt.Errorf("could not parse token claims: %v", err)
-		}
-		return tokenClaims, nil
+	err = validation.Validate(tokenClaims, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("could not validate token claims: %v", err)
+	}
+	// Tokens of external issuers identify the user by its subject
+	if tokenClaims.UserName == "" {
+		tokenClaims.UserName = tokenClaims.Subject
 	}
-	return nil, errors.New("token has expired")
+	return &tokenClaims, nil
 }
 
 func (app *Application) Routes() *mux.Router {
 	// Register handler functions.
 	r := mux.NewRouter()
-	r.HandleFunc("/nearest/{lat}/{lon}", app.findNearest).Methods(http.MethodGet)
-	r.HandleFunc("/{id}", app.findByID).Methods(http.MethodGet)
-	r.HandleFunc("/", app.requireAuthentication(app.insert, []string{"ADMIN"})).Methods(http.MethodPost)
-	r.HandleFunc("/sensor", app.insertWithLocationName).Methods(http.MethodPost)
-	r.HandleFunc("/{id}", app.requireAuthentication(app.delete, []string{"ADMIN"})).Methods(http.MethodDelete)
-	r.HandleFunc("/{id}", app.requireAuthentication(app.update, []string{"ADMIN"})).Methods(http.MethodPut)
-	r.HandleFunc("/by-name/{name}", app.findByName).Methods(http.MethodGet)
-	r.HandleFunc("/nearest-by-name/{location}", app.findNearestByLocatioName).Methods(http.MethodGet)
-
+	for _, policy := range app.routePolicies() {
+		r.HandleFunc(policy.path, app.authorize(policy)).Methods(policy.method)
+	}
 	return r
 }
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrForbidden is returned when the user of the context is not allowed to change the sensor
+var ErrForbidden = errors.New("you are not allowed to change this sensor")
+
+// ACLEntry represents the DTO granting a user or a group read or write access to a sensor
+type ACLEntry struct {
+	User   string `json:"user,omitempty"`
+	Group  string `json:"group,omitempty"`
+	Access string `json:"access"`
+}
+
+// OwnerTransfer represents the DTO transferring a sensor to a new owner
+type OwnerTransfer struct {
+	Owner string `json:"owner"`
+}
+
+func (e ACLEntry) toDatabase() (db.ACLEntry, error) {
+	if (e.User == "") == (e.Group == "") {
+		return db.ACLEntry{}, errors.New("an ACL entry needs either a user or a group")
+	}
+	if e.Access != db.AccessRead && e.Access != db.AccessWrite {
+		return db.ACLEntry{}, fmt.Errorf("access must be %q or %q", db.AccessRead, db.AccessWrite)
+	}
+	return db.ACLEntry{User: e.User, Group: e.Group, Access: e.Access}, nil
+}
+
+func fromDatabaseToACL(acl []db.ACLEntry) []ACLEntry {
+	if len(acl) == 0 {
+		return nil
+	}
+	dtos := make([]ACLEntry, 0, len(acl))
+	for _, entry := range acl {
+		dtos = append(dtos, ACLEntry{User: entry.User, Group: entry.Group, Access: entry.Access})
+	}
+	return dtos
+}
+
+// findWritable returns the sensor when the principal of the context can change it, ErrForbidden when it can only read it
+func (s sensorMetadataService) findWritable(ctx context.Context, id primitive.ObjectID) (*db.Sensor, error) {
+	sensor, err := s.sensorStore.FindByID(ctx, id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !sensor.CanWrite(db.PrincipalFromContext(ctx)) {
+		return nil, ErrForbidden
+	}
+	return sensor, nil
+}
+
+// findOwned returns the sensor when the principal of the context owns it, ErrForbidden otherwise
+func (s sensorMetadataService) findOwned(ctx context.Context, id string) (*db.Sensor, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	sensor, err := s.sensorStore.FindByID(ctx, oid)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !sensor.IsOwnedBy(db.PrincipalFromContext(ctx)) {
+		return nil, ErrForbidden
+	}
+	return sensor, nil
+}
+
+// TransferOwnership gives the sensor to a new owner, only its owner can
+func (s sensorMetadataService) TransferOwnership(ctx context.Context, id string, transfer OwnerTransfer) error {
+	owner := strings.TrimSpace(transfer.Owner)
+	if owner == "" {
+		return errors.New("owner is required")
+	}
+	sensor, err := s.findOwned(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = s.sensorStore.SetOwner(ctx, sensor.ID, owner)
+	if err != nil {
+		return err
+	}
+	s.clusters.invalidate()
+	return nil
+}
+
+// SetACL replaces the ACL of the sensor, only its owner can
+func (s sensorMetadataService) SetACL(ctx context.Context, id string, acl []ACLEntry) error {
+	entries := make([]db.ACLEntry, 0, len(acl))
+	for _, entry := range acl {
+		dbEntry, err := entry.toDatabase()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, dbEntry)
+	}
+	sensor, err := s.findOwned(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = s.sensorStore.SetACL(ctx, sensor.ID, entries)
+	if err != nil {
+		return err
+	}
+	s.clusters.invalidate()
+	return nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	dbMock "github.com/ViniciusMiana/sensor-metadata/mocks/sensor/db"
+)
+
+func TestOwnership(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	service := sensorMetadataService{
+		sensorStore: mockSensor,
+		clusters:    newClusterCache(),
+	}
+	owner := db.WithPrincipal(context.Background(), db.Principal{User: "alice"})
+	writer := db.WithPrincipal(context.Background(), db.Principal{User: "bob"})
+	other := db.WithPrincipal(context.Background(), db.Principal{User: "dave"})
+	sensor := db.Sensor{
+		ID:    primitive.NewObjectID(),
+		Name:  "Sensor 1",
+		Owner: "alice",
+		ACL:   []db.ACLEntry{{User: "bob", Access: db.AccessWrite}},
+	}
+	id := sensor.ID.Hex()
+	for _, ctx := range []context.Context{owner, writer, other} {
+		mockSensor.On("FindByID", ctx, sensor.ID).Return(&sensor, nil)
+	}
+	mockSensor.On("SetACL", owner, sensor.ID, []db.ACLEntry{{Group: "team-a", Access: db.AccessRead}}).Return(nil).Once()
+	mockSensor.On("SetOwner", owner, sensor.ID, "bob").Return(nil).Once()
+	mockSensor.On("Delete", writer, sensor.ID).Return(nil).Once()
+	defer mockSensor.AssertExpectations(t)
+
+	// Only the owner edits the ACL and transfers the sensor
+	require.ErrorIs(t, service.SetACL(writer, id, []ACLEntry{{Group: "team-a", Access: "read"}}), ErrForbidden)
+	require.Error(t, service.SetACL(owner, id, []ACLEntry{{User: "bob", Group: "team-a", Access: "read"}}))
+	require.Error(t, service.SetACL(owner, id, []ACLEntry{{User: "bob", Access: "admin"}}))
+	require.NoError(t, service.SetACL(owner, id, []ACLEntry{{Group: "team-a", Access: "read"}}))
+	require.ErrorIs(t, service.TransferOwnership(writer, id, OwnerTransfer{Owner: "bob"}), ErrForbidden)
+	require.Error(t, service.TransferOwnership(owner, id, OwnerTransfer{}))
+	require.NoError(t, service.TransferOwnership(owner, id, OwnerTransfer{Owner: "bob"}))
+
+	// The writers of the ACL change the sensor, the others can't
+	require.ErrorIs(t, service.Delete(other, id), ErrForbidden)
+	require.ErrorIs(t, service.Update(other, SensorMetadata{ID: id, Name: "Sensor 2"}), ErrForbidden)
+	require.NoError(t, service.Delete(writer, id))
+}
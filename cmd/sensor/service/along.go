@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxAlongSensors = 10000
+	maxLinePoints   = 10000
+	// alongSearchBoxes is the maximum number of boxes the line is split in to find candidate sensors
+	alongSearchBoxes = 32
+)
+
+// GeoJSONLineString represents a GeoJSON LineString geometry
+type GeoJSONLineString struct {
+	Type        string      `json:"type"`
+	Coordinates [][]float64 `json:"coordinates"`
+}
+
+func (l GeoJSONLineString) validate() error {
+	if l.Type != "LineString" {
+		return errors.New("line must be a GeoJSON LineString")
+	}
+	if len(l.Coordinates) < 2 || len(l.Coordinates) > maxLinePoints {
+		return fmt.Errorf("line must have between 2 and %d positions", maxLinePoints)
+	}
+	for _, position := range l.Coordinates {
+		if len(position) < 2 || math.Abs(position[0]) > 180 || math.Abs(position[1]) > 90 {
+			return errors.New("line positions must be [lon, lat]")
+		}
+	}
+	return nil
+}
+
+// AlongRequest represents a search of the sensors near a route
+type AlongRequest struct {
+	LevelFilter
+	Line GeoJSONLineString `json:"line"`
+	// Buffer is the maximum distance in meters between the sensors and the line
+	Buffer float64  `json:"buffer"`
+	Tags   []string `json:"tags"`
+}
+
+// AlongSensor represents a sensor near a route
+type AlongSensor struct {
+	SensorMetadata
+	// Along is the distance in meters from the start of the line to the point of the line closest to the sensor
+	Along float64 `json:"along"`
+	// Offset is the distance in meters from the line, positive on its left and negative on its right
+	Offset float64 `json:"offset"`
+}
+
+// FindAlong returns the sensors within the buffer of the line ordered by their position along it
+func (s sensorMetadataService) FindAlong(ctx context.Context, request AlongRequest) ([]AlongSensor, error) {
+	err := request.Line.validate()
+	if err != nil {
+		return nil, err
+	}
+	if request.Buffer <= 0 {
+		return nil, errors.New("buffer must be positive")
+	}
+	filter, err := request.LevelFilter.toDatabase(db.SensorFilter{Tags: request.Tags})
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := s.findLineCandidates(ctx, request.Line.Coordinates, request.Buffer, filter)
+	if err != nil {
+		return nil, err
+	}
+	sensors := []AlongSensor{}
+	for i := range candidates {
+		along, offset := geo.LocateOnLine(request.Line.Coordinates, candidates[i].Location.Lat, candidates[i].Location.Lon)
+		if math.Abs(offset) > request.Buffer {
+			continue
+		}
+		sensors = append(sensors, AlongSensor{
+			SensorMetadata: *FromDatabaseToSensorMetadata(candidates[i]),
+			Along:          along,
+			Offset:         offset,
+		})
+	}
+	sort.SliceStable(sensors, func(i, j int) bool {
+		return sensors[i].Along < sensors[j].Along
+	})
+	return sensors, nil
+}
+
+// findLineCandidates returns the sensors inside the boxes of consecutive parts of the line grown by the buffer
+func (s sensorMetadataService) findLineCandidates(ctx context.Context, line [][]float64, buffer float64, filter db.SensorFilter) ([]db.Sensor, error) {
+	segments := len(line) - 1
+	perBox := (segments + alongSearchBoxes - 1) / alongSearchBoxes
+	seen := map[primitive.ObjectID]bool{}
+	var candidates []db.Sensor
+	for start := 0; start < segments; start += perBox {
+		end := start + perBox
+		if end > segments {
+			end = segments
+		}
+		box := geo.EmptyBBox()
+		for _, position := range line[start : end+1] {
+			box.Extend(position[0], position[1])
+		}
+		sensors, err := s.sensorStore.FindInBBox(ctx, filter, growBBox(box, buffer), maxAlongSensors+1)
+		if err != nil {
+			return nil, err
+		}
+		for i := range sensors {
+			if seen[sensors[i].ID] {
+				continue
+			}
+			seen[sensors[i].ID] = true
+			candidates = append(candidates, sensors[i])
+		}
+		if len(candidates) > maxAlongSensors {
+			return nil, fmt.Errorf("the route has more than %d sensors nearby", maxAlongSensors)
+		}
+	}
+	return candidates, nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	dbMock "github.com/ViniciusMiana/sensor-metadata/mocks/sensor/db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFindAlong(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := context.Background()
+	service := sensorMetadataService{sensorStore: mockSensor}
+	// The line goes east along the equator, about 111 meters per thousandth of a degree
+	line := GeoJSONLineString{Type: "LineString", Coordinates: [][]float64{{0, 0}, {0.01, 0}, {0.02, 0}}}
+	end := db.Sensor{ID: primitive.NewObjectID(), Name: "End", Location: &db.Location{Lat: -0.0005, Lon: 0.019}}
+	start := db.Sensor{ID: primitive.NewObjectID(), Name: "Start", Location: &db.Location{Lat: 0.0005, Lon: 0.001}}
+	far := db.Sensor{ID: primitive.NewObjectID(), Name: "Far", Location: &db.Location{Lat: 0.002, Lon: 0.01}}
+	mockSensor.On("FindInBBox", ctx, db.SensorFilter{Tags: []string{"pipeline"}}, mock.Anything, int64(maxAlongSensors+1)).Return([]db.Sensor{end, far}, nil).Once()
+	mockSensor.On("FindInBBox", ctx, db.SensorFilter{Tags: []string{"pipeline"}}, mock.Anything, int64(maxAlongSensors+1)).Return([]db.Sensor{start, end}, nil).Once()
+	defer mockSensor.AssertExpectations(t)
+
+	sensors, err := service.FindAlong(ctx, AlongRequest{Line: line, Buffer: 100, Tags: []string{"pipeline"}})
+	require.NoError(t, err)
+	require.Len(t, sensors, 2)
+	require.Equal(t, "Start", sensors[0].Name)
+	require.InDelta(t, 111, sensors[0].Along, 1)
+	require.InDelta(t, 55.6, sensors[0].Offset, 1)
+	require.Equal(t, "End", sensors[1].Name)
+	require.InDelta(t, 2113, sensors[1].Along, 1)
+	require.InDelta(t, -55.6, sensors[1].Offset, 1)
+
+	_, err = service.FindAlong(ctx, AlongRequest{Line: line})
+	require.Error(t, err)
+	_, err = service.FindAlong(ctx, AlongRequest{Line: GeoJSONLineString{Type: "LineString", Coordinates: [][]float64{{0, 0}}}, Buffer: 100})
+	require.Error(t, err)
+}
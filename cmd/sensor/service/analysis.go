@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+)
+
+const (
+	maxAnalysisCells   = 250000
+	maxAnalysisSensors = 50000
+	maxVoronoiSensors  = 2000
+)
+
+// GeoJSONPolygon represents a GeoJSON Polygon geometry, the first ring is the outer boundary and the others are holes
+type GeoJSONPolygon struct {
+	Type        string        `json:"type"`
+	Coordinates [][][]float64 `json:"coordinates"`
+}
+
+func (p GeoJSONPolygon) validate() error {
+	if p.Type != "Polygon" {
+		return errors.New("area must be a GeoJSON Polygon")
+	}
+	if len(p.Coordinates) == 0 {
+		return errors.New("area must have an outer ring")
+	}
+	for _, ring := range p.Coordinates {
+		if len(ring) < 4 {
+			return errors.New("area rings must have at least 4 positions")
+		}
+		for _, position := range ring {
+			if len(position) < 2 || math.Abs(position[0]) > 180 || math.Abs(position[1]) > 90 {
+				return errors.New("area positions must be [lon, lat]")
+			}
+		}
+		// The analysis drops the closing position of the outer ring
+		first, last := ring[0], ring[len(ring)-1]
+		if first[0] != last[0] || first[1] != last[1] {
+			return errors.New("area rings must be closed, with the first and last positions equal")
+		}
+	}
+	return nil
+}
+
+// AnalysisRequest represents the parameters of a coverage or Voronoi analysis
+type AnalysisRequest struct {
+	Area GeoJSONPolygon `json:"area"`
+	// Spacing is the target distance between sensors in meters
+	Spacing float64  `json:"spacing"`
+	Tags    []string `json:"tags"`
+}
+
+// GridCell represents a cell of the analysis grid by its center
+type GridCell struct {
+	Lat   float64 `json:"lat"`
+	Lon   float64 `json:"lon"`
+	Count int     `json:"count,omitempty"`
+}
+
+// CoverageAnalysis represents the DTO with the density of sensors in an area and the gaps in its coverage
+type CoverageAnalysis struct {
+	// CellWidth and CellHeight are the size of the grid cells in degrees, no longer than the spacing
+	CellWidth  float64 `json:"cellWidth"`
+	CellHeight float64 `json:"cellHeight"`
+	Cells      int     `json:"cells"`
+	Sensors    int     `json:"sensors"`
+	// Density lists the cells with sensors and how many
+	Density []GridCell `json:"density"`
+	// Gaps lists the cells whose center is farther than the spacing from any sensor
+	Gaps            []GridCell `json:"gaps"`
+	CoveredFraction float64    `json:"coveredFraction"`
+}
+
+// Catchment represents the part of the area closer to a sensor than to any other
+type Catchment struct {
+	SensorID string         `json:"sensorId"`
+	Name     string         `json:"name"`
+	Area     GeoJSONPolygon `json:"area"`
+}
+
+// analysisGrid splits the bounding box of the area in cells no larger than the spacing
+type analysisGrid struct {
+	box        geo.BBox
+	cellWidth  float64
+	cellHeight float64
+	columns    int
+	rows       int
+}
+
+func newAnalysisGrid(box geo.BBox, spacing float64) (*analysisGrid, error) {
+	// The width is computed at the latitude farthest from the equator, where degrees of longitude are the shortest
+	maxLat := math.Min(math.Max(math.Abs(box.MinLat), math.Abs(box.MaxLat)), 89)
+	grid := &analysisGrid{
+		box:        box,
+		cellHeight: spacing / geo.MetersPerDegreeLat,
+		cellWidth:  spacing / (geo.MetersPerDegreeLat * math.Cos(maxLat*math.Pi/180)),
+	}
+	grid.columns = int(math.Ceil((box.MaxLon - box.MinLon) / grid.cellWidth))
+	grid.rows = int(math.Ceil((box.MaxLat - box.MinLat) / grid.cellHeight))
+	if grid.columns*grid.rows > maxAnalysisCells {
+		return nil, fmt.Errorf("spacing is too small for the area, it would need more than %d cells", maxAnalysisCells)
+	}
+	return grid, nil
+}
+
+func (g analysisGrid) cell(lat, lon float64) (column, row int) {
+	return int(math.Floor((lon - g.box.MinLon) / g.cellWidth)), int(math.Floor((lat - g.box.MinLat) / g.cellHeight))
+}
+
+func (g analysisGrid) center(column, row int) (lat, lon float64) {
+	return g.box.MinLat + (float64(row)+0.5)*g.cellHeight, g.box.MinLon + (float64(column)+0.5)*g.cellWidth
+}
+
+// findAreaSensors returns the sensors inside the box grown by the margin in meters
+func (s sensorMetadataService) findAreaSensors(ctx context.Context, box geo.BBox, tags []string, margin float64, limit int64) ([]db.Sensor, error) {
+	sensors, err := s.sensorStore.FindInBBox(ctx, db.SensorFilter{Tags: tags}, growBBox(box, margin), limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(sensors)) > limit {
+		return nil, fmt.Errorf("the area has more than %d sensors", limit)
+	}
+	return sensors, nil
+}
+
+// growBBox returns the box grown by the margin in meters on every side
+func growBBox(box geo.BBox, margin float64) geo.BBox {
+	latMargin := margin / geo.MetersPerDegreeLat
+	maxLat := math.Min(math.Max(math.Abs(box.MinLat), math.Abs(box.MaxLat))+latMargin, 89)
+	lonMargin := margin / (geo.MetersPerDegreeLat * math.Cos(maxLat*math.Pi/180))
+	return geo.BBox{
+		MinLon: math.Max(box.MinLon-lonMargin, -180),
+		MinLat: math.Max(box.MinLat-latMargin, -90),
+		MaxLon: math.Min(box.MaxLon+lonMargin, 180),
+		MaxLat: math.Min(box.MaxLat+latMargin, 90),
+	}
+}
+
+func (s sensorMetadataService) AnalyzeCoverage(ctx context.Context, request AnalysisRequest) (*CoverageAnalysis, error) {
+	if request.Spacing <= 0 {
+		return nil, errors.New("spacing must be positive")
+	}
+	err := request.Area.validate()
+	if err != nil {
+		return nil, err
+	}
+	grid, err := newAnalysisGrid(geo.PolygonBBox(request.Area.Coordinates), request.Spacing)
+	if err != nil {
+		return nil, err
+	}
+	// Sensors outside the area but closer than the spacing also cover it
+	sensors, err := s.findAreaSensors(ctx, grid.box, request.Tags, request.Spacing, maxAnalysisSensors)
+	if err != nil {
+		return nil, err
+	}
+	analysis := &CoverageAnalysis{
+		CellWidth:  grid.cellWidth,
+		CellHeight: grid.cellHeight,
+		Density:    []GridCell{},
+		Gaps:       []GridCell{},
+	}
+	// Sensors are bucketed in the grid cells, as cells are no larger than the spacing
+	// a sensor covering a cell center is in the same cell or in one of its neighbours
+	buckets := map[[2]int][]db.Sensor{}
+	for i := range sensors {
+		column, row := grid.cell(sensors[i].Location.Lat, sensors[i].Location.Lon)
+		buckets[[2]int{column, row}] = append(buckets[[2]int{column, row}], sensors[i])
+	}
+	for row := 0; row < grid.rows; row++ {
+		for column := 0; column < grid.columns; column++ {
+			lat, lon := grid.center(column, row)
+			if !geo.PolygonContains(request.Area.Coordinates, lon, lat) {
+				continue
+			}
+			analysis.Cells++
+			if count := len(buckets[[2]int{column, row}]); count > 0 {
+				analysis.Sensors += count
+				analysis.Density = append(analysis.Density, GridCell{Lat: lat, Lon: lon, Count: count})
+			}
+			if !covered(buckets, column, row, lat, lon, request.Spacing) {
+				analysis.Gaps = append(analysis.Gaps, GridCell{Lat: lat, Lon: lon})
+			}
+		}
+	}
+	if analysis.Cells > 0 {
+		analysis.CoveredFraction = 1 - float64(len(analysis.Gaps))/float64(analysis.Cells)
+	}
+	return analysis, nil
+}
+
+func covered(buckets map[[2]int][]db.Sensor, column, row int, lat, lon, spacing float64) bool {
+	for dc := -1; dc <= 1; dc++ {
+		for dr := -1; dr <= 1; dr++ {
+			for _, sensor := range buckets[[2]int{column + dc, row + dr}] {
+				if geo.Distance(lat, lon, sensor.Location.Lat, sensor.Location.Lon) <= spacing {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (s sensorMetadataService) Catchments(ctx context.Context, request AnalysisRequest) ([]Catchment, error) {
+	err := request.Area.validate()
+	if err != nil {
+		return nil, err
+	}
+	box := geo.PolygonBBox(request.Area.Coordinates)
+	// Sensors outside the area may still own part of it, the spacing bounds how far they are looked for
+	sensors, err := s.findAreaSensors(ctx, box, request.Tags, math.Max(request.Spacing, 0), maxVoronoiSensors)
+	if err != nil {
+		return nil, err
+	}
+	// Cells are computed in an equirectangular projection centered in the area, which keeps the
+	// bisectors between nearby sensors close to the ones on the sphere
+	scale := math.Cos((box.MinLat + box.MaxLat) / 2 * math.Pi / 180)
+	project := func(lat, lon float64) geo.Point {
+		return geo.Point{X: lon * scale, Y: lat}
+	}
+	outer := request.Area.Coordinates[0]
+	area := make([]geo.Point, 0, len(outer))
+	for _, position := range outer[:len(outer)-1] {
+		area = append(area, project(position[1], position[0]))
+	}
+	sites := make([]geo.Point, 0, len(sensors))
+	for i := range sensors {
+		sites = append(sites, project(sensors[i].Location.Lat, sensors[i].Location.Lon))
+	}
+	catchments := []Catchment{}
+	for i, cell := range geo.VoronoiCells(sites, area) {
+		if len(cell) < 3 {
+			continue
+		}
+		ring := make([][]float64, 0, len(cell)+1)
+		for _, p := range cell {
+			ring = append(ring, []float64{p.X / scale, p.Y})
+		}
+		ring = append(ring, ring[0])
+		catchments = append(catchments, Catchment{
+			SensorID: sensors[i].ID.Hex(),
+			Name:     sensors[i].Name,
+			Area:     GeoJSONPolygon{Type: "Polygon", Coordinates: [][][]float64{ring}},
+		})
+	}
+	return catchments, nil
+}
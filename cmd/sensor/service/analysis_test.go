@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	dbMock "github.com/ViniciusMiana/sensor-metadata/mocks/sensor/db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var analysisArea = GeoJSONPolygon{
+	Type:        "Polygon",
+	Coordinates: [][][]float64{{{0, 0}, {0.1, 0}, {0.1, 0.1}, {0, 0.1}, {0, 0}}},
+}
+
+func TestAnalyzeCoverage(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := context.Background()
+	service := sensorMetadataService{sensorStore: mockSensor}
+	mockSensor.On("FindInBBox", ctx, db.SensorFilter{Tags: []string{"Tag1"}}, mock.Anything, int64(maxAnalysisSensors+1)).Return([]db.Sensor{
+		{ID: primitive.NewObjectID(), Name: "Sensor A", Location: &db.Location{Lat: 0.02, Lon: 0.02}},
+		{ID: primitive.NewObjectID(), Name: "Sensor B", Location: &db.Location{Lat: 0.021, Lon: 0.021}},
+	}, nil).Once()
+	defer mockSensor.AssertExpectations(t)
+
+	analysis, err := service.AnalyzeCoverage(ctx, AnalysisRequest{Area: analysisArea, Spacing: 2000, Tags: []string{"Tag1"}})
+	require.NoError(t, err)
+	require.Equal(t, 2, analysis.Sensors)
+	require.Len(t, analysis.Density, 1)
+	require.Equal(t, 2, analysis.Density[0].Count)
+	require.NotEmpty(t, analysis.Gaps)
+	require.Greater(t, analysis.CoveredFraction, 0.0)
+	require.Less(t, analysis.CoveredFraction, 0.2)
+	require.Equal(t, analysis.Cells-len(analysis.Gaps), int(analysis.CoveredFraction*float64(analysis.Cells)+0.5))
+
+	_, err = service.AnalyzeCoverage(ctx, AnalysisRequest{Area: analysisArea, Spacing: 1})
+	require.Error(t, err)
+	_, err = service.AnalyzeCoverage(ctx, AnalysisRequest{Area: GeoJSONPolygon{Type: "Point"}, Spacing: 1000})
+	require.Error(t, err)
+}
+
+func TestAreaValidation(t *testing.T) {
+	require.NoError(t, analysisArea.validate())
+	for _, coordinates := range [][][][]float64{
+		{},
+		{{{0, 0}, {0.1, 0}, {0.1, 0.1}, {0, 0.1}}},
+		{{{0, 0}, {0.1, 0}, {0, 0.1}, {200, 0}}},
+		{analysisArea.Coordinates[0], {}},
+		{analysisArea.Coordinates[0], {{0.01, 0.01}, {0.02, 0.01}, {0.01, 0.01}}},
+	} {
+		require.Error(t, GeoJSONPolygon{Type: "Polygon", Coordinates: coordinates}.validate(), coordinates)
+	}
+}
+
+func TestCatchments(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := context.Background()
+	service := sensorMetadataService{sensorStore: mockSensor}
+	west := db.Sensor{ID: primitive.NewObjectID(), Name: "West", Location: &db.Location{Lat: 0.05, Lon: 0.025}}
+	east := db.Sensor{ID: primitive.NewObjectID(), Name: "East", Location: &db.Location{Lat: 0.05, Lon: 0.075}}
+	mockSensor.On("FindInBBox", ctx, db.SensorFilter{}, mock.Anything, int64(maxVoronoiSensors+1)).Return([]db.Sensor{west, east}, nil).Once()
+	defer mockSensor.AssertExpectations(t)
+
+	catchments, err := service.Catchments(ctx, AnalysisRequest{Area: analysisArea})
+	require.NoError(t, err)
+	require.Len(t, catchments, 2)
+	for i, sensor := range []db.Sensor{west, east} {
+		require.Equal(t, sensor.ID.Hex(), catchments[i].SensorID)
+		ring := catchments[i].Area.Coordinates[0]
+		require.Equal(t, ring[0], ring[len(ring)-1])
+		for _, position := range ring {
+			if sensor.Name == "West" {
+				require.LessOrEqual(t, position[0], 0.05+1e-9)
+			} else {
+				require.GreaterOrEqual(t, position[0], 0.05-1e-9)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CellCount represents the DTO with the number of sensors in a geohash cell
+type CellCount struct {
+	Cell  string `json:"cell"`
+	Count int64  `json:"count"`
+}
+
+// SensorCells represents the DTO with the geohash cell of a sensor and its neighbour cells
+type SensorCells struct {
+	ID         string            `json:"id"`
+	Cell       string            `json:"cell"`
+	Neighbours map[string]string `json:"neighbours"`
+}
+
+func validatePrecision(precision int) error {
+	if precision < 1 || precision > geo.MaxGeohashPrecision {
+		return fmt.Errorf("precision must be between 1 and %d", geo.MaxGeohashPrecision)
+	}
+	return nil
+}
+
+func (s sensorMetadataService) FindByCell(ctx context.Context, cell string, limit int64) ([]SensorMetadata, error) {
+	err := geo.ValidateGeohash(cell)
+	if err != nil {
+		return nil, err
+	}
+	sensorsMongo, err := s.sensorStore.FindByCell(ctx, cell, limit)
+	if err != nil {
+		return nil, err
+	}
+	sensors := make([]SensorMetadata, 0, len(sensorsMongo))
+	for i := range sensorsMongo {
+		sensors = append(sensors, *FromDatabaseToSensorMetadata(sensorsMongo[i]))
+	}
+	return sensors, nil
+}
+
+func (s sensorMetadataService) CountByCell(ctx context.Context, within string, precision int) ([]CellCount, error) {
+	err := validatePrecision(precision)
+	if err != nil {
+		return nil, err
+	}
+	if within != "" {
+		err = geo.ValidateGeohash(within)
+		if err != nil {
+			return nil, err
+		}
+		if len(within) > precision {
+			return nil, errors.New("precision can't be lower than the precision of the within cell")
+		}
+	}
+	counts, err := s.sensorStore.CountByCell(ctx, within, precision)
+	if err != nil {
+		return nil, err
+	}
+	dtos := make([]CellCount, 0, len(counts))
+	for _, count := range counts {
+		dtos = append(dtos, CellCount{Cell: count.Cell, Count: count.Count})
+	}
+	return dtos, nil
+}
+
+func (s sensorMetadataService) FindNeighbourCells(ctx context.Context, id string, precision int) (*SensorCells, error) {
+	err := validatePrecision(precision)
+	if err != nil {
+		return nil, err
+	}
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	sensorMongo, err := s.sensorStore.FindByID(ctx, oid)
+	if err != nil {
+		return nil, err
+	}
+	return sensorCells(*sensorMongo, precision)
+}
+
+func sensorCells(sensor db.Sensor, precision int) (*SensorCells, error) {
+	if sensor.Location == nil {
+		return nil, errors.New("sensor has no location")
+	}
+	cell := geo.EncodeGeohash(sensor.Location.Lat, sensor.Location.Lon, precision)
+	return &SensorCells{
+		ID:         sensor.ID.Hex(),
+		Cell:       cell,
+		Neighbours: geo.GeohashNeighbours(cell),
+	}, nil
+}
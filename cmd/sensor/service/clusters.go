@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+)
+
+const (
+	// MaxClusterZoom is the highest zoom with clusters, above it sensors are returned individually
+	MaxClusterZoom = 16
+	// MaxZoom is the highest zoom level accepted
+	MaxZoom = 22
+
+	maxClusterSensors = 1000
+	clusterCacheTTL   = time.Minute
+	clusterCacheSize  = 1000
+)
+
+// ClusterQuery represents the parameters of a cluster request
+type ClusterQuery struct {
+	LevelFilter
+	// BBox is the visible area as minLon,minLat,maxLon,maxLat
+	BBox string
+	Zoom int
+	Tags []string
+}
+
+// Cluster represents the DTO of a group of sensors
+type Cluster struct {
+	Cell     string   `json:"cell"`
+	Count    int64    `json:"count"`
+	Centroid Location `json:"centroid"`
+	// BBox is the box of the sensors in the cluster as [minLon, minLat, maxLon, maxLat]
+	BBox [4]float64 `json:"bbox"`
+}
+
+// Clusters represents the DTO with the clusters and individual sensors of an area.
+// Cells with a single sensor are returned as sensors.
+type Clusters struct {
+	Zoom      int              `json:"zoom"`
+	Precision int              `json:"precision,omitempty"`
+	Clusters  []Cluster        `json:"clusters"`
+	Sensors   []SensorMetadata `json:"sensors"`
+}
+
+// clusterPrecision returns the geohash precision whose cells are a few times smaller than a map tile at the zoom
+func clusterPrecision(zoom int) int {
+	// A geohash with p characters has 5p/2 bits per axis, a tile at zoom z has z bits
+	precision := int(math.Round(float64(zoom+3) * 2 / 5))
+	if precision < 1 {
+		return 1
+	}
+	if precision > geo.MaxGeohashPrecision {
+		return geo.MaxGeohashPrecision
+	}
+	return precision
+}
+
+// readerKey identifies the sensors the principal of the context can read, the ACLs restrict them
+func readerKey(ctx context.Context) string {
+	principal := db.PrincipalFromContext(ctx)
+	switch {
+	case principal == nil:
+		return ""
+	case principal.Admin:
+		return "*"
+	}
+	return principal.User + "/" + strings.Join(principal.Groups, ",")
+}
+
+func (s sensorMetadataService) Clusters(ctx context.Context, query ClusterQuery) (*Clusters, error) {
+	box, err := geo.ParseBBox(query.BBox)
+	if err != nil {
+		return nil, err
+	}
+	if query.Zoom < 0 || query.Zoom > MaxZoom {
+		return nil, fmt.Errorf("zoom must be between 0 and %d", MaxZoom)
+	}
+	tags := append([]string(nil), query.Tags...)
+	sort.Strings(tags)
+	filter, err := query.LevelFilter.toDatabase(db.SensorFilter{Tags: tags})
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s|%s|%v|%d|%s|%s", db.TenantFromContext(ctx), readerKey(ctx), box, query.Zoom, strings.Join(tags, ","), query.LevelFilter.cacheKey())
+	result, version := s.clusters.get(key)
+	if result != nil {
+		return result, nil
+	}
+	result = &Clusters{
+		Zoom:     query.Zoom,
+		Clusters: []Cluster{},
+		Sensors:  []SensorMetadata{},
+	}
+	if query.Zoom > MaxClusterZoom {
+		sensors, err := s.sensorStore.FindInBBox(ctx, filter, box, maxClusterSensors)
+		if err != nil {
+			return nil, err
+		}
+		for i := range sensors {
+			result.Sensors = append(result.Sensors, *FromDatabaseToSensorMetadata(sensors[i]))
+		}
+	} else {
+		result.Precision = clusterPrecision(query.Zoom)
+		clusters, err := s.sensorStore.ClusterByCell(ctx, filter, box, result.Precision)
+		if err != nil {
+			return nil, err
+		}
+		for i := range clusters {
+			if clusters[i].Count == 1 {
+				result.Sensors = append(result.Sensors, *FromDatabaseToSensorMetadata(clusters[i].Sensor))
+				continue
+			}
+			result.Clusters = append(result.Clusters, fromDatabaseToCluster(clusters[i]))
+		}
+	}
+	s.clusters.put(key, version, result)
+	return result, nil
+}
+
+func fromDatabaseToCluster(cluster db.Cluster) Cluster {
+	return Cluster{
+		Cell:  cluster.Cell,
+		Count: cluster.Count,
+		Centroid: Location{
+			Lat: fmt.Sprintf("%f", cluster.Lat),
+			Lon: fmt.Sprintf("%f", cluster.Lon),
+		},
+		BBox: [4]float64{cluster.MinLon, cluster.MinLat, cluster.MaxLon, cluster.MaxLat},
+	}
+}
+
+type clusterCacheEntry struct {
+	version  uint64
+	expires  time.Time
+	clusters *Clusters
+}
+
+// clusterCache keeps recent cluster results until a sensor is written by this instance.
+// Writes made by other replicas are only seen when the entries expire. A nil cache caches nothing.
+type clusterCache struct {
+	mu      sync.Mutex
+	version uint64
+	entries map[string]clusterCacheEntry
+}
+
+func newClusterCache() *clusterCache {
+	return &clusterCache{entries: map[string]clusterCacheEntry{}}
+}
+
+// get returns the cached result, if any, and the version to store a new result with
+func (c *clusterCache) get(key string) (*Clusters, uint64) {
+	if c == nil {
+		return nil, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if ok && entry.version == c.version && time.Now().Before(entry.expires) {
+		return entry.clusters, c.version
+	}
+	return nil, c.version
+}
+
+// put stores a result computed from the data of the version, unless sensors were written since
+func (c *clusterCache) put(key string, version uint64, clusters *Clusters) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if version != c.version {
+		return
+	}
+	if len(c.entries) >= clusterCacheSize {
+		c.entries = map[string]clusterCacheEntry{}
+	}
+	c.entries[key] = clusterCacheEntry{version: version, expires: time.Now().Add(clusterCacheTTL), clusters: clusters}
+}
+
+// invalidate drops all cached results, it must be called after every sensor write
+func (c *clusterCache) invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	c.entries = map[string]clusterCacheEntry{}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+	dbMock "github.com/ViniciusMiana/sensor-metadata/mocks/sensor/db"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestClusterPrecision(t *testing.T) {
+	require.Equal(t, 1, clusterPrecision(0))
+	require.Equal(t, 5, clusterPrecision(10))
+	require.Equal(t, 8, clusterPrecision(MaxClusterZoom))
+	require.Equal(t, 10, clusterPrecision(MaxZoom))
+}
+
+func TestClusters(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := db.WithPrincipal(context.Background(), db.Principal{User: "editor"})
+	single := db.Sensor{ID: primitive.NewObjectID(), Name: "Sensor London", Location: &db.Location{Lat: 51.5, Lon: -0.1}}
+	service := sensorMetadataService{
+		sensorStore: mockSensor,
+		clusters:    newClusterCache(),
+	}
+	box := geo.BBox{MinLon: -10, MinLat: 40, MaxLon: 10, MaxLat: 55}
+	filter := db.SensorFilter{Tags: []string{"Tag1", "Tag2"}}
+	mockSensor.On("ClusterByCell", ctx, filter, box, 3).Return([]db.Cluster{
+		{Cell: "gcp", Count: 1, Lat: 51.5, Lon: -0.1, Sensor: single},
+		{Cell: "u09", Count: 2, Lat: 48.8, Lon: 2.2, MinLat: 48.7, MinLon: 2.1, MaxLat: 48.9, MaxLon: 2.3},
+	}, nil).Twice()
+	mockSensor.On("FindByID", ctx, single.ID).Return(&single, nil).Once()
+	mockSensor.On("Delete", ctx, single.ID).Return(nil).Once()
+	defer mockSensor.AssertExpectations(t)
+
+	query := ClusterQuery{BBox: "-10,40,10,55", Zoom: 5, Tags: []string{"Tag2", "Tag1"}}
+	result, err := service.Clusters(ctx, query)
+	require.NoError(t, err)
+	require.Equal(t, 3, result.Precision)
+	require.Equal(t, []Cluster{{
+		Cell:     "u09",
+		Count:    2,
+		Centroid: Location{Lat: "48.800000", Lon: "2.200000"},
+		BBox:     [4]float64{2.1, 48.7, 2.3, 48.9},
+	}}, result.Clusters)
+	require.Len(t, result.Sensors, 1)
+	require.Equal(t, "Sensor London", result.Sensors[0].Name)
+
+	// The second request is cached, until a sensor is deleted
+	query.Tags = []string{"Tag1", "Tag2"}
+	cached, err := service.Clusters(ctx, query)
+	require.NoError(t, err)
+	require.Same(t, result, cached)
+	require.NoError(t, service.Delete(ctx, single.ID.Hex()))
+	_, err = service.Clusters(ctx, query)
+	require.NoError(t, err)
+
+	_, err = service.Clusters(ctx, ClusterQuery{BBox: "-10,40,10,55", Zoom: 30})
+	require.EqualError(t, err, "zoom must be between 0 and 22")
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+)
+
+// Coordinate formats of a location, decimal degrees in lat and lon being the default
+const (
+	FormatDecimal = "decimal"
+	// FormatDMS has degrees, minutes and seconds in lat and lon, e.g. 48°51'30.24"N and 2°17'40.20"E
+	FormatDMS = "dms"
+	// FormatUTM has zone and band, easting and northing in coordinates, e.g. 31U 448252 5411954
+	FormatUTM = "utm"
+	// FormatMGRS has a Military Grid Reference System position in coordinates, e.g. 31U DQ 48252 11954
+	FormatMGRS = "mgrs"
+	// FormatPlusCode has a full Open Location Code in coordinates, e.g. 8FW4V75V+8Q
+	FormatPlusCode = "pluscode"
+)
+
+// parseCoordinates returns the latitude and longitude of the location in decimal degrees according to its format
+func parseCoordinates(loc *Location) (float64, float64, error) {
+	switch loc.Format {
+	case "", FormatDecimal:
+		lat, err := strconv.ParseFloat(loc.Lat, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		lon, err := strconv.ParseFloat(loc.Lon, 64)
+		return lat, lon, err
+	case FormatDMS:
+		lat, err := geo.ParseDMS(loc.Lat, true)
+		if err != nil {
+			return 0, 0, err
+		}
+		lon, err := geo.ParseDMS(loc.Lon, false)
+		return lat, lon, err
+	case FormatUTM:
+		u, err := geo.ParseUTM(loc.Coordinates)
+		if err != nil {
+			return 0, 0, err
+		}
+		lat, lon := u.LatLon()
+		return lat, lon, nil
+	case FormatMGRS:
+		u, err := geo.ParseMGRS(loc.Coordinates)
+		if err != nil {
+			return 0, 0, err
+		}
+		lat, lon := u.LatLon()
+		return lat, lon, nil
+	case FormatPlusCode:
+		return geo.DecodePlusCode(loc.Coordinates)
+	}
+	return 0, 0, validateFormat(loc.Format)
+}
+
+// FormatLocation returns a copy of the location with its coordinates in the format. Decimal lat and lon are replaced
+// by dms, the other formats keep them and add the coordinates.
+func FormatLocation(loc *Location, format string) (*Location, error) {
+	if loc == nil {
+		return nil, validateFormat(format)
+	}
+	lat, lon, err := parseCoordinates(loc)
+	if err != nil {
+		return nil, err
+	}
+	formatted := *loc
+	formatted.Format = format
+	formatted.Lat = fmt.Sprintf("%f", lat)
+	formatted.Lon = fmt.Sprintf("%f", lon)
+	formatted.Coordinates = ""
+	switch format {
+	case "", FormatDecimal:
+		formatted.Format = ""
+	case FormatDMS:
+		formatted.Lat = geo.FormatDMS(lat, true)
+		formatted.Lon = geo.FormatDMS(lon, false)
+	case FormatUTM:
+		u, err := geo.ToUTM(lat, lon)
+		if err != nil {
+			return nil, err
+		}
+		formatted.Coordinates = u.String()
+	case FormatMGRS:
+		formatted.Coordinates, err = geo.FormatMGRS(lat, lon)
+		if err != nil {
+			return nil, err
+		}
+	case FormatPlusCode:
+		formatted.Coordinates = geo.EncodePlusCode(lat, lon)
+	default:
+		return nil, validateFormat(format)
+	}
+	return &formatted, nil
+}
+
+func validateFormat(format string) error {
+	switch format {
+	case "", FormatDecimal, FormatDMS, FormatUTM, FormatMGRS, FormatPlusCode:
+		return nil
+	}
+	return fmt.Errorf("unknown location format %q, it must be decimal, dms, utm, mgrs or pluscode", format)
+}
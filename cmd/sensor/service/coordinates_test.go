@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	dbMock "github.com/ViniciusMiana/sensor-metadata/mocks/sensor/db"
+)
+
+func TestParseCoordinates(t *testing.T) {
+	for _, loc := range []Location{
+		{Lat: "48.8584", Lon: "2.2945"},
+		{Lat: "48.8584", Lon: "2.2945", Format: FormatDecimal},
+		{Lat: `48°51'30.24"N`, Lon: `2°17'40.20"E`, Format: FormatDMS},
+		{Format: FormatUTM, Coordinates: "31U 448252 5411954"},
+		{Format: FormatMGRS, Coordinates: "31U DQ 48252 11954"},
+		{Format: FormatPlusCode, Coordinates: "8FW4V75V+9Q"},
+	} {
+		lat, lon, err := parseCoordinates(&loc)
+		require.NoError(t, err, loc.Format)
+		require.InDelta(t, 48.8584, lat, 0.0001, loc.Format)
+		require.InDelta(t, 2.2945, lon, 0.0001, loc.Format)
+	}
+	for _, loc := range []Location{
+		{Lat: "48.8584", Lon: "2.2945", Format: "geohash"},
+		{Lat: "48.8584", Format: FormatDMS},
+		{Lat: "48.8584", Lon: "2.2945", Format: FormatUTM},
+		{Format: FormatMGRS, Coordinates: "31U DQ 123"},
+		{Format: FormatPlusCode, Coordinates: "V75V+9R"},
+	} {
+		_, _, err := parseCoordinates(&loc)
+		require.Error(t, err, loc.Format)
+	}
+}
+
+func TestFormatLocation(t *testing.T) {
+	floor := 2
+	loc := &Location{Lat: "48.858400", Lon: "2.294500", Floor: &floor}
+	formatted, err := FormatLocation(loc, FormatDMS)
+	require.NoError(t, err)
+	require.Equal(t, &Location{Lat: `48°51'30.24"N`, Lon: `2°17'40.20"E`, Format: FormatDMS, Floor: &floor}, formatted)
+	formatted, err = FormatLocation(loc, FormatMGRS)
+	require.NoError(t, err)
+	require.Equal(t, &Location{Lat: "48.858400", Lon: "2.294500", Format: FormatMGRS, Coordinates: "31U DQ 48252 11954", Floor: &floor}, formatted)
+	formatted, err = FormatLocation(loc, FormatUTM)
+	require.NoError(t, err)
+	require.Equal(t, "31U 448252 5411954", formatted.Coordinates)
+	formatted, err = FormatLocation(loc, FormatPlusCode)
+	require.NoError(t, err)
+	require.Equal(t, "8FW4V75V+9Q", formatted.Coordinates)
+	formatted, err = FormatLocation(formatted, FormatDecimal)
+	require.NoError(t, err)
+	require.Equal(t, "", formatted.Format)
+	lat, lon, err := parseCoordinates(formatted)
+	require.NoError(t, err)
+	require.InDelta(t, 48.8584, lat, 0.0001)
+	require.InDelta(t, 2.2945, lon, 0.0001)
+	formatted, err = FormatLocation(nil, FormatUTM)
+	require.NoError(t, err)
+	require.Nil(t, formatted)
+	_, err = FormatLocation(loc, "geohash")
+	require.Error(t, err)
+	_, err = FormatLocation(&Location{Lat: "85", Lon: "0"}, FormatUTM)
+	require.Error(t, err)
+}
+
+func TestFindNearestFormat(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := context.Background()
+	service := sensorMetadataService{
+		sensorStore: mockSensor,
+	}
+	sensor := db.Sensor{Name: "Sensor 1", Location: &db.Location{Lat: 48.8583, Lon: 2.2944}}
+	nearEiffelTower := mock.MatchedBy(func(loc db.Location) bool {
+		return loc.Lat > 48.858 && loc.Lat < 48.859 && loc.Lon > 2.294 && loc.Lon < 2.295
+	})
+	mockSensor.On("FindNearest", ctx, nearEiffelTower, db.SensorFilter{}, 0.0).Return(&sensor, nil).Twice()
+	defer mockSensor.AssertExpectations(t)
+	result, err := service.FindNearest(ctx, Location{Format: FormatMGRS, Coordinates: "31UDQ4825211954"}, NearestFilter{})
+	require.NoError(t, err)
+	require.Equal(t, "Sensor 1", result.Name)
+	_, err = service.FindNearest(ctx, Location{Lat: "N48 51 30", Lon: "E2 17 40", Format: FormatDMS}, NearestFilter{})
+	require.NoError(t, err)
+	_, err = service.FindNearest(ctx, Location{Format: FormatPlusCode, Coordinates: "9G8F+6X"}, NearestFilter{})
+	require.Error(t, err)
+}
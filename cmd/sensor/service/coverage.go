@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+)
+
+const (
+	// areaCoverageSamples is the number of rows and columns of the grid sampling an area to check its coverage
+	areaCoverageSamples = 100
+	maxCoveringSensors  = 10000
+)
+
+// Coverage represents the area where a sensor is effective, either a radius around its location or a polygon
+type Coverage struct {
+	// Radius is in meters
+	Radius  float64         `json:"radius,omitempty"`
+	Polygon *GeoJSONPolygon `json:"polygon,omitempty"`
+}
+
+func (c Coverage) toDatabase(location *db.Location) (*db.Coverage, error) {
+	switch {
+	case c.Radius < 0:
+		return nil, errors.New("coverage radius must be positive")
+	case c.Radius > 0 && c.Polygon != nil:
+		return nil, errors.New("coverage must have either a radius or a polygon")
+	case c.Radius > 0 && location == nil:
+		return nil, errors.New("coverage radius requires a location")
+	case c.Radius > 0:
+		return &db.Coverage{Radius: c.Radius}, nil
+	case c.Polygon != nil:
+		err := c.Polygon.validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid coverage polygon: %v", err)
+		}
+		return &db.Coverage{Polygon: c.Polygon.Coordinates}, nil
+	}
+	return nil, nil
+}
+
+func fromDatabaseToCoverage(coverage *db.Coverage) *Coverage {
+	switch {
+	case coverage == nil:
+		return nil
+	case len(coverage.Polygon) > 0:
+		return &Coverage{Polygon: &GeoJSONPolygon{Type: "Polygon", Coordinates: coverage.Polygon}}
+	}
+	return &Coverage{Radius: coverage.Radius}
+}
+
+// CoveringSensor represents a sensor covering a location
+type CoveringSensor struct {
+	SensorMetadata
+	// Distance is the distance in meters between the geometry of the sensor and the location, or -1 when it has none
+	Distance float64 `json:"distance"`
+}
+
+// AreaCoverage represents the DTO with the coverage of an area, estimated on a grid of 100 x 100 samples
+type AreaCoverage struct {
+	FullyCovered      bool    `json:"fullyCovered"`
+	UncoveredFraction float64 `json:"uncoveredFraction"`
+	// Sensors lists the ids of the sensors covering part of the area
+	Sensors []string `json:"sensors"`
+}
+
+func (s sensorMetadataService) FindCovering(ctx context.Context, lat, lon string) ([]CoveringSensor, error) {
+	loc, err := parseLocation(&Location{Lat: lat, Lon: lon})
+	if err != nil {
+		return nil, err
+	}
+	sensorsMongo, err := s.sensorStore.FindCovering(ctx, *loc)
+	if err != nil {
+		return nil, err
+	}
+	sensors := make([]CoveringSensor, 0, len(sensorsMongo))
+	for i := range sensorsMongo {
+		// The stored area of a radius is slightly larger than its circle
+		if !sensorsMongo[i].Contains(loc.Lat, loc.Lon) {
+			continue
+		}
+		sensors = append(sensors, CoveringSensor{
+			SensorMetadata: *FromDatabaseToSensorMetadata(sensorsMongo[i]),
+			Distance:       sensorsMongo[i].DistanceTo(loc.Lat, loc.Lon),
+		})
+	}
+	sort.SliceStable(sensors, func(i, j int) bool {
+		if (sensors[i].Distance < 0) != (sensors[j].Distance < 0) {
+			return sensors[j].Distance < 0
+		}
+		return sensors[i].Distance < sensors[j].Distance
+	})
+	return sensors, nil
+}
+
+func (s sensorMetadataService) CheckAreaCoverage(ctx context.Context, area GeoJSONPolygon) (*AreaCoverage, error) {
+	err := area.validate()
+	if err != nil {
+		return nil, err
+	}
+	sensorsMongo, err := s.sensorStore.FindCoveringArea(ctx, area.Coordinates, maxCoveringSensors+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(sensorsMongo) > maxCoveringSensors {
+		return nil, fmt.Errorf("the area is covered by more than %d sensors", maxCoveringSensors)
+	}
+	coverage := &AreaCoverage{Sensors: make([]string, 0, len(sensorsMongo))}
+	for i := range sensorsMongo {
+		coverage.Sensors = append(coverage.Sensors, sensorsMongo[i].ID.Hex())
+	}
+	box := geo.PolygonBBox(area.Coordinates)
+	width := (box.MaxLon - box.MinLon) / areaCoverageSamples
+	height := (box.MaxLat - box.MinLat) / areaCoverageSamples
+	samples, uncovered := 0, 0
+	for row := 0; row < areaCoverageSamples; row++ {
+		for column := 0; column < areaCoverageSamples; column++ {
+			lat := box.MinLat + (float64(row)+0.5)*height
+			lon := box.MinLon + (float64(column)+0.5)*width
+			if !geo.PolygonContains(area.Coordinates, lon, lat) {
+				continue
+			}
+			samples++
+			if !anyContains(sensorsMongo, lat, lon) {
+				uncovered++
+			}
+		}
+	}
+	if samples > 0 {
+		coverage.UncoveredFraction = float64(uncovered) / float64(samples)
+	}
+	coverage.FullyCovered = uncovered == 0
+	return coverage, nil
+}
+
+func anyContains(sensors []db.Sensor, lat, lon float64) bool {
+	for i := range sensors {
+		if sensors[i].Contains(lat, lon) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	dbMock "github.com/ViniciusMiana/sensor-metadata/mocks/sensor/db"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCoverageToDatabase(t *testing.T) {
+	location := &Location{Lat: "48.8566", Lon: "2.3522"}
+	sensor := SensorMetadata{Name: "Radio", Location: location, Coverage: &Coverage{Radius: 500}}
+	mObj, err := sensor.ToDatabase()
+	require.NoError(t, err)
+	require.Equal(t, &db.Coverage{Radius: 500}, mObj.Coverage)
+	require.Equal(t, sensor.Coverage, FromDatabaseToSensorMetadata(*mObj).Coverage)
+
+	sensor.Coverage = &Coverage{Polygon: &analysisArea}
+	mObj, err = sensor.ToDatabase()
+	require.NoError(t, err)
+	require.Equal(t, analysisArea.Coordinates, mObj.Coverage.Polygon)
+	require.Equal(t, sensor.Coverage, FromDatabaseToSensorMetadata(*mObj).Coverage)
+
+	for _, coverage := range []*Coverage{
+		{Radius: -1},
+		{Radius: 500, Polygon: &analysisArea},
+		{Polygon: &GeoJSONPolygon{Type: "Polygon"}},
+	} {
+		sensor.Coverage = coverage
+		_, err = sensor.ToDatabase()
+		require.Error(t, err)
+	}
+	_, err = SensorMetadata{Name: "Radio", Coverage: &Coverage{Radius: 500}}.ToDatabase()
+	require.Error(t, err)
+}
+
+func TestFindCovering(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := context.Background()
+	service := sensorMetadataService{sensorStore: mockSensor}
+	far := db.Sensor{ID: primitive.NewObjectID(), Name: "Far", Location: &db.Location{Lat: 0.03, Lon: 0.03}, Coverage: &db.Coverage{Radius: 10000}}
+	near := db.Sensor{ID: primitive.NewObjectID(), Name: "Near", Location: &db.Location{Lat: 0.051, Lon: 0.05}, Coverage: &db.Coverage{Radius: 1000}}
+	// The point is inside the polygon approximating the radius, but outside the circle
+	edge := db.Sensor{ID: primitive.NewObjectID(), Name: "Edge", Location: &db.Location{Lat: 0.05, Lon: 0.058998}, Coverage: &db.Coverage{Radius: 1000}}
+	area := db.Sensor{ID: primitive.NewObjectID(), Name: "Area", Coverage: &db.Coverage{Polygon: analysisArea.Coordinates}}
+	mockSensor.On("FindCovering", ctx, db.Location{Lat: 0.05, Lon: 0.05}).Return([]db.Sensor{area, far, edge, near}, nil).Once()
+	defer mockSensor.AssertExpectations(t)
+
+	sensors, err := service.FindCovering(ctx, "0.05", "0.05")
+	require.NoError(t, err)
+	require.Len(t, sensors, 3)
+	require.Equal(t, "Near", sensors[0].Name)
+	require.InDelta(t, 111, sensors[0].Distance, 1)
+	require.Equal(t, "Far", sensors[1].Name)
+	require.Equal(t, "Area", sensors[2].Name)
+	require.Equal(t, -1.0, sensors[2].Distance)
+}
+
+func TestCheckAreaCoverage(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := context.Background()
+	service := sensorMetadataService{sensorStore: mockSensor}
+	west := db.Sensor{ID: primitive.NewObjectID(), Name: "West", Coverage: &db.Coverage{
+		Polygon: [][][]float64{{{-1, -1}, {0.05, -1}, {0.05, 1}, {-1, 1}, {-1, -1}}},
+	}}
+	east := db.Sensor{ID: primitive.NewObjectID(), Name: "East", Coverage: &db.Coverage{
+		Polygon: [][][]float64{{{0.05, -1}, {1, -1}, {1, 1}, {0.05, 1}, {0.05, -1}}},
+	}}
+	mockSensor.On("FindCoveringArea", ctx, analysisArea.Coordinates, int64(maxCoveringSensors+1)).Return([]db.Sensor{west}, nil).Once()
+	mockSensor.On("FindCoveringArea", ctx, analysisArea.Coordinates, int64(maxCoveringSensors+1)).Return([]db.Sensor{west, east}, nil).Once()
+	defer mockSensor.AssertExpectations(t)
+
+	coverage, err := service.CheckAreaCoverage(ctx, analysisArea)
+	require.NoError(t, err)
+	require.False(t, coverage.FullyCovered)
+	require.InDelta(t, 0.5, coverage.UncoveredFraction, 0.01)
+	require.Equal(t, []string{west.ID.Hex()}, coverage.Sensors)
+
+	coverage, err = service.CheckAreaCoverage(ctx, analysisArea)
+	require.NoError(t, err)
+	require.True(t, coverage.FullyCovered)
+	require.Equal(t, 0.0, coverage.UncoveredFraction)
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/exp/slices"
+)
+
+// Failure policies of an enricher
+const (
+	// PolicyBlock rejects the write when the enricher fails
+	PolicyBlock = "block"
+	// PolicySkip stores the sensor without the field of the enricher
+	PolicySkip = "skip"
+	// PolicyRetry stores the sensor without the field and retries the enricher in background
+	PolicyRetry = "retry"
+
+	defaultEnricherTimeout = time.Second
+	retryEnrichmentPeriod  = time.Minute
+	retryEnrichmentBatch   = 100
+)
+
+// removedEnrichers are the enrichers of previous versions, ignored when configured, with the reason they were removed
+var removedEnrichers = map[string]string{
+	"geohash": "the geohash of the location is stored in cell",
+}
+
+// Enricher computes a derived field of a sensor
+type Enricher interface {
+	// Name is the name of the derived field
+	Name() string
+	// Enrich returns the value of the derived field, nil values are not stored
+	Enrich(ctx context.Context, sensor db.Sensor) (interface{}, error)
+}
+
+// EnricherConfig configures an enricher enabled in this deployment
+type EnricherConfig struct {
+	Name    string
+	Timeout time.Duration
+	Policy  string
+}
+
+// ParseEnricherConfig parses a comma separated list of name[:timeout[:policy]] entries,
+// e.g. "region:2s:retry,zone:100ms:block"
+func ParseEnricherConfig(config string) ([]EnricherConfig, error) {
+	var configs []EnricherConfig
+	for _, entry := range strings.Split(config, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ":")
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("invalid enricher configuration %q", entry)
+		}
+		cfg := EnricherConfig{
+			Name:    fields[0],
+			Timeout: defaultEnricherTimeout,
+			Policy:  PolicySkip,
+		}
+		if len(fields) > 1 && fields[1] != "" {
+			timeout, err := time.ParseDuration(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout for enricher %s: %v", cfg.Name, err)
+			}
+			cfg.Timeout = timeout
+		}
+		if len(fields) > 2 {
+			cfg.Policy = fields[2]
+		}
+		if cfg.Policy != PolicyBlock && cfg.Policy != PolicySkip && cfg.Policy != PolicyRetry {
+			return nil, fmt.Errorf("invalid policy for enricher %s: %s", cfg.Name, cfg.Policy)
+		}
+		configs = append(configs, cfg)
+	}
+	return configs, nil
+}
+
+type configuredEnricher struct {
+	Enricher
+	timeout time.Duration
+	policy  string
+}
+
+// enrichmentPipeline computes the fields derived from a sensor before it is stored: the time zone,
+// which is always resolved, and the fields of the enabled enrichers.
+// The zero value has no enrichers and does not resolve time zones.
+type enrichmentPipeline struct {
+	timeZones TimeZoneResolver
+	enrichers []configuredEnricher
+}
+
+func newEnrichmentPipeline(timeZones TimeZoneResolver, configs []EnricherConfig, available []Enricher) (enrichmentPipeline, error) {
+	byName := make(map[string]Enricher, len(available))
+	for _, enricher := range available {
+		byName[enricher.Name()] = enricher
+	}
+	pipeline := enrichmentPipeline{timeZones: timeZones}
+	for _, cfg := range configs {
+		if reason, removed := removedEnrichers[cfg.Name]; removed {
+			log.Printf("ignoring the enricher %s, which was removed: %s", cfg.Name, reason)
+			continue
+		}
+		enricher, ok := byName[cfg.Name]
+		if !ok {
+			return pipeline, fmt.Errorf("unknown enricher %s", cfg.Name)
+		}
+		pipeline.enrichers = append(pipeline.enrichers, configuredEnricher{Enricher: enricher, timeout: cfg.Timeout, policy: cfg.Policy})
+	}
+	return pipeline, nil
+}
+
+// Enrich replaces the derived fields of the sensor, returning an error only when an enricher with policy block fails
+func (p enrichmentPipeline) Enrich(ctx context.Context, sensor *db.Sensor) error {
+	sensor.TimeZone = ""
+	if p.timeZones != nil && sensor.Location != nil {
+		sensor.TimeZone, _ = p.timeZones.Resolve(sensor.Location.Lat, sensor.Location.Lon)
+	}
+	if len(p.enrichers) == 0 {
+		return nil
+	}
+	sensor.Derived = map[string]interface{}{}
+	sensor.PendingEnrichers = nil
+	for _, enricher := range p.enrichers {
+		value, err := enricher.run(ctx, *sensor)
+		if err == nil {
+			if value != nil {
+				sensor.Derived[enricher.Name()] = value
+			}
+			continue
+		}
+		switch enricher.policy {
+		case PolicyBlock:
+			return fmt.Errorf("enricher %s failed: %v", enricher.Name(), err)
+		case PolicyRetry:
+			sensor.PendingEnrichers = append(sensor.PendingEnrichers, enricher.Name())
+		}
+		log.Printf("enricher %s failed for sensor %s, policy %s: %s", enricher.Name(), sensor.Name, enricher.policy, err.Error())
+	}
+	return nil
+}
+
+// Retry runs again the pending enrichers of a sensor, keeping the ones that fail pending
+func (p enrichmentPipeline) Retry(ctx context.Context, sensor *db.Sensor) {
+	var pending []string
+	if sensor.Derived == nil {
+		sensor.Derived = map[string]interface{}{}
+	}
+	for _, enricher := range p.enrichers {
+		if !slices.Contains(sensor.PendingEnrichers, enricher.Name()) {
+			continue
+		}
+		value, err := enricher.run(ctx, *sensor)
+		if err != nil {
+			pending = append(pending, enricher.Name())
+			continue
+		}
+		if value != nil {
+			sensor.Derived[enricher.Name()] = value
+		}
+	}
+	sensor.PendingEnrichers = pending
+}
+
+// run calls the enricher, giving up after its timeout even if it ignores the context
+func (e configuredEnricher) run(ctx context.Context, sensor db.Sensor) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	type result struct {
+		value interface{}
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := e.Enrich(ctx, sensor)
+		done <- result{value: value, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// retryPendingEnrichment periodically retries the enrichers with policy retry that failed
+func retryPendingEnrichment(store db.SensorStore, pipeline enrichmentPipeline) {
+	ctx := db.WithPrincipal(db.WithTenant(context.Background(), db.AllTenants), db.Principal{Admin: true})
+	ticker := time.NewTicker(retryEnrichmentPeriod)
+	defer ticker.Stop()
+	// Each batch starts after the previous one, sensors failing again don't keep the others from being retried
+	var lastID primitive.ObjectID
+	for range ticker.C {
+		sensors, err := store.FindPendingEnrichment(ctx, lastID, retryEnrichmentBatch)
+		if err != nil {
+			log.Printf("could not find sensors pending enrichment: %s", err.Error())
+			continue
+		}
+		lastID = primitive.NilObjectID
+		if len(sensors) == retryEnrichmentBatch {
+			lastID = sensors[len(sensors)-1].ID
+		}
+		for i := range sensors {
+			read := sensors[i]
+			pipeline.Retry(ctx, &sensors[i])
+			err = store.UpdateDerived(ctx, read, sensors[i].Derived, sensors[i].PendingEnrichers)
+			// Sensors written meanwhile already had their fields derived again
+			if err != nil && !errors.Is(err, db.ErrSensorChanged) {
+				log.Printf("could not update derived fields of sensor %s: %s", sensors[i].ID.Hex(), err.Error())
+			}
+		}
+	}
+}
+
+// regionEnricher stores the administrative region of the sensor location using Mapbox reverse geocoding
+type regionEnricher struct {
+	mapBox *mapBox
+}
+
+func (regionEnricher) Name() string {
+	return "region"
+}
+
+func (e regionEnricher) Enrich(ctx context.Context, sensor db.Sensor) (interface{}, error) {
+	if sensor.Location == nil {
+		return nil, nil
+	}
+	return e.mapBox.FindRegion(ctx, sensor.Location.Lat, sensor.Location.Lon)
+}
+
+// newEnrichmentPipelineFromEnv creates the pipeline with the enrichers enabled by the ENRICHERS environment variable
+func newEnrichmentPipelineFromEnv(apiKey string, timeZones TimeZoneResolver) (enrichmentPipeline, error) {
+	configs, err := ParseEnricherConfig(os.Getenv("ENRICHERS"))
+	if err != nil {
+		return enrichmentPipeline{}, err
+	}
+	return newEnrichmentPipeline(timeZones, configs, []Enricher{
+		regionEnricher{mapBox: NewMapBox(apiKey)},
+	})
+}
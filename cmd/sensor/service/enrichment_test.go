@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEnricher returns a fixed value or error, optionally after a delay
+type fakeEnricher struct {
+	name  string
+	value interface{}
+	err   error
+	delay time.Duration
+}
+
+func (f fakeEnricher) Name() string {
+	return f.name
+}
+
+func (f fakeEnricher) Enrich(_ context.Context, _ db.Sensor) (interface{}, error) {
+	time.Sleep(f.delay)
+	return f.value, f.err
+}
+
+func TestParseEnricherConfig(t *testing.T) {
+	configs, err := ParseEnricherConfig("geohash, region:2s:retry,slow::block")
+	require.NoError(t, err)
+	require.Equal(t, []EnricherConfig{
+		{Name: "geohash", Timeout: defaultEnricherTimeout, Policy: PolicySkip},
+		{Name: "region", Timeout: 2 * time.Second, Policy: PolicyRetry},
+		{Name: "slow", Timeout: defaultEnricherTimeout, Policy: PolicyBlock},
+	}, configs)
+	configs, err = ParseEnricherConfig("")
+	require.NoError(t, err)
+	require.Empty(t, configs)
+	_, err = ParseEnricherConfig("geohash:1s:ignore")
+	require.EqualError(t, err, "invalid policy for enricher geohash: ignore")
+	_, err = ParseEnricherConfig("geohash:soon")
+	require.Error(t, err)
+}
+
+func TestEnrichmentPipeline(t *testing.T) {
+	ctx := context.Background()
+	available := []Enricher{
+		fakeEnricher{name: "zone", value: "A"},
+		fakeEnricher{name: "broken", err: errors.New("unavailable")},
+		fakeEnricher{name: "slow", value: "late", delay: 100 * time.Millisecond},
+	}
+	sensor := db.Sensor{
+		Name:     "Sensor 1",
+		Location: &db.Location{Lat: 48.8566, Lon: 2.3522},
+		Derived:  map[string]interface{}{"stale": true},
+	}
+	_, err := newEnrichmentPipeline(nil, []EnricherConfig{{Name: "unknown"}}, available)
+	require.EqualError(t, err, "unknown enricher unknown")
+
+	// The geohash enricher was replaced by the cell of the sensors, configurations still naming it are accepted
+	pipeline, err := newEnrichmentPipeline(nil, []EnricherConfig{
+		{Name: "geohash", Timeout: time.Second, Policy: PolicyBlock},
+		{Name: "zone", Timeout: time.Second, Policy: PolicyBlock},
+		{Name: "broken", Timeout: time.Second, Policy: PolicySkip},
+		{Name: "slow", Timeout: 10 * time.Millisecond, Policy: PolicyRetry},
+	}, available)
+	require.NoError(t, err)
+	err = pipeline.Enrich(ctx, &sensor)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"zone": "A"}, sensor.Derived)
+	require.Equal(t, []string{"slow"}, sensor.PendingEnrichers)
+
+	pipeline.enrichers[2].timeout = time.Second
+	pipeline.Retry(ctx, &sensor)
+	require.Equal(t, "late", sensor.Derived["slow"])
+	require.Empty(t, sensor.PendingEnrichers)
+
+	pipeline, err = newEnrichmentPipeline(nil, []EnricherConfig{
+		{Name: "broken", Timeout: time.Second, Policy: PolicyBlock},
+	}, available)
+	require.NoError(t, err)
+	err = pipeline.Enrich(ctx, &sensor)
+	require.EqualError(t, err, "enricher broken failed: unavailable")
+}
@@ -0,0 +1,474 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// SourceName geocodes the sensor name
+	SourceName = "name"
+	// SourceTag geocodes the first tag starting with the job tag prefix, without the prefix
+	SourceTag = "tag"
+
+	defaultJobWorkers       = 4
+	maxJobWorkers           = 32
+	defaultJobRatePerSecond = 5
+	maxJobRatePerSecond     = 100
+	jobPageSize             = 100
+	// jobLeaseDuration is how long a job is held by an instance that stopped renewing its heartbeat
+	jobLeaseDuration     = time.Minute
+	jobHeartbeatInterval = jobLeaseDuration / 4
+)
+
+// GeocodeJobRequest represents the DTO to start a geocoding job
+type GeocodeJobRequest struct {
+	Tags            []string `json:"tags"`
+	MissingLocation bool     `json:"missingLocation"`
+	Source          string   `json:"source"`
+	TagPrefix       string   `json:"tagPrefix"`
+	Workers         int      `json:"workers"`
+	RatePerSecond   float64  `json:"ratePerSecond"`
+}
+
+// GeocodeJob represents the DTO with the progress of a geocoding job
+type GeocodeJob struct {
+	ID              string   `json:"id"`
+	Tags            []string `json:"tags"`
+	MissingLocation bool     `json:"missingLocation"`
+	Source          string   `json:"source"`
+	TagPrefix       string   `json:"tagPrefix,omitempty"`
+	Workers         int      `json:"workers"`
+	RatePerSecond   float64  `json:"ratePerSecond"`
+	Status          string   `json:"status"`
+	Error           string   `json:"error,omitempty"`
+	Processed       int      `json:"processed"`
+	Succeeded       int      `json:"succeeded"`
+	Failed          int      `json:"failed"`
+	Skipped         int      `json:"skipped"`
+	CreatedAt       string   `json:"createdAt"`
+	UpdatedAt       string   `json:"updatedAt"`
+}
+
+// GeocodeResult represents the DTO with the outcome of geocoding a single sensor
+type GeocodeResult struct {
+	SensorID string    `json:"sensorId"`
+	Query    string    `json:"query"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Location *Location `json:"location,omitempty"`
+}
+
+func fromDatabaseToGeocodeJob(job db.GeocodeJob) *GeocodeJob {
+	return &GeocodeJob{
+		ID:              job.ID.Hex(),
+		Tags:            job.Filter.Tags,
+		MissingLocation: job.Filter.MissingLocation,
+		Source:          job.Source,
+		TagPrefix:       job.TagPrefix,
+		Workers:         job.Workers,
+		RatePerSecond:   job.RatePerSecond,
+		Status:          job.Status,
+		Error:           job.Error,
+		Processed:       job.Processed,
+		Succeeded:       job.Succeeded,
+		Failed:          job.Failed,
+		Skipped:         job.Skipped,
+		CreatedAt:       job.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:       job.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func fromDatabaseToGeocodeResult(result db.GeocodeResult) GeocodeResult {
+	dto := GeocodeResult{
+		SensorID: result.SensorID.Hex(),
+		Query:    result.Query,
+		Status:   result.Status,
+		Error:    result.Error,
+	}
+	if result.Location != nil {
+		dto.Location = &Location{
+			Lat: fmt.Sprintf("%f", result.Location.Lat),
+			Lon: fmt.Sprintf("%f", result.Location.Lon),
+		}
+	}
+	return dto
+}
+
+// GeocodeJobService runs batch jobs that geocode a field of existing sensors into their location
+type GeocodeJobService interface {
+	Start(ctx context.Context, request GeocodeJobRequest) (id string, err error)
+	Find(ctx context.Context, id string) (job *GeocodeJob, err error)
+	Results(ctx context.Context, id, status string) (results []GeocodeResult, err error)
+	Cancel(ctx context.Context, id string) (err error)
+}
+
+type geocodeJobService struct {
+	sensorStore db.SensorStore
+	jobStore    db.JobStore
+	mapBox      MapBox
+	enrichment  enrichmentPipeline
+	clusters    *clusterCache
+	// owner identifies this instance of the service in the leases of the jobs it runs
+	owner string
+}
+
+// NewGeocodeJobService creates the job service, which writes sensors like the sensor metadata service,
+// and resumes the jobs interrupted by a restart
+func NewGeocodeJobService(uri, databaseName string, sensors *sensorMetadataService) (*geocodeJobService, error) {
+	js, err := db.NewJobStore(uri, databaseName)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	s := &geocodeJobService{
+		sensorStore: sensors.sensorStore,
+		jobStore:    js,
+		mapBox:      sensors.mapBox,
+		enrichment:  sensors.enrichment,
+		clusters:    sensors.clusters,
+		owner:       hostname + "-" + primitive.NewObjectID().Hex(),
+	}
+	ctx := db.WithTenant(context.Background(), db.AllTenants)
+	err = s.resume(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		ticker := time.NewTicker(jobLeaseDuration)
+		defer ticker.Stop()
+		for range ticker.C {
+			err := s.resume(ctx)
+			if err != nil {
+				log.Printf("could not resume geocode jobs: %s", err.Error())
+			}
+		}
+	}()
+	return s, nil
+}
+
+// resume runs the jobs whose lease expired, because the instance running them stopped. Each job is claimed by a
+// single instance.
+func (s geocodeJobService) resume(ctx context.Context) error {
+	for {
+		job, err := s.jobStore.ClaimGeocodeJob(ctx, s.owner, time.Now().UTC().Add(-jobLeaseDuration))
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("resuming geocode job %s after sensor %s", job.ID.Hex(), job.LastID.Hex())
+		go s.run(*job)
+	}
+}
+
+func (s geocodeJobService) Start(ctx context.Context, request GeocodeJobRequest) (id string, err error) {
+	if request.Source != SourceName && request.Source != SourceTag {
+		return "", fmt.Errorf("source must be %q or %q", SourceName, SourceTag)
+	}
+	if request.Source == SourceTag && request.TagPrefix == "" {
+		return "", errors.New("tagPrefix is required when source is tag")
+	}
+	if request.Workers <= 0 {
+		request.Workers = defaultJobWorkers
+	}
+	if request.Workers > maxJobWorkers {
+		request.Workers = maxJobWorkers
+	}
+	if request.RatePerSecond <= 0 {
+		request.RatePerSecond = defaultJobRatePerSecond
+	}
+	if request.RatePerSecond > maxJobRatePerSecond {
+		request.RatePerSecond = maxJobRatePerSecond
+	}
+	now := time.Now().UTC()
+	job := db.GeocodeJob{
+		Tenant: db.TenantFromContext(ctx),
+		Filter: db.SensorFilter{
+			Tags:            request.Tags,
+			MissingLocation: request.MissingLocation,
+		},
+		Source:        request.Source,
+		TagPrefix:     request.TagPrefix,
+		Workers:       request.Workers,
+		RatePerSecond: request.RatePerSecond,
+		Status:        db.JobRunning,
+		Owner:         s.owner,
+		Heartbeat:     now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if principal := db.PrincipalFromContext(ctx); principal != nil {
+		job.Principal = *principal
+	}
+	job.ID, err = s.jobStore.AddGeocodeJob(ctx, job)
+	if err != nil {
+		return "", err
+	}
+	go s.run(job)
+	return job.ID.Hex(), nil
+}
+
+func (s geocodeJobService) Find(ctx context.Context, id string) (*GeocodeJob, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	job, err := s.jobStore.FindGeocodeJob(ctx, oid)
+	if err != nil {
+		return nil, err
+	}
+	return fromDatabaseToGeocodeJob(*job), nil
+}
+
+func (s geocodeJobService) Results(ctx context.Context, id, status string) ([]GeocodeResult, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	// The results are visible to the tenant of the job only
+	_, err = s.jobStore.FindGeocodeJob(ctx, oid)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.jobStore.FindGeocodeResults(ctx, oid, status)
+	if err != nil {
+		return nil, err
+	}
+	dtos := make([]GeocodeResult, 0, len(results))
+	for i := range results {
+		dtos = append(dtos, fromDatabaseToGeocodeResult(results[i]))
+	}
+	return dtos, nil
+}
+
+func (s geocodeJobService) Cancel(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	job, err := s.jobStore.FindGeocodeJob(ctx, oid)
+	if err != nil {
+		return err
+	}
+	if job.Status != db.JobRunning {
+		return fmt.Errorf("job is %s", job.Status)
+	}
+	return s.jobStore.SetGeocodeJobStatus(ctx, oid, db.JobCancelled, "")
+}
+
+// jobInterval returns the interval between the calls to the geocoding provider, at least a nanosecond as tickers
+// panic without a positive interval
+func jobInterval(ratePerSecond float64) time.Duration {
+	interval := time.Duration(float64(time.Second) / ratePerSecond)
+	if interval < time.Nanosecond {
+		return time.Nanosecond
+	}
+	return interval
+}
+
+// run processes the job page by page, storing the progress after each page so it can be resumed. It stops when
+// another instance claims the job.
+func (s geocodeJobService) run(job db.GeocodeJob) {
+	ctx, cancel := context.WithCancel(db.WithPrincipal(db.WithTenant(context.Background(), job.Tenant), job.Principal))
+	defer cancel()
+	go s.heartbeat(ctx, cancel, job.ID)
+	limiter := time.NewTicker(jobInterval(job.RatePerSecond))
+	defer limiter.Stop()
+	for {
+		current, err := s.jobStore.FindGeocodeJob(ctx, job.ID)
+		if err != nil {
+			log.Printf("could not read geocode job %s: %s", job.ID.Hex(), err.Error())
+			return
+		}
+		if current.Status != db.JobRunning {
+			return
+		}
+		page, err := s.sensorStore.FindPage(ctx, job.Filter, job.LastID, jobPageSize)
+		if err != nil {
+			s.finish(ctx, job.ID, db.JobFailed, err.Error())
+			return
+		}
+		if len(page) == 0 {
+			s.finish(ctx, job.ID, db.JobCompleted, "")
+			return
+		}
+		results := s.processPage(ctx, job, page, limiter.C)
+		if ctx.Err() != nil {
+			// The page is processed again by the instance that claimed the job
+			return
+		}
+		for _, result := range results {
+			err = s.jobStore.SaveGeocodeResult(ctx, result)
+			if err != nil {
+				s.finish(ctx, job.ID, db.JobFailed, err.Error())
+				return
+			}
+			switch result.Status {
+			case db.ResultOK:
+				job.Succeeded++
+			case db.ResultSkipped:
+				job.Skipped++
+			default:
+				job.Failed++
+			}
+		}
+		job.Processed += len(page)
+		job.LastID = page[len(page)-1].ID
+		job.UpdatedAt = time.Now().UTC()
+		err = s.jobStore.UpdateGeocodeJobProgress(ctx, job)
+		if errors.Is(err, db.ErrLeaseLost) {
+			return
+		}
+		if err != nil {
+			s.finish(ctx, job.ID, db.JobFailed, err.Error())
+			return
+		}
+	}
+}
+
+// heartbeat renews the lease of the job until the context is done, cancelling it when another instance claimed the job
+func (s geocodeJobService) heartbeat(ctx context.Context, cancel context.CancelFunc, id primitive.ObjectID) {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := s.jobStore.RenewGeocodeJobLease(ctx, id, s.owner)
+		if errors.Is(err, db.ErrLeaseLost) {
+			log.Printf("geocode job %s is no longer run by this instance", id.Hex())
+			cancel()
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("could not renew the lease of geocode job %s: %s", id.Hex(), err.Error())
+		}
+	}
+}
+
+func (s geocodeJobService) finish(ctx context.Context, id primitive.ObjectID, status, errMessage string) {
+	err := s.jobStore.SetGeocodeJobStatus(ctx, id, status, errMessage)
+	// A job cancelled while its last page was processed stays cancelled
+	if err != nil && !errors.Is(err, db.ErrJobNotRunning) {
+		log.Printf("could not set geocode job %s to %s: %s", id.Hex(), status, err.Error())
+	}
+}
+
+// processPage geocodes a page of sensors with the job workers, all of them sharing the same rate limiter
+func (s geocodeJobService) processPage(ctx context.Context, job db.GeocodeJob, page []db.Sensor, limiter <-chan time.Time) []db.GeocodeResult {
+	sensors := make(chan db.Sensor)
+	results := make(chan db.GeocodeResult)
+	var wg sync.WaitGroup
+	for i := 0; i < job.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sensor := range sensors {
+				results <- s.geocode(ctx, job, sensor, limiter)
+			}
+		}()
+	}
+	go func() {
+		for i := range page {
+			sensors <- page[i]
+		}
+		close(sensors)
+		wg.Wait()
+		close(results)
+	}()
+	collected := make([]db.GeocodeResult, 0, len(page))
+	for result := range results {
+		collected = append(collected, result)
+	}
+	return collected
+}
+
+func (s geocodeJobService) geocode(ctx context.Context, job db.GeocodeJob, sensor db.Sensor, limiter <-chan time.Time) db.GeocodeResult {
+	result := db.GeocodeResult{
+		JobID:     job.ID,
+		SensorID:  sensor.ID,
+		Query:     geocodeQuery(job, sensor),
+		UpdatedAt: time.Now().UTC(),
+	}
+	if result.Query == "" {
+		result.Status = db.ResultSkipped
+		return result
+	}
+	if !sensor.CanWrite(&job.Principal) {
+		result.Status = db.ResultSkipped
+		result.Error = ErrForbidden.Error()
+		return result
+	}
+	<-limiter
+	loc, err := s.mapBox.Geocode(ctx, result.Query)
+	if err == nil {
+		result.Location, err = parseLocation(loc)
+	}
+	previous := sensor.Location
+	if err == nil {
+		sensor.Location = result.Location
+		err = s.enrichment.Enrich(ctx, &sensor)
+	}
+	if err == nil {
+		// The page may have been read long ago, only the location is written, if it did not change meanwhile
+		err = s.sensorStore.UpdateLocation(ctx, sensor, previous)
+	}
+	if err != nil {
+		result.Status = db.ResultFailed
+		result.Error = err.Error()
+		result.Location = nil
+		return result
+	}
+	s.clusters.invalidate()
+	result.Status = db.ResultOK
+	return result
+}
+
+// geocodeQuery returns the text of the sensor that should be geocoded for the job
+func geocodeQuery(job db.GeocodeJob, sensor db.Sensor) string {
+	if job.Source == SourceName {
+		return strings.TrimSpace(sensor.Name)
+	}
+	for _, tag := range sensor.Tags {
+		if strings.HasPrefix(tag, job.TagPrefix) {
+			return strings.TrimSpace(strings.TrimPrefix(tag, job.TagPrefix))
+		}
+	}
+	return ""
+}
+
+func parseLocation(loc *Location) (*db.Location, error) {
+	lat, lon, err := parseCoordinates(loc)
+	if err != nil {
+		return nil, err
+	}
+	location := &db.Location{Lat: lat, Lon: lon, Altitude: loc.Altitude, Floor: loc.Floor, Accuracy: loc.Accuracy}
+	if loc.Accuracy < 0 {
+		return nil, errors.New("accuracy must be positive")
+	}
+	if loc.Altitude != nil {
+		location.AltitudeDatum = loc.AltitudeDatum
+		if location.AltitudeDatum == "" {
+			location.AltitudeDatum = db.DatumWGS84
+		}
+		err = validateDatum(location.AltitudeDatum)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return location, nil
+}
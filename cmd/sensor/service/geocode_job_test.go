@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	dbMock "github.com/ViniciusMiana/sensor-metadata/mocks/sensor/db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// fakeMapBox geocodes from a fixed map of places
+type fakeMapBox map[string]*Location
+
+func (f fakeMapBox) FindLatLon(location string) (*Location, error) {
+	return f.Geocode(context.Background(), location)
+}
+
+func (f fakeMapBox) Geocode(_ context.Context, location string) (*Location, error) {
+	loc, ok := f[location]
+	if !ok {
+		return nil, errors.New("Not found")
+	}
+	return loc, nil
+}
+
+func TestGeocodeJobRun(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	mockJob := dbMock.NewJobStore(t)
+	job := db.GeocodeJob{
+		ID:            primitive.NewObjectID(),
+		Tenant:        "acme",
+		Principal:     db.Principal{User: "editor"},
+		Source:        SourceTag,
+		TagPrefix:     "city:",
+		Workers:       2,
+		RatePerSecond: 1000,
+		Status:        db.JobRunning,
+	}
+	// The job runs in the tenant and for the user who started it
+	ctx := mock.MatchedBy(func(ctx context.Context) bool {
+		principal := db.PrincipalFromContext(ctx)
+		return db.TenantFromContext(ctx) == job.Tenant && principal != nil && principal.User == job.Principal.User
+	})
+	page := []db.Sensor{
+		{ID: primitive.NewObjectID(), Name: "Sensor 1", Tags: []string{"city:Paris"}},
+		{ID: primitive.NewObjectID(), Name: "Sensor 2", Tags: []string{"city:Atlantis"}},
+		{ID: primitive.NewObjectID(), Name: "Sensor 3", Tags: []string{"Tag1"}},
+	}
+	service := geocodeJobService{
+		sensorStore: mockSensor,
+		jobStore:    mockJob,
+		mapBox:      fakeMapBox{"Paris": {Lat: "48.85", Lon: "2.35"}},
+	}
+	mockJob.On("FindGeocodeJob", ctx, job.ID).Return(&job, nil).Twice()
+	mockSensor.On("FindPage", ctx, job.Filter, primitive.NilObjectID, int64(jobPageSize)).Return(page, nil).Once()
+	mockSensor.On("FindPage", ctx, job.Filter, page[2].ID, int64(jobPageSize)).Return([]db.Sensor{}, nil).Once()
+	mockSensor.On("UpdateLocation", ctx, mock.MatchedBy(func(sensor db.Sensor) bool {
+		return sensor.ID == page[0].ID && *sensor.Location == db.Location{Lat: 48.85, Lon: 2.35}
+	}), (*db.Location)(nil)).Return(nil).Once()
+	results := map[primitive.ObjectID]string{}
+	mockJob.On("SaveGeocodeResult", ctx, mock.Anything).Run(func(args mock.Arguments) {
+		result := args.Get(1).(db.GeocodeResult)
+		results[result.SensorID] = result.Status
+	}).Return(nil).Times(3)
+	mockJob.On("UpdateGeocodeJobProgress", ctx, mock.MatchedBy(func(progress db.GeocodeJob) bool {
+		return progress.LastID == page[2].ID && progress.Processed == 3 &&
+			progress.Succeeded == 1 && progress.Failed == 1 && progress.Skipped == 1
+	})).Return(nil).Once()
+	mockJob.On("SetGeocodeJobStatus", ctx, job.ID, db.JobCompleted, "").Return(nil).Once()
+	defer mockSensor.AssertExpectations(t)
+	defer mockJob.AssertExpectations(t)
+
+	service.run(job)
+	require.Equal(t, map[primitive.ObjectID]string{
+		page[0].ID: db.ResultOK,
+		page[1].ID: db.ResultFailed,
+		page[2].ID: db.ResultSkipped,
+	}, results)
+}
+
+func TestGeocodeJobLease(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	mockJob := dbMock.NewJobStore(t)
+	service := geocodeJobService{sensorStore: mockSensor, jobStore: mockJob, owner: "instance-1"}
+	job := db.GeocodeJob{ID: primitive.NewObjectID(), Source: SourceName, Workers: 1, RatePerSecond: 1000, Status: db.JobRunning}
+	page := []db.Sensor{{ID: primitive.NewObjectID()}}
+	mockJob.On("FindGeocodeJob", mock.Anything, job.ID).Return(&job, nil).Once()
+	mockSensor.On("FindPage", mock.Anything, job.Filter, primitive.NilObjectID, int64(jobPageSize)).Return(page, nil).Once()
+	mockJob.On("SaveGeocodeResult", mock.Anything, mock.Anything).Return(nil).Once()
+	mockJob.On("UpdateGeocodeJobProgress", mock.Anything, mock.Anything).Return(db.ErrLeaseLost).Once()
+	defer mockSensor.AssertExpectations(t)
+	defer mockJob.AssertExpectations(t)
+
+	// A job claimed by another instance is left running for it
+	service.run(job)
+
+	// Expired jobs are claimed until there is none left
+	ctx := context.Background()
+	cancelled := db.GeocodeJob{ID: primitive.NewObjectID(), Status: db.JobCancelled}
+	mockJob.On("ClaimGeocodeJob", ctx, "instance-1", mock.Anything).Return(&cancelled, nil).Once()
+	mockJob.On("ClaimGeocodeJob", ctx, "instance-1", mock.Anything).Return(nil, mongo.ErrNoDocuments).Once()
+	mockJob.On("FindGeocodeJob", mock.Anything, cancelled.ID).Return(&cancelled, nil).Maybe()
+	require.NoError(t, service.resume(ctx))
+}
+
+func TestGeocodeJobStartValidation(t *testing.T) {
+	service := geocodeJobService{}
+	_, err := service.Start(context.Background(), GeocodeJobRequest{Source: "address"})
+	require.Error(t, err)
+	_, err = service.Start(context.Background(), GeocodeJobRequest{Source: SourceTag})
+	require.EqualError(t, err, "tagPrefix is required when source is tag")
+
+	// The rate is limited
+	mockJob := dbMock.NewJobStore(t)
+	service.jobStore = mockJob
+	mockJob.On("AddGeocodeJob", mock.Anything, mock.MatchedBy(func(job db.GeocodeJob) bool {
+		return job.RatePerSecond == maxJobRatePerSecond
+	})).Return(primitive.NilObjectID, errors.New("not stored")).Once()
+	_, err = service.Start(context.Background(), GeocodeJobRequest{Source: SourceName, RatePerSecond: 1e12})
+	require.EqualError(t, err, "not stored")
+}
+
+func TestJobInterval(t *testing.T) {
+	require.Equal(t, 200*time.Millisecond, jobInterval(defaultJobRatePerSecond))
+	require.Equal(t, 10*time.Millisecond, jobInterval(maxJobRatePerSecond))
+	// Rates of more than a call per nanosecond would stop the ticker from starting
+	require.Equal(t, time.Nanosecond, jobInterval(1e12))
+}
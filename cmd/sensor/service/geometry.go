@@ -0,0 +1,61 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+)
+
+// Geometry represents a GeoJSON Point, LineString or Polygon geometry of a sensor
+type Geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+func (g Geometry) toDatabase() (*db.GeoJson, error) {
+	geometry := db.GeoJson{Type: g.Type}
+	var err error
+	switch g.Type {
+	case db.GeometryPoint:
+		err = json.Unmarshal(g.Coordinates, &geometry.Coordinates)
+		if err == nil && (len(geometry.Coordinates) < 2 || math.Abs(geometry.Coordinates[0]) > 180 || math.Abs(geometry.Coordinates[1]) > 90) {
+			err = errors.New("point must be [lon, lat]")
+		}
+	case db.GeometryLineString:
+		err = json.Unmarshal(g.Coordinates, &geometry.Line)
+		if err == nil {
+			err = GeoJSONLineString{Type: g.Type, Coordinates: geometry.Line}.validate()
+		}
+	case db.GeometryPolygon:
+		err = json.Unmarshal(g.Coordinates, &geometry.Polygon)
+		if err == nil {
+			err = GeoJSONPolygon{Type: g.Type, Coordinates: geometry.Polygon}.validate()
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry %s, it must be Point, LineString or Polygon", g.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid geometry: %v", err)
+	}
+	return &geometry, nil
+}
+
+func fromDatabaseToGeometry(geometry *db.GeoJson) *Geometry {
+	var coordinates interface{}
+	switch geometry.Type {
+	case db.GeometryLineString:
+		coordinates = geometry.Line
+	case db.GeometryPolygon:
+		coordinates = geometry.Polygon
+	default:
+		coordinates = geometry.Coordinates
+	}
+	raw, err := json.Marshal(coordinates)
+	if err != nil {
+		return nil
+	}
+	return &Geometry{Type: geometry.Type, Coordinates: raw}
+}
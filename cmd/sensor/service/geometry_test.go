@@ -0,0 +1,50 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeometryToDatabase(t *testing.T) {
+	var sensor SensorMetadata
+	err := json.Unmarshal([]byte(`{"name":"Cable","location":{"lat":"50","lon":"50"},
+		"geometry":{"type":"LineString","coordinates":[[0,0],[0,2]]}}`), &sensor)
+	require.NoError(t, err)
+	mObj, err := sensor.ToDatabase()
+	require.NoError(t, err)
+	require.Equal(t, &db.GeoJson{Type: db.GeometryLineString, Line: [][]float64{{0, 0}, {0, 2}}}, mObj.GeoJson)
+	// The location is replaced by the representative point
+	require.InDelta(t, 1, mObj.Location.Lat, 1e-6)
+	require.InDelta(t, 0, mObj.Location.Lon, 1e-6)
+	result := FromDatabaseToSensorMetadata(*mObj)
+	require.Equal(t, "LineString", result.Geometry.Type)
+	require.JSONEq(t, `[[0,0],[0,2]]`, string(result.Geometry.Coordinates))
+
+	sensor.Geometry = &Geometry{Type: "Polygon", Coordinates: json.RawMessage(`[[[0,0],[2,0],[2,2],[0,2],[0,0]]]`)}
+	mObj, err = sensor.ToDatabase()
+	require.NoError(t, err)
+	require.Equal(t, db.GeometryPolygon, mObj.GeoJson.Type)
+	require.InDelta(t, 1, mObj.Location.Lat, 1e-6)
+
+	// A point geometry is the same as a location
+	sensor.Geometry = &Geometry{Type: "Point", Coordinates: json.RawMessage(`[2.35,48.85]`)}
+	mObj, err = sensor.ToDatabase()
+	require.NoError(t, err)
+	require.Nil(t, mObj.GeoJson)
+	require.Equal(t, &db.Location{Lat: 48.85, Lon: 2.35}, mObj.Location)
+	require.Nil(t, FromDatabaseToSensorMetadata(*mObj).Geometry)
+
+	for _, geometry := range []Geometry{
+		{Type: "MultiPoint", Coordinates: json.RawMessage(`[[0,0]]`)},
+		{Type: "LineString", Coordinates: json.RawMessage(`[[0,0]]`)},
+		{Type: "Polygon", Coordinates: json.RawMessage(`[[0,0],[1,1]]`)},
+		{Type: "Point", Coordinates: json.RawMessage(`[200,0]`)},
+	} {
+		sensor.Geometry = &geometry
+		_, err = sensor.ToDatabase()
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Move represents the DTO recording that a sensor was moved to a new location or geometry
+type Move struct {
+	Location *Location `json:"location,omitempty"`
+	Geometry *Geometry `json:"geometry,omitempty"`
+	// ValidFrom is when the sensor was moved, now when absent
+	ValidFrom *time.Time `json:"validFrom,omitempty"`
+}
+
+// LocationPeriod represents the DTO of where a sensor was from ValidFrom until ValidTo, the current location has no ValidTo
+type LocationPeriod struct {
+	Location  *Location  `json:"location,omitempty"`
+	Geometry  *Geometry  `json:"geometry,omitempty"`
+	ValidFrom time.Time  `json:"validFrom"`
+	ValidTo   *time.Time `json:"validTo,omitempty"`
+}
+
+// Move records a new location of the sensor, the previous one remains in its history until the time of the move
+func (s sensorMetadataService) Move(ctx context.Context, id string, move Move) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	at := time.Now().UTC()
+	if move.ValidFrom != nil {
+		if move.ValidFrom.After(at) {
+			return errors.New("validFrom can't be in the future")
+		}
+		at = move.ValidFrom.UTC()
+	}
+	if move.Location == nil && move.Geometry == nil {
+		return errors.New("a move needs a location or a geometry")
+	}
+	sensorMongo, err := s.findWritable(ctx, oid)
+	if err != nil {
+		return err
+	}
+	sensor := FromDatabaseToSensorMetadata(*sensorMongo)
+	sensor.Location = move.Location
+	sensor.Geometry = move.Geometry
+	moved, err := sensor.ToDatabase()
+	if err != nil {
+		return err
+	}
+	err = s.enrichment.Enrich(ctx, moved)
+	if err != nil {
+		return err
+	}
+	err = s.sensorStore.Move(ctx, *moved, at)
+	if err != nil {
+		return err
+	}
+	s.clusters.invalidate()
+	return nil
+}
+
+// LocationHistory returns the locations of the sensor, oldest first
+func (s sensorMetadataService) LocationHistory(ctx context.Context, id string) ([]LocationPeriod, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	periodsMongo, err := s.sensorStore.FindLocationHistory(ctx, oid)
+	if err != nil {
+		return nil, err
+	}
+	periods := make([]LocationPeriod, 0, len(periodsMongo))
+	for _, period := range periodsMongo {
+		// The location and geometry are converted as the ones of a sensor
+		located := FromDatabaseToSensorMetadata(db.Sensor{Location: period.Location, GeoJson: period.GeoJson})
+		periods = append(periods, LocationPeriod{
+			Location:  located.Location,
+			Geometry:  located.Geometry,
+			ValidFrom: period.ValidFrom,
+			ValidTo:   period.ValidTo,
+		})
+	}
+	return periods, nil
+}
+
+// validateAt rejects nearest queries as of a moment in the future
+func validateAt(at *time.Time) error {
+	if at != nil && at.After(time.Now()) {
+		return fmt.Errorf("at can't be in the future: %s", at.Format(time.RFC3339))
+	}
+	return nil
+}
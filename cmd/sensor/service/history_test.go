@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	dbMock "github.com/ViniciusMiana/sensor-metadata/mocks/sensor/db"
+)
+
+func TestMove(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := db.WithPrincipal(context.Background(), db.Principal{User: "editor"})
+	service := sensorMetadataService{
+		sensorStore: mockSensor,
+	}
+	id := primitive.NewObjectID()
+	missing := primitive.NewObjectID()
+	at := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	sensor := db.Sensor{
+		ID:       id,
+		Name:     "Sensor 1",
+		Tags:     []string{"Tag1"},
+		Location: &db.Location{Lat: 1, Lon: 2},
+		Coverage: &db.Coverage{Radius: 100},
+	}
+	mockSensor.On("FindByID", ctx, id).Return(&sensor, nil).Once()
+	mockSensor.On("FindByID", ctx, missing).Return(nil, mongo.ErrNoDocuments).Once()
+	mockSensor.On("Move", ctx, mock.MatchedBy(func(moved db.Sensor) bool {
+		return moved.ID == id && moved.Name == "Sensor 1" && *moved.Location == db.Location{Lat: 3, Lon: 4} &&
+			moved.Coverage.Radius == 100
+	}), at).Return(nil).Once()
+	defer mockSensor.AssertExpectations(t)
+
+	err := service.Move(ctx, id.Hex(), Move{Location: &Location{Lat: "3", Lon: "4"}, ValidFrom: &at})
+	require.NoError(t, err)
+	err = service.Move(ctx, missing.Hex(), Move{Location: &Location{Lat: "3", Lon: "4"}})
+	require.ErrorIs(t, err, ErrNotFound)
+	err = service.Move(ctx, id.Hex(), Move{})
+	require.Error(t, err)
+	future := time.Now().Add(time.Hour)
+	err = service.Move(ctx, id.Hex(), Move{Location: &Location{Lat: "3", Lon: "4"}, ValidFrom: &future})
+	require.Error(t, err)
+	err = service.Move(ctx, "invalid", Move{Location: &Location{Lat: "3", Lon: "4"}})
+	require.Error(t, err)
+}
+
+func TestLocationHistory(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := context.Background()
+	service := sensorMetadataService{
+		sensorStore: mockSensor,
+	}
+	id := primitive.NewObjectID()
+	moved := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	mockSensor.On("FindLocationHistory", ctx, id).Return([]db.LocationPeriod{
+		{SensorID: id, Location: &db.Location{Lat: 1, Lon: 2}, ValidFrom: id.Timestamp(), ValidTo: &moved},
+		{SensorID: id, Location: &db.Location{Lat: 3, Lon: 4}, ValidFrom: moved},
+	}, nil).Once()
+	defer mockSensor.AssertExpectations(t)
+	periods, err := service.LocationHistory(ctx, id.Hex())
+	require.NoError(t, err)
+	require.Equal(t, []LocationPeriod{
+		{Location: &Location{Lat: "1.000000", Lon: "2.000000"}, ValidFrom: id.Timestamp(), ValidTo: &moved},
+		{Location: &Location{Lat: "3.000000", Lon: "4.000000"}, ValidFrom: moved},
+	}, periods)
+}
+
+func TestFindNearestAt(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := context.Background()
+	service := sensorMetadataService{
+		sensorStore: mockSensor,
+	}
+	at := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	sensor := db.Sensor{Name: "Sensor 1", Location: &db.Location{Lat: 1, Lon: 2}}
+	mockSensor.On("FindNearestAt", ctx, db.Location{Lat: 1, Lon: 2}, db.SensorFilter{Tags: []string{"Tag1"}}, 0.0, at).
+		Return(&sensor, nil).Once()
+	defer mockSensor.AssertExpectations(t)
+	result, err := service.FindNearest(ctx, Location{Lat: "1", Lon: "2"}, NearestFilter{Tags: []string{"Tag1"}, At: &at})
+	require.NoError(t, err)
+	require.Equal(t, "Sensor 1", result.Name)
+	future := time.Now().Add(time.Hour)
+	_, err = service.FindNearest(ctx, Location{Lat: "1", Lon: "2"}, NearestFilter{At: &future})
+	require.Error(t, err)
+}
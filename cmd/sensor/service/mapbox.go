@@ -1,64 +1,114 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"net/url"
 )
 
 const baseURL = "https://api.mapbox.com/geocoding/v5/mapbox.places/"
 
 type MapBox interface {
 	FindLatLon(location string) (*Location, error)
+	Geocode(ctx context.Context, location string) (*Location, error)
 }
 
+// ErrRateLimited is returned when Mapbox rejects a request for exceeding the rate limit of the account
+var ErrRateLimited = errors.New("geocoding rate limit exceeded")
+
 type mapBox struct {
-	apiKey string
+	apiKey  string
+	baseURL string
 }
 
 func NewMapBox(apiKey string) *mapBox {
 	return &mapBox{
-		apiKey: apiKey,
+		apiKey:  apiKey,
+		baseURL: baseURL,
 	}
 }
 
 func (m mapBox) FindLatLon(location string) (*Location, error) {
-	path := fmt.Sprintf("%s.json?access_token=%s", location, m.apiKey)
-	resp, getErr := http.Get(baseURL + path)
-	if getErr != nil {
-		log.Fatal(getErr)
-	}
-	body, readErr := io.ReadAll(resp.Body)
-	if readErr != nil {
-		log.Fatal(readErr)
+	return m.Geocode(context.Background(), location)
+}
+
+// Geocode returns the location of a place name
+func (m mapBox) Geocode(ctx context.Context, location string) (*Location, error) {
+	path := fmt.Sprintf("%s.json?access_token=%s", url.PathEscape(location), m.apiKey)
+	body, err := m.get(ctx, path)
+	if err != nil {
+		return nil, err
 	}
 	return parseMapboxGeocode(string(body))
 }
 
+// get reads the body of a successful response of the geocoding API
+func (m mapBox) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.baseURL+path, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusTooManyRequests:
+		return nil, ErrRateLimited
+	default:
+		return nil, fmt.Errorf("geocoding failed with status %d", resp.StatusCode)
+	}
+}
+
 func parseMapboxGeocode(body string) (*Location, error) {
-	var result map[string]any
+	var result struct {
+		Features []struct {
+			Center []float64 `json:"center"`
+		} `json:"features"`
+	}
 	err := json.Unmarshal([]byte(body), &result)
 	if err != nil {
 		return nil, err
 	}
-	// The object stored in the "birds" key is also stored as
-	// a map[string]any type, and its type is asserted from
-	// the `any` type
-	features := result["features"].([]any)
-	if len(features) > 0 {
-		feature := features[0].(map[string]any)
-		center := feature["center"].([]any)
-		if len(center) != 2 {
-			return nil, errors.New("Not found")
-		}
-		return &Location{
-			Lat: fmt.Sprint(center[1].(float64)),
-			Lon: fmt.Sprint(center[0].(float64)),
-		}, nil
-	} else {
+	if len(result.Features) == 0 || len(result.Features[0].Center) != 2 {
 		return nil, errors.New("Not found")
 	}
+	center := result.Features[0].Center
+	return &Location{
+		Lat: fmt.Sprint(center[1]),
+		Lon: fmt.Sprint(center[0]),
+	}, nil
+}
+
+// FindRegion returns the name of the administrative region of a location
+func (m mapBox) FindRegion(ctx context.Context, lat, lon float64) (string, error) {
+	path := fmt.Sprintf("%f,%f.json?types=region&access_token=%s", lon, lat, m.apiKey)
+	body, err := m.get(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return parseMapboxRegion(string(body))
+}
+
+func parseMapboxRegion(body string) (string, error) {
+	var result struct {
+		Features []struct {
+			Text string `json:"text"`
+		} `json:"features"`
+	}
+	err := json.Unmarshal([]byte(body), &result)
+	if err != nil {
+		return "", err
+	}
+	if len(result.Features) == 0 {
+		return "", errors.New("Not found")
+	}
+	return result.Features[0].Text, nil
 }
@@ -1,6 +1,9 @@
 package service
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -12,3 +15,29 @@ func TestMapbox(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, Location{Lat: "34.053691", Lon: "-118.242766"}, *loc)
 }
+
+func TestGeocodeErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/Rue%20de%20Rivoli%2F1%3F%23.json":
+			_, _ = w.Write([]byte(`{"features":[{"center":[2.35,48.85]}]}`))
+		case "/Busy.json":
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"message":"Too Many Requests"}`))
+		default:
+			_, _ = w.Write([]byte(`{"message":"Not Found"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	service := mapBox{apiKey: "key", baseURL: server.URL + "/"}
+	ctx := context.Background()
+
+	// Names are escaped in the path
+	loc, err := service.Geocode(ctx, "Rue de Rivoli/1?#")
+	require.NoError(t, err)
+	require.Equal(t, Location{Lat: "48.85", Lon: "2.35"}, *loc)
+	_, err = service.Geocode(ctx, "Busy")
+	require.ErrorIs(t, err, ErrRateLimited)
+	_, err = service.Geocode(ctx, "Atlantis")
+	require.EqualError(t, err, "Not found")
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxNearestBatch is the maximum number of points of a batch nearest lookup
+	MaxNearestBatch = 10000
+
+	nearestBatchWorkers = 8
+)
+
+// NearestQuery represents a point of a batch nearest lookup with its own filters
+type NearestQuery struct {
+	LevelFilter
+	// ID is chosen by the caller to match results with points, it is returned as is
+	ID          string            `json:"id,omitempty"`
+	Lat         string            `json:"lat"`
+	Lon         string            `json:"lon"`
+	Format      string            `json:"format,omitempty"`
+	Coordinates string            `json:"coordinates,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Type        string            `json:"type,omitempty"`
+	Status      string            `json:"status,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	MaxDistance float64           `json:"maxDistance,omitempty"`
+	// At is the moment of the question as in NearestFilter
+	At *time.Time `json:"at,omitempty"`
+}
+
+// NearestResult represents the nearest sensor of a point of a batch, or why it could not be found
+type NearestResult struct {
+	ID     string          `json:"id,omitempty"`
+	Sensor *SensorMetadata `json:"sensor,omitempty"`
+	// Distance is in meters to the geometry of the sensor
+	Distance float64 `json:"distance,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// FindNearestBatch finds the nearest sensor of every point concurrently, the results are in the order of the queries.
+// A point that fails has the error in its result, the other points are not affected.
+func (s sensorMetadataService) FindNearestBatch(ctx context.Context, queries []NearestQuery) ([]NearestResult, error) {
+	if len(queries) > MaxNearestBatch {
+		return nil, fmt.Errorf("a batch can have at most %d points", MaxNearestBatch)
+	}
+	results := make([]NearestResult, len(queries))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < nearestBatchWorkers && w < len(queries); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = s.findNearestResult(ctx, queries[i])
+			}
+		}()
+	}
+	for i := range queries {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results, nil
+}
+
+func (s sensorMetadataService) findNearestResult(ctx context.Context, query NearestQuery) NearestResult {
+	result := NearestResult{ID: query.ID}
+	loc, err := parseLocation(&Location{Lat: query.Lat, Lon: query.Lon, Format: query.Format, Coordinates: query.Coordinates})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	sensorMongo, err := s.findNearest(ctx, *loc, NearestFilter{
+		LevelFilter: query.LevelFilter,
+		Tags:        query.Tags,
+		Type:        query.Type,
+		Status:      query.Status,
+		Attributes:  query.Attributes,
+		MaxDistance: query.MaxDistance,
+		At:          query.At,
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Sensor = FromDatabaseToSensorMetadata(*sensorMongo)
+	result.Distance = sensorMongo.DistanceTo(loc.Lat, loc.Lon)
+	return result
+}
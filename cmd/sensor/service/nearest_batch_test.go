@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	dbMock "github.com/ViniciusMiana/sensor-metadata/mocks/sensor/db"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestFindNearestBatch(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := context.Background()
+	service := sensorMetadataService{sensorStore: mockSensor}
+	var queries []NearestQuery
+	for i := 0; i < 50; i++ {
+		lat := float64(i)
+		sensor := db.Sensor{Name: fmt.Sprintf("Sensor %d", i), Location: &db.Location{Lat: lat + 1, Lon: 0}}
+		mockSensor.On("FindNearest", ctx, db.Location{Lat: lat, Lon: 0}, db.SensorFilter{}, 0.0).Return(&sensor, nil).Once()
+		queries = append(queries, NearestQuery{ID: fmt.Sprint(i), Lat: fmt.Sprint(lat), Lon: "0"})
+	}
+	mockSensor.On("FindNearest", ctx, db.Location{Lat: 1, Lon: 1}, db.SensorFilter{Type: "temperature"}, 100.0).
+		Return(nil, mongo.ErrNoDocuments).Once()
+	queries = append(queries,
+		NearestQuery{ID: "filtered", Lat: "1", Lon: "1", Type: "temperature", MaxDistance: 100},
+		NearestQuery{ID: "invalid", Lat: "north", Lon: "1"},
+	)
+	defer mockSensor.AssertExpectations(t)
+
+	results, err := service.FindNearestBatch(ctx, queries)
+	require.NoError(t, err)
+	require.Len(t, results, len(queries))
+	for i := 0; i < 50; i++ {
+		require.Equal(t, fmt.Sprint(i), results[i].ID)
+		require.Equal(t, fmt.Sprintf("Sensor %d", i), results[i].Sensor.Name)
+		require.InDelta(t, 111195, results[i].Distance, 1)
+	}
+	require.Equal(t, NearestResult{ID: "filtered", Error: ErrNotFound.Error()}, results[50])
+	require.Nil(t, results[51].Sensor)
+	require.NotEmpty(t, results[51].Error)
+
+	_, err = service.FindNearestBatch(ctx, make([]NearestQuery, MaxNearestBatch+1))
+	require.Error(t, err)
+}
@@ -2,12 +2,16 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
-	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 /*
@@ -21,14 +25,102 @@ Points for improvement: */
 type Location struct {
 	Lat string `json:"lat"`
 	Lon string `json:"lon"`
+	// Format of the coordinates, decimal (the default), dms, utm, mgrs or pluscode
+	Format string `json:"format,omitempty"`
+	// Coordinates holds the position in the utm, mgrs and pluscode formats, which replace lat and lon
+	Coordinates string `json:"coordinates,omitempty"`
+	// Altitude is in meters above the datum
+	Altitude *float64 `json:"altitude,omitempty"`
+	// AltitudeDatum is WGS84 (the default), MSL or AGL
+	AltitudeDatum string `json:"altitudeDatum,omitempty"`
+	// Floor is the indoor floor level, 0 being the ground floor
+	Floor *int `json:"floor,omitempty"`
+	// Accuracy is the radius in meters of the horizontal uncertainty of the position
+	Accuracy float64 `json:"accuracy,omitempty"`
+}
+
+// LevelFilter selects sensors by their floor or by a band of altitude
+type LevelFilter struct {
+	Floor       *int     `json:"floor,omitempty"`
+	MinAltitude *float64 `json:"minAltitude,omitempty"`
+	MaxAltitude *float64 `json:"maxAltitude,omitempty"`
+	// AltitudeDatum restricts the band to altitudes in this datum
+	AltitudeDatum string `json:"altitudeDatum,omitempty"`
+}
+
+func (f LevelFilter) toDatabase(filter db.SensorFilter) (db.SensorFilter, error) {
+	if f.MinAltitude != nil && f.MaxAltitude != nil && *f.MinAltitude > *f.MaxAltitude {
+		return filter, errors.New("minAltitude must not be greater than maxAltitude")
+	}
+	if f.AltitudeDatum != "" {
+		err := validateDatum(f.AltitudeDatum)
+		if err != nil {
+			return filter, err
+		}
+	}
+	filter.Floor = f.Floor
+	filter.MinAltitude = f.MinAltitude
+	filter.MaxAltitude = f.MaxAltitude
+	filter.AltitudeDatum = f.AltitudeDatum
+	return filter, nil
+}
+
+// cacheKey returns a text that differs for every filter
+func (f LevelFilter) cacheKey() string {
+	key := f.AltitudeDatum
+	if f.Floor != nil {
+		key += fmt.Sprintf("|floor=%d", *f.Floor)
+	}
+	if f.MinAltitude != nil {
+		key += fmt.Sprintf("|min=%g", *f.MinAltitude)
+	}
+	if f.MaxAltitude != nil {
+		key += fmt.Sprintf("|max=%g", *f.MaxAltitude)
+	}
+	return key
+}
+
+func validateDatum(datum string) error {
+	if datum != db.DatumWGS84 && datum != db.DatumMSL && datum != db.DatumAGL {
+		return fmt.Errorf("invalid altitude datum %s, it must be WGS84, MSL or AGL", datum)
+	}
+	return nil
 }
 
 // SensorMetadata represents a sensor metadata DTO
 type SensorMetadata struct {
-	ID       string    `json:"id,omitempty"`
-	Name     string    `json:"name"`
+	ID string `json:"id,omitempty"`
+	// Tenant owns the sensor, it is ignored on writes unless the user operates across tenants
+	Tenant string `json:"tenant,omitempty"`
+	// Owner and ACL decide who reads and changes the sensor, they are ignored on writes and have their own endpoints
+	Owner string     `json:"owner,omitempty"`
+	ACL   []ACLEntry `json:"acl,omitempty"`
+	Name  string     `json:"name"`
+	// Location is the representative point of a line or polygon geometry, it is ignored on writes with such a geometry
 	Location *Location `json:"location,omitempty"`
+	// Geometry is only returned for lines and polygons
+	Geometry *Geometry `json:"geometry,omitempty"`
 	Tags     []string  `json:"tags"`
+	Type     string    `json:"type,omitempty"`
+	Status   string    `json:"status,omitempty"`
+	// Attributes are free key value pairs describing the sensor
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// TimeZone is the IANA time zone of the location, it is ignored on writes
+	TimeZone string `json:"timeZone,omitempty"`
+	// Cell is the geohash of the location, it is ignored on writes
+	Cell string `json:"cell,omitempty"`
+	// Derived contains the fields computed by the enrichers, it is ignored on writes
+	Derived  map[string]interface{} `json:"derived,omitempty"`
+	Coverage *Coverage              `json:"coverage,omitempty"`
+}
+
+// SensorListFilter represents the filters and pagination of a sensor list
+type SensorListFilter struct {
+	Tags     []string
+	TimeZone string
+	// After is the id of the last sensor of the previous page
+	After string
+	Limit int64
 }
 
 // SensorMetadataWithLocationName represents a sensor metadata DTO
@@ -37,30 +129,89 @@ type SensorMetadataWithLocationName struct {
 	Name     string   `json:"name"`
 	Location string   `json:"location,omitempty"`
 	Tags     []string `json:"tags"`
+	Type     string   `json:"type,omitempty"`
+	Status   string   `json:"status,omitempty"`
+	// Attributes are free key value pairs describing the sensor
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// NearestFilter represents the conditions a sensor must meet to be returned by a nearest query
+type NearestFilter struct {
+	LevelFilter
+	Tags       []string
+	Type       string
+	Status     string
+	Attributes map[string]string
+	// MaxDistance is the maximum distance in meters, no limit when zero
+	MaxDistance float64
+	// At is the moment of the question, sensors are at the location they had then, the current one when nil
+	At *time.Time
+}
+
+// ErrNotFound is returned when no sensor matches a query
+var ErrNotFound = errors.New("no sensor found")
+
+// validateAttributeKeys rejects keys that mongo would read as a path or an operator
+func validateAttributeKeys(attributes map[string]string) error {
+	for key := range attributes {
+		if key == "" || strings.ContainsAny(key, ".$") {
+			return fmt.Errorf("invalid attribute name %q", key)
+		}
+	}
+	return nil
 }
 
 // ToDatabase converts sensor meta-data to the database format
 func (s SensorMetadata) ToDatabase() (*db.Sensor, error) {
+	err := validateAttributeKeys(s.Attributes)
+	if err != nil {
+		return nil, err
+	}
 	mObj := db.Sensor{
-		Name:     s.Name,
-		Tags:     s.Tags,
-		Location: nil,
+		Tenant:     s.Tenant,
+		Name:       s.Name,
+		Tags:       s.Tags,
+		Type:       s.Type,
+		Status:     s.Status,
+		Attributes: s.Attributes,
+		Location:   nil,
 	}
 	if s.Location != nil {
-		lat, err := strconv.ParseFloat(s.Location.Lat, 64)
+		loc, err := parseLocation(s.Location)
 		if err != nil {
 			return nil, err
 		}
-		lon, err := strconv.ParseFloat(s.Location.Lon, 64)
+		mObj.Location = loc
+	}
+	if s.Geometry != nil {
+		geometry, err := s.Geometry.toDatabase()
 		if err != nil {
 			return nil, err
 		}
-
-		mObj.Location = &db.Location{
-			Lat: lat,
-			Lon: lon,
+		if geometry.IsPoint() {
+			location := &db.Location{Lat: geometry.Coordinates[1], Lon: geometry.Coordinates[0]}
+			if mObj.Location != nil {
+				location.Floor = mObj.Location.Floor
+				location.Accuracy = mObj.Location.Accuracy
+			}
+			if len(geometry.Coordinates) > 2 {
+				// GeoJSON altitudes are above the WGS84 ellipsoid
+				location.Altitude = &geometry.Coordinates[2]
+				location.AltitudeDatum = db.DatumWGS84
+			}
+			mObj.Location = location
+		} else {
+			mObj.GeoJson = geometry
+			mObj.Location = geometry.RepresentativePoint(mObj.Location)
 		}
 	}
+	if s.Coverage != nil {
+		coverage, err := s.Coverage.toDatabase(mObj.Location)
+		if err != nil {
+			return nil, err
+		}
+		mObj.Coverage = coverage
+	}
 	if s.ID != "" {
 		oid, err := primitive.ObjectIDFromHex(s.ID)
 		if err != nil {
@@ -74,18 +225,35 @@ func (s SensorMetadata) ToDatabase() (*db.Sensor, error) {
 // FromDatabaseToSensorMetadata converts the mongo datq structure to the DTO
 func FromDatabaseToSensorMetadata(mobj db.Sensor) *SensorMetadata {
 	sensor := SensorMetadata{
-		Name: mobj.Name,
-		Tags: mobj.Tags,
+		Tenant:     mobj.Tenant,
+		Owner:      mobj.Owner,
+		ACL:        fromDatabaseToACL(mobj.ACL),
+		Name:       mobj.Name,
+		Tags:       mobj.Tags,
+		Type:       mobj.Type,
+		Status:     mobj.Status,
+		Attributes: mobj.Attributes,
+		TimeZone:   mobj.TimeZone,
+		Cell:       mobj.Cell,
+		Derived:    mobj.Derived,
 	}
 	if mobj.ID != primitive.NilObjectID {
 		sensor.ID = mobj.ID.Hex()
 	}
 	if mobj.Location != nil {
 		sensor.Location = &Location{
-			Lat: fmt.Sprintf("%f", mobj.Location.Lat),
-			Lon: fmt.Sprintf("%f", mobj.Location.Lon),
+			Lat:           fmt.Sprintf("%f", mobj.Location.Lat),
+			Lon:           fmt.Sprintf("%f", mobj.Location.Lon),
+			Altitude:      mobj.Location.Altitude,
+			AltitudeDatum: mobj.Location.AltitudeDatum,
+			Floor:         mobj.Location.Floor,
+			Accuracy:      mobj.Location.Accuracy,
 		}
 	}
+	if !mobj.GeoJson.IsPoint() {
+		sensor.Geometry = fromDatabaseToGeometry(mobj.GeoJson)
+	}
+	sensor.Coverage = fromDatabaseToCoverage(mobj.Coverage)
 	return &sensor
 }
 
@@ -97,13 +265,36 @@ type SensorMetadataService interface {
 	AddWithLocationName(ctx context.Context, sensor SensorMetadataWithLocationName) (id string, err error)
 	Update(ctx context.Context, sensor SensorMetadata) (err error)
 	Delete(ctx context.Context, id string) (err error)
-	FindNearest(ctx context.Context, lat, lon string) (sensor *SensorMetadata, err error)
-	FindNearestByLocatioName(ctx context.Context, location string) (sensor *SensorMetadata, err error)
+	TransferOwnership(ctx context.Context, id string, transfer OwnerTransfer) (err error)
+	SetACL(ctx context.Context, id string, acl []ACLEntry) (err error)
+	FindNearest(ctx context.Context, location Location, filter NearestFilter) (sensor *SensorMetadata, err error)
+	FindNearestByLocatioName(ctx context.Context, location string, filter NearestFilter) (sensor *SensorMetadata, err error)
+	List(ctx context.Context, filter SensorListFilter) (sensors []SensorMetadata, err error)
+	FindTimeZone(ctx context.Context, lat, lon string) (timeZone *TimeZone, err error)
+	FindByCell(ctx context.Context, cell string, limit int64) (sensors []SensorMetadata, err error)
+	CountByCell(ctx context.Context, within string, precision int) (counts []CellCount, err error)
+	Tags(ctx context.Context) (tags []TagCount, err error)
+	FindNeighbourCells(ctx context.Context, id string, precision int) (cells *SensorCells, err error)
+	Clusters(ctx context.Context, query ClusterQuery) (clusters *Clusters, err error)
+	Tile(ctx context.Context, query TileQuery) (tile []byte, err error)
+	AnalyzeCoverage(ctx context.Context, request AnalysisRequest) (analysis *CoverageAnalysis, err error)
+	Catchments(ctx context.Context, request AnalysisRequest) (catchments []Catchment, err error)
+	FindCovering(ctx context.Context, lat, lon string) (sensors []CoveringSensor, err error)
+	CheckAreaCoverage(ctx context.Context, area GeoJSONPolygon) (coverage *AreaCoverage, err error)
+	FindNearestBatch(ctx context.Context, queries []NearestQuery) (results []NearestResult, err error)
+	FindAlong(ctx context.Context, request AlongRequest) (sensors []AlongSensor, err error)
+	Move(ctx context.Context, id string, move Move) (err error)
+	LocationHistory(ctx context.Context, id string) (periods []LocationPeriod, err error)
 }
 
 type sensorMetadataService struct {
 	sensorStore db.SensorStore
 	mapBox      MapBox
+	enrichment  enrichmentPipeline
+	timeZones   TimeZoneResolver
+	// nauticalTimeZones is set when no boundaries are loaded, the sensors then only have nautical time zones
+	nauticalTimeZones bool
+	clusters          *clusterCache
 }
 
 func NewSensorMetadataService(uri, databaseName string) (*sensorMetadataService, error) {
@@ -112,9 +303,26 @@ func NewSensorMetadataService(uri, databaseName string) (*sensorMetadataService,
 	if err != nil {
 		return nil, err
 	}
+	timeZones, err := LoadTimeZoneBoundaries(os.Getenv("TIMEZONE_BOUNDARIES"))
+	if err != nil {
+		return nil, err
+	}
+	if len(timeZones.boundaries) == 0 {
+		log.Printf("TIMEZONE_BOUNDARIES is not set, sensors only get the nautical time zone of their longitude")
+	}
+	enrichment, err := newEnrichmentPipelineFromEnv(apiKey, timeZones)
+	if err != nil {
+		return nil, err
+	}
+	go retryPendingEnrichment(ss, enrichment)
 	return &sensorMetadataService{
 		sensorStore: ss,
 		mapBox:      NewMapBox(apiKey),
+		enrichment:  enrichment,
+		timeZones:   timeZones,
+		// Named time zones are only resolved from the boundaries
+		nauticalTimeZones: len(timeZones.boundaries) == 0,
+		clusters:          newClusterCache(),
 	}, nil
 }
 
@@ -143,10 +351,15 @@ func (s sensorMetadataService) Add(ctx context.Context, sensor SensorMetadata) (
 	if err != nil {
 		return "", err
 	}
+	err = s.enrichment.Enrich(ctx, sensorMongo)
+	if err != nil {
+		return "", err
+	}
 	oid, err := s.sensorStore.Add(ctx, *sensorMongo)
 	if err != nil {
 		return "", err
 	}
+	s.clusters.invalidate()
 	return oid.Hex(), nil
 }
 
@@ -156,19 +369,22 @@ func (s sensorMetadataService) AddWithLocationName(ctx context.Context, sensor S
 		return "", err
 	}
 	return s.Add(ctx, SensorMetadata{
-		ID:       sensor.ID,
-		Name:     sensor.Name,
-		Location: loc,
-		Tags:     sensor.Tags,
+		ID:         sensor.ID,
+		Name:       sensor.Name,
+		Location:   loc,
+		Tags:       sensor.Tags,
+		Type:       sensor.Type,
+		Status:     sensor.Status,
+		Attributes: sensor.Attributes,
 	})
 }
 
-func (s sensorMetadataService) FindNearestByLocatioName(ctx context.Context, location string) (sensor *SensorMetadata, err error) {
+func (s sensorMetadataService) FindNearestByLocatioName(ctx context.Context, location string, filter NearestFilter) (sensor *SensorMetadata, err error) {
 	loc, err := s.mapBox.FindLatLon(location)
 	if err != nil {
 		return nil, err
 	}
-	return s.FindNearest(ctx, loc.Lat, loc.Lon)
+	return s.FindNearest(ctx, *loc, filter)
 
 }
 
@@ -177,28 +393,72 @@ func (s sensorMetadataService) Update(ctx context.Context, sensor SensorMetadata
 	if err != nil {
 		return err
 	}
+	_, err = s.findWritable(ctx, sensorMongo.ID)
+	if err != nil {
+		return err
+	}
+	err = s.enrichment.Enrich(ctx, sensorMongo)
+	if err != nil {
+		return err
+	}
 	err = s.sensorStore.Update(ctx, *sensorMongo)
-	return err
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.clusters.invalidate()
+	return nil
 }
 
-func (s sensorMetadataService) FindNearest(ctx context.Context, lat, lon string) (sensor *SensorMetadata, err error) {
-	latF, err := strconv.ParseFloat(lat, 64)
+func (s sensorMetadataService) FindNearest(ctx context.Context, location Location, filter NearestFilter) (sensor *SensorMetadata, err error) {
+	lat, lon, err := parseCoordinates(&location)
 	if err != nil {
 		return nil, err
 	}
-	lonF, err := strconv.ParseFloat(lon, 64)
+	loc := db.Location{
+		Lat: lat,
+		Lon: lon,
+	}
+	sensorMongo, err := s.findNearest(ctx, loc, filter)
 	if err != nil {
 		return nil, err
 	}
-	loc := db.Location{
-		Lat: latF,
-		Lon: lonF,
+	return FromDatabaseToSensorMetadata(*sensorMongo), nil
+}
+
+func (s sensorMetadataService) findNearest(ctx context.Context, loc db.Location, filter NearestFilter) (*db.Sensor, error) {
+	if filter.MaxDistance < 0 {
+		return nil, errors.New("maxDistance must be positive")
 	}
-	sensorMongo, err := s.sensorStore.FindNearest(ctx, loc)
+	err := validateAttributeKeys(filter.Attributes)
 	if err != nil {
 		return nil, err
 	}
-	return FromDatabaseToSensorMetadata(*sensorMongo), nil
+	err = validateAt(filter.At)
+	if err != nil {
+		return nil, err
+	}
+	dbFilter, err := filter.LevelFilter.toDatabase(db.SensorFilter{
+		Tags:       filter.Tags,
+		Type:       filter.Type,
+		Status:     filter.Status,
+		Attributes: filter.Attributes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var sensorMongo *db.Sensor
+	if filter.At != nil {
+		sensorMongo, err = s.sensorStore.FindNearestAt(ctx, loc, dbFilter, filter.MaxDistance, *filter.At)
+	} else {
+		sensorMongo, err = s.sensorStore.FindNearest(ctx, loc, dbFilter, filter.MaxDistance)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	return sensorMongo, err
 }
 
 func (s sensorMetadataService) Delete(ctx context.Context, id string) error {
@@ -206,5 +466,50 @@ func (s sensorMetadataService) Delete(ctx context.Context, id string) error {
 	if err != nil {
 		return err
 	}
-	return s.sensorStore.Delete(ctx, oid)
+	_, err = s.findWritable(ctx, oid)
+	if err != nil {
+		return err
+	}
+	err = s.sensorStore.Delete(ctx, oid)
+	if err != nil {
+		return err
+	}
+	s.clusters.invalidate()
+	return nil
+}
+
+func (s sensorMetadataService) List(ctx context.Context, filter SensorListFilter) ([]SensorMetadata, error) {
+	after := primitive.NilObjectID
+	if filter.After != "" {
+		var err error
+		after, err = primitive.ObjectIDFromHex(filter.After)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.nauticalTimeZones && filter.TimeZone != "" && !isNauticalTimeZone(filter.TimeZone) {
+		return nil, ErrNoTimeZoneBoundaries
+	}
+	dbFilter := db.SensorFilter{
+		Tags:     filter.Tags,
+		TimeZone: filter.TimeZone,
+	}
+	sensorsMongo, err := s.sensorStore.FindPage(ctx, dbFilter, after, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	sensors := make([]SensorMetadata, 0, len(sensorsMongo))
+	for i := range sensorsMongo {
+		sensors = append(sensors, *FromDatabaseToSensorMetadata(sensorsMongo[i]))
+	}
+	return sensors, nil
+}
+
+func (s sensorMetadataService) FindTimeZone(_ context.Context, lat, lon string) (*TimeZone, error) {
+	loc, err := parseLocation(&Location{Lat: lat, Lon: lon})
+	if err != nil {
+		return nil, err
+	}
+	timeZone, source := s.timeZones.Resolve(loc.Lat, loc.Lon)
+	return newTimeZone(timeZone, source, time.Now())
 }
@@ -10,6 +10,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func TestFindByID(t *testing.T) {
@@ -78,11 +79,145 @@ func TestFindNearest(t *testing.T) {
 	mockSensor.On("FindNearest", ctx, db.Location{
 		Lat: 1,
 		Lon: 2,
-	}).Return(&sensor, nil).Once()
+	}, db.SensorFilter{}, 0.0).Return(&sensor, nil).Once()
+	filter := db.SensorFilter{
+		Tags:       []string{"Tag1"},
+		Type:       "temperature",
+		Status:     "active",
+		Attributes: map[string]string{"vendor": "acme"},
+	}
+	mockSensor.On("FindNearest", ctx, db.Location{
+		Lat: 1,
+		Lon: 2,
+	}, filter, 5000.0).Return(nil, mongo.ErrNoDocuments).Once()
 	defer mockSensor.AssertExpectations(t)
-	result, err := service.FindNearest(ctx, "1", "2")
+	result, err := service.FindNearest(ctx, Location{Lat: "1", Lon: "2"}, NearestFilter{})
 	require.NoError(t, err)
 	dbResult, err := result.ToDatabase()
 	require.NoError(t, err)
 	require.Equal(t, sensor, *dbResult)
+
+	_, err = service.FindNearest(ctx, Location{Lat: "1", Lon: "2"}, NearestFilter{
+		Tags:        []string{"Tag1"},
+		Type:        "temperature",
+		Status:      "active",
+		Attributes:  map[string]string{"vendor": "acme"},
+		MaxDistance: 5000,
+	})
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = service.FindNearest(ctx, Location{Lat: "1", Lon: "2"}, NearestFilter{Attributes: map[string]string{"$where": "1"}})
+	require.Error(t, err)
+	_, err = service.FindNearest(ctx, Location{Lat: "1", Lon: "2"}, NearestFilter{MaxDistance: -1})
+	require.Error(t, err)
+}
+
+func TestList(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := context.Background()
+	after := primitive.NewObjectID()
+	sensors := []db.Sensor{
+		{
+			ID:       primitive.NewObjectID(),
+			Name:     "Sensor 1",
+			Tags:     []string{"Tag1"},
+			TimeZone: "Europe/Paris",
+		},
+	}
+	service := sensorMetadataService{
+		sensorStore: mockSensor,
+	}
+	filter := db.SensorFilter{Tags: []string{"Tag1"}, TimeZone: "Europe/Paris"}
+	mockSensor.On("FindPage", ctx, filter, after, int64(10)).Return(sensors, nil).Once()
+	defer mockSensor.AssertExpectations(t)
+	result, err := service.List(ctx, SensorListFilter{
+		Tags:     []string{"Tag1"},
+		TimeZone: "Europe/Paris",
+		After:    after.Hex(),
+		Limit:    10,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []SensorMetadata{
+		{ID: sensors[0].ID.Hex(), Name: "Sensor 1", Tags: []string{"Tag1"}, TimeZone: "Europe/Paris"},
+	}, result)
+
+	// Without boundaries the sensors only have nautical time zones
+	service.nauticalTimeZones = true
+	_, err = service.List(ctx, SensorListFilter{TimeZone: "Europe/Paris", Limit: 10})
+	require.ErrorIs(t, err, ErrNoTimeZoneBoundaries)
+	mockSensor.On("FindPage", ctx, db.SensorFilter{TimeZone: "Etc/GMT-1"}, primitive.NilObjectID, int64(10)).Return(nil, nil).Once()
+	_, err = service.List(ctx, SensorListFilter{TimeZone: "Etc/GMT-1", Limit: 10})
+	require.NoError(t, err)
+}
+
+func TestCells(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := context.Background()
+	sensor := db.Sensor{
+		ID:   primitive.NewObjectID(),
+		Name: "Sensor 1",
+		Location: &db.Location{
+			Lat: 48.8566,
+			Lon: 2.3522,
+		},
+	}
+	service := sensorMetadataService{
+		sensorStore: mockSensor,
+	}
+	mockSensor.On("FindByID", ctx, sensor.ID).Return(&sensor, nil).Once()
+	mockSensor.On("CountByCell", ctx, "u09", 5).Return([]db.CellCount{{Cell: "u09tv", Count: 2}}, nil).Once()
+	defer mockSensor.AssertExpectations(t)
+
+	cells, err := service.FindNeighbourCells(ctx, sensor.ID.Hex(), 5)
+	require.NoError(t, err)
+	require.Equal(t, "u09tv", cells.Cell)
+	require.Len(t, cells.Neighbours, 8)
+	counts, err := service.CountByCell(ctx, "u09", 5)
+	require.NoError(t, err)
+	require.Equal(t, []CellCount{{Cell: "u09tv", Count: 2}}, counts)
+	_, err = service.CountByCell(ctx, "u09", 2)
+	require.Error(t, err)
+	_, err = service.CountByCell(ctx, "", 13)
+	require.EqualError(t, err, "precision must be between 1 and 12")
+	_, err = service.FindByCell(ctx, "u09a", 10)
+	require.Error(t, err)
+}
+
+func TestLocationLevel(t *testing.T) {
+	altitude, floor := 120.5, 3
+	sensor := SensorMetadata{
+		Name:     "Sensor 1",
+		Location: &Location{Lat: "48.85", Lon: "2.35", Altitude: &altitude, Floor: &floor, Accuracy: 5},
+	}
+	mObj, err := sensor.ToDatabase()
+	require.NoError(t, err)
+	require.Equal(t, &db.Location{Lat: 48.85, Lon: 2.35, Altitude: &altitude, AltitudeDatum: db.DatumWGS84, Floor: &floor, Accuracy: 5}, mObj.Location)
+	location := FromDatabaseToSensorMetadata(*mObj).Location
+	require.Equal(t, db.DatumWGS84, location.AltitudeDatum)
+	require.Equal(t, 3, *location.Floor)
+
+	sensor.Location.AltitudeDatum = "sea"
+	_, err = sensor.ToDatabase()
+	require.Error(t, err)
+	sensor.Location.AltitudeDatum = db.DatumAGL
+	sensor.Location.Accuracy = -1
+	_, err = sensor.ToDatabase()
+	require.Error(t, err)
+
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := context.Background()
+	service := sensorMetadataService{sensorStore: mockSensor}
+	low, high := 10.0, 50.0
+	mockSensor.On("FindNearest", ctx, db.Location{Lat: 1, Lon: 2}, db.SensorFilter{
+		Floor:         &floor,
+		MinAltitude:   &low,
+		MaxAltitude:   &high,
+		AltitudeDatum: db.DatumAGL,
+	}, 0.0).Return(mObj, nil).Once()
+	defer mockSensor.AssertExpectations(t)
+	level := LevelFilter{Floor: &floor, MinAltitude: &low, MaxAltitude: &high, AltitudeDatum: db.DatumAGL}
+	_, err = service.FindNearest(ctx, Location{Lat: "1", Lon: "2"}, NearestFilter{LevelFilter: level})
+	require.NoError(t, err)
+	level.MinAltitude, level.MaxAltitude = &high, &low
+	_, err = service.FindNearest(ctx, Location{Lat: "1", Lon: "2"}, NearestFilter{LevelFilter: level})
+	require.Error(t, err)
 }
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+)
+
+// TagCount represents the DTO with the number of sensors having a tag
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// Tags returns the tag catalogue of the tenant, the tags used by its sensors with how many sensors use each of them
+func (s sensorMetadataService) Tags(ctx context.Context) ([]TagCount, error) {
+	tags, err := s.sensorStore.FindTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dtos := make([]TagCount, 0, len(tags))
+	for _, tag := range tags {
+		dtos = append(dtos, TagCount{Tag: tag.Tag, Count: tag.Count})
+	}
+	return dtos, nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+)
+
+const (
+	// TileLayer is the name of the vector tile layer with the sensors
+	TileLayer = "sensors"
+
+	maxTileSensors = 10000
+	// tileBuffer includes the sensors slightly outside the tile, so symbols crossing its border are not cut
+	tileBuffer = 64.0 / geo.TileExtent
+)
+
+var tileKeys = []string{"id", "name", "tags"}
+
+// TileQuery represents the parameters of a vector tile request
+type TileQuery struct {
+	Z    int
+	X    int
+	Y    int
+	Tags []string
+}
+
+func (s sensorMetadataService) Tile(ctx context.Context, query TileQuery) ([]byte, error) {
+	tile, err := geo.NewTile(query.Z, query.X, query.Y, MaxZoom)
+	if err != nil {
+		return nil, err
+	}
+	filter := db.SensorFilter{Tags: query.Tags}
+	sensors, err := s.sensorStore.FindInBBox(ctx, filter, tile.BBox(tileBuffer), maxTileSensors)
+	if err != nil {
+		return nil, err
+	}
+	features := make([]geo.PointFeature, 0, len(sensors))
+	for i := range sensors {
+		x, y := tile.Project(sensors[i].Location.Lat, sensors[i].Location.Lon, geo.TileExtent)
+		properties := map[string]string{
+			"id":   sensors[i].ID.Hex(),
+			"name": sensors[i].Name,
+		}
+		if len(sensors[i].Tags) > 0 {
+			properties["tags"] = strings.Join(sensors[i].Tags, ",")
+		}
+		features = append(features, geo.PointFeature{X: x, Y: y, Properties: properties})
+	}
+	return geo.EncodePointLayer(TileLayer, tileKeys, features), nil
+}
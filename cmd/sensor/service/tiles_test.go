@@ -0,0 +1,38 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	dbMock "github.com/ViniciusMiana/sensor-metadata/mocks/sensor/db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTile(t *testing.T) {
+	mockSensor := dbMock.NewSensorStore(t)
+	ctx := context.Background()
+	sensor := db.Sensor{
+		ID:       primitive.NewObjectID(),
+		Name:     "Sensor Paris",
+		Tags:     []string{"Tag1", "Tag2"},
+		Location: &db.Location{Lat: 48.8566, Lon: 2.3522},
+	}
+	service := sensorMetadataService{
+		sensorStore: mockSensor,
+	}
+	filter := db.SensorFilter{Tags: []string{"Tag1"}}
+	mockSensor.On("FindInBBox", ctx, filter, mock.Anything, int64(maxTileSensors)).Return([]db.Sensor{sensor}, nil).Once()
+	defer mockSensor.AssertExpectations(t)
+
+	tile, err := service.Tile(ctx, TileQuery{Z: 10, X: 518, Y: 352, Tags: []string{"Tag1"}})
+	require.NoError(t, err)
+	require.True(t, bytes.Contains(tile, []byte(TileLayer)))
+	require.True(t, bytes.Contains(tile, []byte(sensor.ID.Hex())))
+	require.True(t, bytes.Contains(tile, []byte("Tag1,Tag2")))
+	_, err = service.Tile(ctx, TileQuery{Z: 1, X: 2, Y: 0})
+	require.EqualError(t, err, "tile 1/2/0 does not exist")
+}
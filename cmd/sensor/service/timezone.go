@@ -0,0 +1,147 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/geo"
+)
+
+// Source of a resolved time zone
+const (
+	// TimeZoneFromBoundary means the location is inside a boundary of the loaded dataset
+	TimeZoneFromBoundary = "boundary"
+	// TimeZoneNautical means no boundary contains the location and the nautical zone of its longitude was used
+	TimeZoneNautical = "nautical"
+)
+
+// ErrNoTimeZoneBoundaries is returned when filtering by a named time zone while no boundaries are loaded, no sensor
+// would have it
+var ErrNoTimeZoneBoundaries = errors.New("time zones other than Etc/GMT ones require TIMEZONE_BOUNDARIES")
+
+// TimeZone represents the DTO with the time zone of a location
+type TimeZone struct {
+	TimeZone  string `json:"timeZone"`
+	UTCOffset string `json:"utcOffset"`
+	Source    string `json:"source"`
+}
+
+// TimeZoneResolver resolves the IANA time zone of a location without calling external services
+type TimeZoneResolver interface {
+	Resolve(lat, lon float64) (timeZone, source string)
+}
+
+type timeZoneBoundary struct {
+	timeZone string
+	bbox     geo.BBox
+	polygons [][][][]float64
+}
+
+// timeZoneIndex resolves time zones from a boundary dataset such as the ones published by timezone-boundary-builder
+type timeZoneIndex struct {
+	boundaries []timeZoneBoundary
+}
+
+// LoadTimeZoneBoundaries loads a GeoJSON FeatureCollection whose features are Polygons or MultiPolygons
+// with the IANA time zone in the tzid property. An empty path loads no boundaries, so only nautical zones are used.
+func LoadTimeZoneBoundaries(path string) (*timeZoneIndex, error) {
+	index := &timeZoneIndex{}
+	if path == "" {
+		return index, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var collection struct {
+		Features []struct {
+			Properties struct {
+				TZID string `json:"tzid"`
+			} `json:"properties"`
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	err = json.NewDecoder(file).Decode(&collection)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse time zone boundaries: %v", err)
+	}
+	for _, feature := range collection.Features {
+		_, err = time.LoadLocation(feature.Properties.TZID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q in boundaries: %v", feature.Properties.TZID, err)
+		}
+		boundary := timeZoneBoundary{timeZone: feature.Properties.TZID, bbox: geo.EmptyBBox()}
+		switch feature.Geometry.Type {
+		case "Polygon":
+			var polygon [][][]float64
+			err = json.Unmarshal(feature.Geometry.Coordinates, &polygon)
+			boundary.polygons = [][][][]float64{polygon}
+		case "MultiPolygon":
+			err = json.Unmarshal(feature.Geometry.Coordinates, &boundary.polygons)
+		default:
+			err = fmt.Errorf("unsupported geometry %s", feature.Geometry.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid boundary for time zone %s: %v", feature.Properties.TZID, err)
+		}
+		for _, polygon := range boundary.polygons {
+			box := geo.PolygonBBox(polygon)
+			boundary.bbox.Extend(box.MinLon, box.MinLat)
+			boundary.bbox.Extend(box.MaxLon, box.MaxLat)
+		}
+		index.boundaries = append(index.boundaries, boundary)
+	}
+	return index, nil
+}
+
+// Resolve returns the time zone of the first boundary containing the location, or its nautical time zone
+func (index *timeZoneIndex) Resolve(lat, lon float64) (timeZone, source string) {
+	for i := range index.boundaries {
+		boundary := &index.boundaries[i]
+		if !boundary.bbox.Contains(lon, lat) {
+			continue
+		}
+		for _, polygon := range boundary.polygons {
+			if geo.PolygonContains(polygon, lon, lat) {
+				return boundary.timeZone, TimeZoneFromBoundary
+			}
+		}
+	}
+	return nauticalTimeZone(lon), TimeZoneNautical
+}
+
+// nauticalTimeZone returns the Etc zone of the 15 degrees band of the longitude.
+// Note that the sign of Etc zones is inverted, Etc/GMT-1 is UTC+01:00.
+func nauticalTimeZone(lon float64) string {
+	offset := int(math.Round(lon / 15))
+	if offset == 0 {
+		return "Etc/GMT"
+	}
+	return fmt.Sprintf("Etc/GMT%+d", -offset)
+}
+
+// isNauticalTimeZone tells whether the time zone is one of those returned by nauticalTimeZone
+func isNauticalTimeZone(timeZone string) bool {
+	return timeZone == "Etc/GMT" || strings.HasPrefix(timeZone, "Etc/GMT+") || strings.HasPrefix(timeZone, "Etc/GMT-")
+}
+
+func newTimeZone(timeZone, source string, now time.Time) (*TimeZone, error) {
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, err
+	}
+	return &TimeZone{
+		TimeZone:  timeZone,
+		UTCOffset: now.In(location).Format("-07:00"),
+		Source:    source,
+	}, nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ViniciusMiana/sensor-metadata/cmd/sensor/db"
+	"github.com/stretchr/testify/require"
+)
+
+const testBoundaries = `{"type":"FeatureCollection","features":[
+{"type":"Feature","properties":{"tzid":"Europe/Paris"},
+ "geometry":{"type":"Polygon","coordinates":[[[-5,42],[8,42],[8,51],[-5,51],[-5,42]]]}},
+{"type":"Feature","properties":{"tzid":"America/New_York"},
+ "geometry":{"type":"MultiPolygon","coordinates":[[[[-80,35],[-70,35],[-70,45],[-80,45],[-80,35]]]]}}
+]}`
+
+func TestTimeZoneIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "boundaries.json")
+	require.NoError(t, os.WriteFile(path, []byte(testBoundaries), 0o600))
+	index, err := LoadTimeZoneBoundaries(path)
+	require.NoError(t, err)
+
+	timeZone, source := index.Resolve(48.8566, 2.3522)
+	require.Equal(t, "Europe/Paris", timeZone)
+	require.Equal(t, TimeZoneFromBoundary, source)
+	timeZone, _ = index.Resolve(40.7128, -74.0060)
+	require.Equal(t, "America/New_York", timeZone)
+	timeZone, source = index.Resolve(-33.8688, 151.2093)
+	require.Equal(t, "Etc/GMT-10", timeZone)
+	require.Equal(t, TimeZoneNautical, source)
+	timeZone, _ = index.Resolve(0, -3)
+	require.Equal(t, "Etc/GMT", timeZone)
+
+	empty, err := LoadTimeZoneBoundaries("")
+	require.NoError(t, err)
+	timeZone, _ = empty.Resolve(48.8566, 2.3522)
+	require.Equal(t, "Etc/GMT", timeZone)
+
+	sensor := db.Sensor{Location: &db.Location{Lat: 48.8566, Lon: 2.3522}, TimeZone: "UTC"}
+	require.NoError(t, enrichmentPipeline{timeZones: index}.Enrich(context.Background(), &sensor))
+	require.Equal(t, "Europe/Paris", sensor.TimeZone)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"features":[{"properties":{"tzid":"Mars/Olympus"}}]}`), 0o600))
+	_, err = LoadTimeZoneBoundaries(path)
+	require.Error(t, err)
+}
+
+func TestIsNauticalTimeZone(t *testing.T) {
+	for _, lon := range []float64{-180, -3, 0, 15, 151.2, 180} {
+		require.True(t, isNauticalTimeZone(nauticalTimeZone(lon)), lon)
+	}
+	require.False(t, isNauticalTimeZone("Europe/Paris"))
+	require.False(t, isNauticalTimeZone("Etc/UTC"))
+}
+
+func TestNewTimeZone(t *testing.T) {
+	winter := time.Date(2023, 1, 15, 12, 0, 0, 0, time.UTC)
+	tz, err := newTimeZone("Europe/Paris", TimeZoneFromBoundary, winter)
+	require.NoError(t, err)
+	require.Equal(t, TimeZone{TimeZone: "Europe/Paris", UTCOffset: "+01:00", Source: TimeZoneFromBoundary}, *tz)
+	tz, err = newTimeZone("Etc/GMT+5", TimeZoneNautical, winter)
+	require.NoError(t, err)
+	require.Equal(t, "-05:00", tz.UTCOffset)
+}
@@ -52,7 +52,7 @@ type TestAuthWriter struct {
 }
 
 // ParseTestToken parses the test token it should contain two strings role and error or NIL.
-func ParseTestToken(token string, _ []byte) (*handlers.TokenClaims, error) {
+func ParseTestToken(token string) (*handlers.TokenClaims, error) {
 	fields := strings.Fields(token)
 	role := ""
 	var err error